@@ -21,8 +21,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/arugal/laborer/pkg/dashboard"
+	"github.com/arugal/laborer/pkg/notifier"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/service/filter"
+	"github.com/arugal/laborer/pkg/service/policy"
 	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/service/signature"
+	"github.com/arugal/laborer/pkg/service/vulnerability"
 	"github.com/arugal/laborer/pkg/simple/client/k8s"
+	"github.com/arugal/laborer/pkg/webhook/image/generic"
+	"github.com/arugal/laborer/pkg/webhook/image/gitlab"
+	"github.com/arugal/laborer/pkg/webhook/image/harbor"
+	"github.com/arugal/laborer/pkg/webhook/image/latesttag"
 	"github.com/spf13/pflag"
 	"k8s.io/klog"
 
@@ -37,6 +48,18 @@ type LaborerControllerManagerOptions struct {
 	LeaderElection           *leaderelection.LeaderElectionConfig
 	WebhookCertDir           string
 	RepositoryServiceOptions *repositoryservice.RepositoryServiceOptions
+	DashboardOptions         *dashboard.DashboardOptions
+	NotifierOptions          *notifier.NotifierOptions
+	LatestTagOptions         *latesttag.LatestTagOptions
+	ImagePolicyOptions       *latesttag.ImagePolicyOptions
+	GitLabOptions            *gitlab.GitLabOptions
+	HarborOptions            *harbor.HarborOptions
+	VulnerabilityGateOptions *vulnerability.VulnerabilityGateOptions
+	SignatureOptions         *signature.SignatureOptions
+	FilterOptions            *filter.FilterOptions
+	ImageAliasOptions        *eventservice.ImageAliasOptions
+	ImageEventPolicyOptions  *policy.ImageEventPolicyOptions
+	GenericWebhookOptions    *generic.GenericWebhookOptions
 }
 
 func NewLaborerControllerManagerOptions() *LaborerControllerManagerOptions {
@@ -51,6 +74,18 @@ func NewLaborerControllerManagerOptions() *LaborerControllerManagerOptions {
 		LeaderElectNamespace:     "",
 		WebhookCertDir:           "",
 		RepositoryServiceOptions: repositoryservice.NewRepositoryServiceOptions(),
+		DashboardOptions:         dashboard.NewDashboardOptions(),
+		NotifierOptions:          notifier.NewNotifierOptions(),
+		LatestTagOptions:         latesttag.NewLatestTagOptions(),
+		ImagePolicyOptions:       latesttag.NewImagePolicyOptions(),
+		GitLabOptions:            gitlab.NewGitLabOptions(),
+		HarborOptions:            harbor.NewHarborOptions(),
+		VulnerabilityGateOptions: vulnerability.NewVulnerabilityGateOptions(),
+		SignatureOptions:         signature.NewSignatureOptions(),
+		FilterOptions:            filter.NewFilterOptions(),
+		ImageAliasOptions:        eventservice.NewImageAliasOptions(),
+		ImageEventPolicyOptions:  policy.NewImageEventPolicyOptions(),
+		GenericWebhookOptions:    generic.NewGenericWebhookOptions(),
 	}
 }
 
@@ -59,6 +94,16 @@ func (s *LaborerControllerManagerOptions) Flags() cliflag.NamedFlagSets {
 
 	s.KubernetesOptions.AddFlags(fss.FlagSet("kubernetes"), s.KubernetesOptions)
 	s.RepositoryServiceOptions.AddFlags(fss.FlagSet("repository"))
+	s.DashboardOptions.AddFlags(fss.FlagSet("dashboard"))
+	s.NotifierOptions.AddFlags(fss.FlagSet("notification"))
+	s.LatestTagOptions.AddFlags(fss.FlagSet("latest-tag"))
+	s.ImagePolicyOptions.AddFlags(fss.FlagSet("image-policy"))
+	s.GitLabOptions.AddFlags(fss.FlagSet("gitlab"))
+	s.HarborOptions.AddFlags(fss.FlagSet("harbor"))
+	s.VulnerabilityGateOptions.AddFlags(fss.FlagSet("vulnerability"))
+	s.SignatureOptions.AddFlags(fss.FlagSet("signature"))
+	s.FilterOptions.AddFlags(fss.FlagSet("filter"))
+	s.ImageEventPolicyOptions.AddFlags(fss.FlagSet("image-event-policy"))
 
 	fs := fss.FlagSet("leaderelection")
 	s.bindLeaderElectionFlags(s.LeaderElection, fs)
@@ -89,6 +134,18 @@ func (s *LaborerControllerManagerOptions) Flags() cliflag.NamedFlagSets {
 func (s *LaborerControllerManagerOptions) Validate() (errs []error) {
 	errs = append(errs, s.KubernetesOptions.Validate()...)
 	errs = append(errs, s.RepositoryServiceOptions.Validate()...)
+	errs = append(errs, s.DashboardOptions.Validate()...)
+	errs = append(errs, s.NotifierOptions.Validate()...)
+	errs = append(errs, s.LatestTagOptions.Validate()...)
+	errs = append(errs, s.ImagePolicyOptions.Validate()...)
+	errs = append(errs, s.GitLabOptions.Validate()...)
+	errs = append(errs, s.HarborOptions.Validate()...)
+	errs = append(errs, s.VulnerabilityGateOptions.Validate()...)
+	errs = append(errs, s.SignatureOptions.Validate()...)
+	errs = append(errs, s.FilterOptions.Validate()...)
+	errs = append(errs, s.ImageAliasOptions.Validate()...)
+	errs = append(errs, s.ImageEventPolicyOptions.Validate()...)
+	errs = append(errs, s.GenericWebhookOptions.Validate()...)
 	return errs
 }
 
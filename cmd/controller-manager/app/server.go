@@ -22,17 +22,31 @@ import (
 	"os"
 
 	"github.com/arugal/laborer/cmd/controller-manager/app/options"
+	"github.com/arugal/laborer/pkg/apiserver"
 	"github.com/arugal/laborer/pkg/config"
 	"github.com/arugal/laborer/pkg/controller/namespace"
+	"github.com/arugal/laborer/pkg/dashboard"
 	"github.com/arugal/laborer/pkg/informers"
+	"github.com/arugal/laborer/pkg/notifier"
 	"github.com/arugal/laborer/pkg/server"
+	"github.com/arugal/laborer/pkg/service/activity"
 	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/service/filter"
+	"github.com/arugal/laborer/pkg/service/policy"
 	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/service/signature"
+	"github.com/arugal/laborer/pkg/service/vulnerability"
 	"github.com/arugal/laborer/pkg/simple/client/k8s"
+	"github.com/arugal/laborer/pkg/simple/client/registry"
 	"github.com/arugal/laborer/pkg/utils/term"
+	"github.com/arugal/laborer/pkg/webhook/image/distribution"
+	"github.com/arugal/laborer/pkg/webhook/image/dockerhub"
+	"github.com/arugal/laborer/pkg/webhook/image/generic"
 	"github.com/arugal/laborer/pkg/webhook/image/github"
+	"github.com/arugal/laborer/pkg/webhook/image/gitlab"
 	"github.com/arugal/laborer/pkg/webhook/image/harbor"
 	"github.com/arugal/laborer/pkg/webhook/image/latesttag"
+	"github.com/arugal/laborer/pkg/webhook/image/quay"
 	"github.com/spf13/cobra"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	cliflag "k8s.io/component-base/cli/flag"
@@ -51,6 +65,18 @@ func NewControllerManagerCommand() *cobra.Command {
 		s = &options.LaborerControllerManagerOptions{
 			KubernetesOptions:        conf.KubernetesOptions,
 			RepositoryServiceOptions: conf.RepositoryServiceOptions,
+			DashboardOptions:         conf.DashboardOptions,
+			NotifierOptions:          conf.NotifierOptions,
+			LatestTagOptions:         conf.LatestTagOptions,
+			ImagePolicyOptions:       conf.ImagePolicyOptions,
+			GitLabOptions:            conf.GitLabOptions,
+			HarborOptions:            conf.HarborOptions,
+			VulnerabilityGateOptions: conf.VulnerabilityGateOptions,
+			SignatureOptions:         conf.SignatureOptions,
+			FilterOptions:            conf.FilterOptions,
+			ImageAliasOptions:        conf.ImageAliasOptions,
+			ImageEventPolicyOptions:  conf.ImageEventPolicyOptions,
+			GenericWebhookOptions:    conf.GenericWebhookOptions,
 			LeaderElection:           s.LeaderElection,
 			LeaderElectNamespace:     s.LeaderElectNamespace,
 			LeaderElect:              s.LeaderElect,
@@ -119,11 +145,34 @@ func run(s *options.LaborerControllerManagerOptions, ctx context.Context) error
 
 	klog.V(0).Info("setting up manager")
 
-	imageEventCollect := eventservice.NewImageEventCollect()
-	repositoryService, err := repositoryservice.NewRepositoryService(s.RepositoryServiceOptions)
+	history := activity.NewHistory(0)
+	broadcaster := activity.NewBroadcaster()
+	recorder := activity.Recorders{history, broadcaster}
+	repositoryService, err := repositoryservice.NewRepositoryService(s.RepositoryServiceOptions, kubernetesClient.Kubernetes())
 	if err != nil {
 		klog.Fatalf("NewRepositoryService err: %v\n", err)
 	}
+	imageFilter, err := filter.NewFilter(s.FilterOptions)
+	if err != nil {
+		klog.Fatalf("NewFilter err: %v\n", err)
+	}
+	// the vulnerability gate queries the scan results without the cache
+	scanner, _ := repositoryService.(repositoryservice.VulnerabilityScanner)
+	// the filtered events are dropped before they are recorded
+	imageEventCollect := filter.NewFilteredImageEventCollect(activity.NewRecordingImageEventCollect(vulnerability.NewGatedImageEventCollect(
+		eventservice.NewImageEventCollect(), s.VulnerabilityGateOptions, scanner, recorder), recorder), imageFilter)
+	aliases := eventservice.NewImageAliases(s.ImageAliasOptions)
+	repositoryService = repositoryservice.NewCachedRepositoryService(repositoryService, s.RepositoryServiceOptions.CacheTTL, imageEventCollect, aliases)
+	repositoryService = filter.NewFilteredRepositoryService(repositoryService, imageFilter)
+	verifier := signature.NewVerifier(s.SignatureOptions, kubernetesClient.Kubernetes(),
+		func(ctx context.Context, host string, keychain repositoryservice.Keychain) (registry.Options, error) {
+			return s.RepositoryServiceOptions.RegistryClientOptions(ctx, kubernetesClient.Kubernetes(), host, keychain)
+		})
+	authorizer, err := policy.NewImageEventPolicy(s.ImageEventPolicyOptions,
+		informerFactory.KubernetesSharedInformerFactory().Core().V1().Namespaces().Lister(), aliases)
+	if err != nil {
+		klog.Fatalf("NewImageEventPolicy err: %v\n", err)
+	}
 
 	// Use 8443 instead of 443 cause we need root permission to bind port 443
 	mgr, err := manager.New(kubernetesClient.Config(), mgrOptions)
@@ -131,15 +180,38 @@ func run(s *options.LaborerControllerManagerOptions, ctx context.Context) error
 		klog.Fatalf("unable to set up overall controller manager: %v", err)
 	}
 
-	namespaceController := namespace.NewNamespaceController(informerFactory, kubernetesClient.Kubernetes(), imageEventCollect)
+	namespaceController := namespace.NewNamespaceController(informerFactory, kubernetesClient.Kubernetes(), imageEventCollect, recorder, verifier, aliases, authorizer)
 
 	httpServer := server.NewHttpServer()
-	httpServer.Register("/webhook-v1alpha1-harbor-image", harbor.NewImageEventWebHook(imageEventCollect))
-	httpServer.Register("/webhook-v1alpha1-github-package", github.NewImageEventWebhook(imageEventCollect))
+	// http 与 admission webhook 的端口共用同一个 harbor webhook, 等待扫描的 push 与扫描结果可能从不同的端口进入
+	harborWebHook := activity.NewReceivedHandler(harbor.NewImageEventWebHook(s.HarborOptions, imageEventCollect), "harbor", recorder)
+	httpServer.Register("/webhook-v1alpha1-harbor-image", harborWebHook)
+	httpServer.Register("/webhook-v1alpha1-github-package", activity.NewReceivedHandler(github.NewImageEventWebhook(imageEventCollect), "github", recorder))
+	httpServer.Register("/webhook-v1alpha1-distribution-image", activity.NewReceivedHandler(distribution.NewImageEventWebHook(imageEventCollect), "distribution", recorder))
+	httpServer.Register("/webhook-v1alpha1-gitlab-image", activity.NewReceivedHandler(gitlab.NewImageEventWebHook(s.GitLabOptions, imageEventCollect), "gitlab", recorder))
+	httpServer.Register("/webhook-v1alpha1-dockerhub-image", activity.NewReceivedHandler(dockerhub.NewImageEventWebHook(imageEventCollect), "dockerhub", recorder))
+	httpServer.Register("/webhook-v1alpha1-quay-image", activity.NewReceivedHandler(quay.NewImageEventWebHook(imageEventCollect), "quay", recorder))
+	for _, endpoint := range s.GenericWebhookOptions.Endpoints {
+		handler, err := generic.NewImageEventWebHook(endpoint, imageEventCollect)
+		if err != nil {
+			klog.Fatalf("NewImageEventWebHook err: %v\n", err)
+		}
+		httpServer.Register(generic.Path(endpoint.Name), activity.NewReceivedHandler(handler, endpoint.Name, recorder))
+	}
+	httpServer.Register(apiserver.PathPrefix, apiserver.NewAPIServer(kubernetesClient.Kubernetes(), namespaceController, history, broadcaster, imageEventCollect))
+	if s.DashboardOptions.Enabled {
+		httpServer.Register(dashboard.PathPrefix, dashboard.NewDashboard(s.DashboardOptions, namespaceController, history))
+	}
+
+	laborerNotifier, err := notifier.NewNotifier(s.NotifierOptions, broadcaster)
+	if err != nil {
+		klog.Fatalf("NewNotifier err: %v\n", err)
+	}
 
 	controllers := map[string]manager.Runnable{
 		"namespace-controller":   namespaceController,
 		"http-server-controller": httpServer,
+		"notifier":               laborerNotifier,
 	}
 
 	for name, c := range controllers {
@@ -164,8 +236,11 @@ func run(s *options.LaborerControllerManagerOptions, ctx context.Context) error
 	// kubernetes admission webhook
 	hookServer := mgr.GetWebhookServer()
 	// TODO Exposure via HTTP
-	hookServer.Register("/webhook-v1alpha1-harbor-image", harbor.NewImageEventWebHook(imageEventCollect))
-	hookServer.Register("/webhook-v1alpha1-pod-latest-tag", &webhook.Admission{Handler: latesttag.NewLatestTagWebHook(repositoryService)})
+	hookServer.Register("/webhook-v1alpha1-harbor-image", harborWebHook)
+	hookServer.Register("/webhook-v1alpha1-pod-latest-tag", &webhook.Admission{Handler: latesttag.NewLatestTagWebHook(s.LatestTagOptions, repositoryService,
+		verifier, kubernetesClient.Kubernetes(), s.RepositoryServiceOptions.LookupTimeout, recorder)})
+	hookServer.Register("/webhook-v1alpha1-pod-image-policy", &webhook.Admission{Handler: latesttag.NewImagePolicyWebHook(s.ImagePolicyOptions,
+		kubernetesClient.Kubernetes())})
 
 	klog.V(0).Info("Starting the controllers.")
 	if err = mgr.Start(ctx); err != nil {
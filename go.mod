@@ -5,6 +5,7 @@ go 1.15
 require (
 	github.com/antihax/optional v1.0.0
 	github.com/docker/docker v1.4.2-0.20190822205725-ed20165a37b4
+	github.com/prometheus/client_golang v1.7.1
 	github.com/scultura-org/harborapi v0.0.0-20201101061223-00bd5186364a
 	github.com/spf13/cobra v1.1.1
 	github.com/spf13/pflag v1.0.5
@@ -17,7 +17,13 @@
 package v1
 
 type Deployment struct {
-	Spec DeploymentSpec `json:"spec"`
+	Metadata *ObjectMetadata `json:"metadata,omitempty"`
+	Spec     DeploymentSpec  `json:"spec"`
+}
+
+// ObjectMetadata the annotation with nil value is removed by the strategic merge patch
+type ObjectMetadata struct {
+	Annotations map[string]*string `json:"annotations,omitempty"`
 }
 
 type DeploymentSpec struct {
@@ -30,7 +36,7 @@ type PodTemplateSpec struct {
 }
 
 type Metadata struct {
-	Annotations map[string]string `json:"annotations"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type PodSpec struct {
@@ -0,0 +1,282 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/arugal/laborer/pkg/controller/namespace"
+	"github.com/arugal/laborer/pkg/service/activity"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// PathPrefix the prefix of the versioned api
+	PathPrefix = "/api/v1/"
+
+	sourceAPI = "api"
+
+	defaultLimit = 20
+	maxLimit     = 500
+)
+
+// NamespaceManager manage the AggregationController of the namespaces
+type NamespaceManager interface {
+	ManagedNamespaces() []namespace.ManagedNamespace
+	IsManaged(namespace string) bool
+	RestartConfigMap(namespace, name string) error
+}
+
+// ListResult a page of items
+type ListResult struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  interface{} `json:"items"`
+}
+
+// ImageEventRequest the body of the manual image event
+type ImageEventRequest struct {
+	// Image full image name, the tag is optional if Tag is set, eg: demo.goharbor.io/project/repo:v1
+	Image string `json:"image"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// Status the result of a write operation
+type Status struct {
+	Message string `json:"message"`
+	EventID string `json:"eventId,omitempty"`
+}
+
+// apiServer the admin api of laborer, every request is authenticated by TokenReview
+// and authorized by SubjectAccessReview against the virtual api group laborer.io
+type apiServer struct {
+	authorizer *authorizer
+
+	namespaces  NamespaceManager
+	history     *activity.History
+	broadcaster *activity.Broadcaster
+	collect     eventservice.ImageEventCollect
+}
+
+// NewAPIServer return the handler of the admin api, it should be registered with PathPrefix
+func NewAPIServer(client kubernetes.Interface, namespaces NamespaceManager, history *activity.History,
+	broadcaster *activity.Broadcaster, collect eventservice.ImageEventCollect) http.Handler {
+	return &apiServer{
+		authorizer:  &authorizer{client: client},
+		namespaces:  namespaces,
+		history:     history,
+		broadcaster: broadcaster,
+		collect:     collect,
+	}
+}
+
+func (a *apiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, PathPrefix), "/"), "/")
+
+	switch {
+	case req.Method == http.MethodGet && len(parts) == 1 && parts[0] == "namespaces":
+		a.listNamespaces(w, req)
+	case req.Method == http.MethodGet && len(parts) == 1 && parts[0] == "events":
+		a.listEvents(w, req)
+	case req.Method == http.MethodGet && len(parts) == 2 && parts[0] == "events":
+		a.getEvent(w, req, parts[1])
+	case req.Method == http.MethodGet && len(parts) == 1 && parts[0] == "watch":
+		a.watch(w, req)
+	case req.Method == http.MethodPost && len(parts) == 3 && parts[0] == "namespaces" && parts[2] == "imageevents":
+		a.createImageEvent(w, req, parts[1])
+	case req.Method == http.MethodPost && len(parts) == 5 && parts[0] == "namespaces" && parts[2] == "configmaps" && parts[4] == "restart":
+		a.restartConfigMap(w, req, parts[1], parts[3])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", req.Method, req.URL.Path))
+	}
+}
+
+func (a *apiServer) listNamespaces(w http.ResponseWriter, req *http.Request) {
+	if !a.authorize(w, req, authorizationv1.ResourceAttributes{Verb: "list", Resource: "namespaces"}) {
+		return
+	}
+	namespaces := a.namespaces.ManagedNamespaces()
+	writeJSON(w, http.StatusOK, ListResult{
+		Total: len(namespaces),
+		Limit: len(namespaces),
+		Items: namespaces,
+	})
+}
+
+func (a *apiServer) listEvents(w http.ResponseWriter, req *http.Request) {
+	if !a.authorize(w, req, authorizationv1.ResourceAttributes{Verb: "list", Resource: "events"}) {
+		return
+	}
+	offset, limit, err := pagination(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	total, records := a.history.List(offset, limit)
+	if records == nil {
+		records = []activity.EventRecord{}
+	}
+	writeJSON(w, http.StatusOK, ListResult{
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+		Items:  records,
+	})
+}
+
+func (a *apiServer) getEvent(w http.ResponseWriter, req *http.Request, id string) {
+	if !a.authorize(w, req, authorizationv1.ResourceAttributes{Verb: "get", Resource: "events", Name: id}) {
+		return
+	}
+	record, ok := a.history.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("event %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (a *apiServer) createImageEvent(w http.ResponseWriter, req *http.Request, ns string) {
+	if !a.authorize(w, req, authorizationv1.ResourceAttributes{Verb: "create", Resource: "imageevents", Namespace: ns}) {
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var imageEventReq ImageEventRequest
+	if err = json.Unmarshal(body, &imageEventReq); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if imageEventReq.Image == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("image is required"))
+		return
+	}
+	if !a.namespaces.IsManaged(ns) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("namespace %s is not managed by laborer", ns))
+		return
+	}
+
+	event := eventservice.OfImageEvent(imageEventReq.Image)
+	if imageEventReq.Tag != "" {
+		event = eventservice.ImageEvent{
+			Image: imageEventReq.Image,
+			Tag:   imageEventReq.Tag,
+		}
+	}
+	event.ID = activity.NewEventID()
+	event.Source = sourceAPI
+	event.Namespace = ns
+
+	klog.Infof("api trigger image event %s, namespace: %s", event, ns)
+	a.collect.Collect(event)
+	writeJSON(w, http.StatusAccepted, Status{
+		Message: fmt.Sprintf("image event %s queued", event),
+		EventID: event.ID,
+	})
+}
+
+func (a *apiServer) restartConfigMap(w http.ResponseWriter, req *http.Request, ns, name string) {
+	if !a.authorize(w, req, authorizationv1.ResourceAttributes{Verb: "create", Resource: "configmaps", Subresource: "restart",
+		Namespace: ns, Name: name}) {
+		return
+	}
+
+	klog.Infof("api trigger configmap %s.%s restart", ns, name)
+	if err := a.namespaces.RestartConfigMap(ns, name); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Status{
+		Message: fmt.Sprintf("configmap %s.%s restarted", ns, name),
+	})
+}
+
+// authorize write the error response and return false if the request is not allowed
+func (a *apiServer) authorize(w http.ResponseWriter, req *http.Request, attr authorizationv1.ResourceAttributes) bool {
+	err := a.authorizer.authorize(req, attr)
+	if err != nil {
+		klog.V(2).Infof("api %s %s denied: %v", req.Method, req.URL.Path, err)
+		writeError(w, errorStatus(err), err)
+		return false
+	}
+	return true
+}
+
+func pagination(req *http.Request) (offset, limit int, err error) {
+	offset, limit = 0, defaultLimit
+	query := req.URL.Query()
+	if v := query.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %s", v)
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit %s", v)
+		}
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return offset, limit, nil
+}
+
+func errorStatus(err error) int {
+	switch err.(type) {
+	case *UnauthorizedError:
+		return http.StatusUnauthorized
+	case *ForbiddenError:
+		return http.StatusForbidden
+	case *namespace.NotManagedError:
+		return http.StatusNotFound
+	case *namespace.NotSupportError:
+		return http.StatusBadRequest
+	}
+	if errors.IsNotFound(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, Status{Message: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		klog.Errorf("api marshal %v err: %v", v, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
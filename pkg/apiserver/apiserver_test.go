@@ -0,0 +1,336 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arugal/laborer/pkg/controller/namespace"
+	"github.com/arugal/laborer/pkg/service/activity"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testToken = "token"
+
+type collected struct {
+	eventservice.ImageEventCollect
+
+	events []eventservice.ImageEvent
+}
+
+func (c *collected) Collect(event eventservice.ImageEvent) {
+	c.events = append(c.events, event)
+}
+
+// fakeNamespaceManager manage the namespaces, restarted records the restarted configmaps
+type fakeNamespaceManager struct {
+	managed   []string
+	restarted []string
+}
+
+func (f *fakeNamespaceManager) ManagedNamespaces() []namespace.ManagedNamespace {
+	var namespaces []namespace.ManagedNamespace
+	for _, ns := range f.managed {
+		namespaces = append(namespaces, namespace.ManagedNamespace{Name: ns, Controllers: []string{"deployment"}})
+	}
+	return namespaces
+}
+
+func (f *fakeNamespaceManager) IsManaged(ns string) bool {
+	for _, managed := range f.managed {
+		if managed == ns {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeNamespaceManager) RestartConfigMap(ns, name string) error {
+	if !f.IsManaged(ns) {
+		return &namespace.NotManagedError{}
+	}
+	f.restarted = append(f.restarted, ns+"/"+name)
+	return nil
+}
+
+// fakeReviewClient authenticate testToken as tester and allow the SubjectAccessReviews accepted by allow,
+// the SubjectAccessReviews of other api groups are denied
+func fakeReviewClient(allow func(attr authorizationv1.ResourceAttributes) bool) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token != testToken {
+			review.Status = authenticationv1.TokenReviewStatus{Error: "token expired"}
+			return true, review, nil
+		}
+		review.Status = authenticationv1.TokenReviewStatus{
+			Authenticated: true,
+			User:          authenticationv1.UserInfo{Username: "tester"},
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attr := sar.Spec.ResourceAttributes
+		sar.Status = authorizationv1.SubjectAccessReviewStatus{
+			Allowed: sar.Spec.User == "tester" && attr != nil && attr.Group == apiGroup && allow(*attr),
+		}
+		return true, sar, nil
+	})
+	return client
+}
+
+// allowNamespace allow every verb in the namespace
+func allowNamespace(ns string) func(attr authorizationv1.ResourceAttributes) bool {
+	return func(attr authorizationv1.ResourceAttributes) bool {
+		return attr.Namespace == ns
+	}
+}
+
+func allowAll(authorizationv1.ResourceAttributes) bool {
+	return true
+}
+
+func Test_apiServer_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		token         string
+		body          string
+		allow         func(attr authorizationv1.ResourceAttributes) bool
+		wantCode      int
+		wantBody      []string
+		wantEvents    []eventservice.ImageEvent
+		wantRestarted []string
+	}{
+		{
+			name:     "missing token",
+			method:   http.MethodGet,
+			path:     "namespaces",
+			allow:    allowAll,
+			wantCode: http.StatusUnauthorized,
+			wantBody: []string{"missing bearer token"},
+		},
+		{
+			name:     "invalid token",
+			method:   http.MethodGet,
+			path:     "namespaces",
+			token:    "expired",
+			allow:    allowAll,
+			wantCode: http.StatusUnauthorized,
+			wantBody: []string{"token expired"},
+		},
+		{
+			name:     "list namespaces",
+			method:   http.MethodGet,
+			path:     "namespaces",
+			token:    testToken,
+			allow:    allowAll,
+			wantCode: http.StatusOK,
+			wantBody: []string{`"total":2`, `"name":"dev"`, `"name":"prod"`},
+		},
+		{
+			name:     "list namespaces forbidden",
+			method:   http.MethodGet,
+			path:     "namespaces",
+			token:    testToken,
+			allow:    allowNamespace("dev"),
+			wantCode: http.StatusForbidden,
+			wantBody: []string{"user tester cannot list namespaces.laborer.io"},
+		},
+		{
+			name:     "list events",
+			method:   http.MethodGet,
+			path:     "events?offset=1&limit=1",
+			token:    testToken,
+			allow:    allowAll,
+			wantCode: http.StatusOK,
+			wantBody: []string{`"total":3`, `"offset":1`, `"limit":1`, `"id":"2"`},
+		},
+		{
+			name:     "list events with invalid limit",
+			method:   http.MethodGet,
+			path:     "events?limit=0",
+			token:    testToken,
+			allow:    allowAll,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "get event",
+			method:   http.MethodGet,
+			path:     "events/3",
+			token:    testToken,
+			allow:    allowAll,
+			wantCode: http.StatusOK,
+			wantBody: []string{`"id":"3"`},
+		},
+		{
+			name:     "get unknown event",
+			method:   http.MethodGet,
+			path:     "events/4",
+			token:    testToken,
+			allow:    allowAll,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "create image event",
+			method:   http.MethodPost,
+			path:     "namespaces/dev/imageevents",
+			token:    testToken,
+			body:     `{"image": "harbor.example.com/library/web:v2"}`,
+			allow:    allowNamespace("dev"),
+			wantCode: http.StatusAccepted,
+			wantBody: []string{"image event harbor.example.com/library/web:v2 queued"},
+			wantEvents: []eventservice.ImageEvent{
+				{Image: "harbor.example.com/library/web", Tag: "v2", Source: sourceAPI, Namespace: "dev"},
+			},
+		},
+		{
+			name:     "create image event with tag",
+			method:   http.MethodPost,
+			path:     "namespaces/dev/imageevents",
+			token:    testToken,
+			body:     `{"image": "harbor.example.com/library/web", "tag": "v3"}`,
+			allow:    allowNamespace("dev"),
+			wantCode: http.StatusAccepted,
+			wantEvents: []eventservice.ImageEvent{
+				{Image: "harbor.example.com/library/web", Tag: "v3", Source: sourceAPI, Namespace: "dev"},
+			},
+		},
+		{
+			name:     "create image event in other namespace",
+			method:   http.MethodPost,
+			path:     "namespaces/prod/imageevents",
+			token:    testToken,
+			body:     `{"image": "harbor.example.com/library/web:v2"}`,
+			allow:    allowNamespace("dev"),
+			wantCode: http.StatusForbidden,
+			wantBody: []string{"user tester cannot create imageevents.laborer.io in namespace prod"},
+		},
+		{
+			name:     "create image event without token",
+			method:   http.MethodPost,
+			path:     "namespaces/dev/imageevents",
+			body:     `{"image": "harbor.example.com/library/web:v2"}`,
+			allow:    allowAll,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "create image event without image",
+			method:   http.MethodPost,
+			path:     "namespaces/dev/imageevents",
+			token:    testToken,
+			body:     `{"tag": "v2"}`,
+			allow:    allowAll,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "create image event in unmanaged namespace",
+			method:   http.MethodPost,
+			path:     "namespaces/test/imageevents",
+			token:    testToken,
+			body:     `{"image": "harbor.example.com/library/web:v2"}`,
+			allow:    allowAll,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:          "restart configmap",
+			method:        http.MethodPost,
+			path:          "namespaces/dev/configmaps/web-config/restart",
+			token:         testToken,
+			allow:         allowNamespace("dev"),
+			wantCode:      http.StatusOK,
+			wantBody:      []string{"configmap dev.web-config restarted"},
+			wantRestarted: []string{"dev/web-config"},
+		},
+		{
+			name:     "restart configmap in other namespace",
+			method:   http.MethodPost,
+			path:     "namespaces/prod/configmaps/web-config/restart",
+			token:    testToken,
+			allow:    allowNamespace("dev"),
+			wantCode: http.StatusForbidden,
+			wantBody: []string{"user tester cannot create configmaps/restart.laborer.io in namespace prod"},
+		},
+		{
+			name:     "restart configmap in unmanaged namespace",
+			method:   http.MethodPost,
+			path:     "namespaces/test/configmaps/web-config/restart",
+			token:    testToken,
+			allow:    allowAll,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "unknown route",
+			method:   http.MethodDelete,
+			path:     "events/3",
+			token:    testToken,
+			allow:    allowAll,
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := activity.NewHistory(10)
+			for _, id := range []string{"1", "2", "3"} {
+				activity.Record(history, activity.Activity{EventID: id, Action: activity.Queued})
+			}
+			namespaces := &fakeNamespaceManager{managed: []string{"dev", "prod"}}
+			collect := &collected{}
+			handler := NewAPIServer(fakeReviewClient(tt.allow), namespaces, history, activity.NewBroadcaster(), collect)
+
+			req := httptest.NewRequest(tt.method, PathPrefix+tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantCode {
+				t.Errorf("ServeHTTP() code = %d, want %d, body: %s", recorder.Code, tt.wantCode, recorder.Body.String())
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(recorder.Body.String(), want) {
+					t.Errorf("ServeHTTP() body = %s, want contains %s", recorder.Body.String(), want)
+				}
+			}
+			// the event id is generated
+			for i := range collect.events {
+				if collect.events[i].ID == "" {
+					t.Errorf("ServeHTTP() collected event %s without id", collect.events[i])
+				}
+				collect.events[i].ID = ""
+			}
+			if !reflect.DeepEqual(collect.events, tt.wantEvents) {
+				t.Errorf("ServeHTTP() collected = %+v, want %+v", collect.events, tt.wantEvents)
+			}
+			if !reflect.DeepEqual(namespaces.restarted, tt.wantRestarted) {
+				t.Errorf("ServeHTTP() restarted = %v, want %v", namespaces.restarted, tt.wantRestarted)
+			}
+		})
+	}
+}
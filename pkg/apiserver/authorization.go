@@ -0,0 +1,119 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// apiGroup the virtual api group checked by the SubjectAccessReview
+	apiGroup = "laborer.io"
+)
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// UnauthorizedError the bearer token is missing or invalid
+type UnauthorizedError struct {
+	message string
+}
+
+func (e UnauthorizedError) Error() string {
+	return e.message
+}
+
+// ForbiddenError the user is not allowed to perform the operation
+type ForbiddenError struct {
+	user string
+	attr authorizationv1.ResourceAttributes
+}
+
+func (e ForbiddenError) Error() string {
+	resource := e.attr.Resource
+	if e.attr.Subresource != "" {
+		resource = resource + "/" + e.attr.Subresource
+	}
+	if e.attr.Namespace != "" {
+		return fmt.Sprintf("user %s cannot %s %s.%s in namespace %s", e.user, e.attr.Verb, resource, apiGroup, e.attr.Namespace)
+	}
+	return fmt.Sprintf("user %s cannot %s %s.%s", e.user, e.attr.Verb, resource, apiGroup)
+}
+
+// authorizer authenticate the bearer token with TokenReview and authorize the user with SubjectAccessReview
+type authorizer struct {
+	client kubernetes.Interface
+}
+
+func (a *authorizer) authorize(req *http.Request, attr authorizationv1.ResourceAttributes) error {
+	token := bearerToken(req)
+	if token == "" {
+		return &UnauthorizedError{message: "missing bearer token"}
+	}
+
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(req.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	if !review.Status.Authenticated {
+		return &UnauthorizedError{message: fmt.Sprintf("invalid bearer token: %s", review.Status.Error)}
+	}
+
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	attr.Group = apiGroup
+	sar, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(req.Context(), &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attr,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	if !sar.Status.Allowed {
+		return &ForbiddenError{user: user.Username, attr: attr}
+	}
+	return nil
+}
+
+func bearerToken(req *http.Request) string {
+	auth := strings.TrimSpace(req.Header.Get("Authorization"))
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,113 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/klog"
+)
+
+const (
+	watchBuffer       = 100
+	heartbeatInterval = 15 * time.Second
+)
+
+// watchFilter select the activities of the stream
+type watchFilter struct {
+	namespace string
+	image     string
+}
+
+func (f watchFilter) match(a activity.Activity) bool {
+	// activities without namespace, eg: received and queued, may affect any namespace and expose the images
+	// of the other tenants, only the watchers of all namespaces receive them
+	if f.namespace != "" && a.Namespace != f.namespace {
+		return false
+	}
+	if f.image != "" && !strings.Contains(a.Image, f.image) && !strings.Contains(a.OldImage, f.image) {
+		return false
+	}
+	return true
+}
+
+// watch stream the activities of the pipeline as Server-Sent Events
+func (a *apiServer) watch(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := watchFilter{
+		namespace: query.Get("namespace"),
+		image:     query.Get("image"),
+	}
+	if !a.authorize(w, req, authorizationv1.ResourceAttributes{Verb: "watch", Resource: "events", Namespace: filter.namespace}) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	activities, cancel := a.broadcaster.Subscribe(watchBuffer)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	klog.V(2).Infof("api watch started from %s, namespace: %s, image: %s", req.RemoteAddr, filter.namespace, filter.image)
+	defer klog.V(2).Infof("api watch stopped from %s", req.RemoteAddr)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case act, ok := <-activities:
+			if !ok {
+				return
+			}
+			if !filter.match(act) {
+				continue
+			}
+			data, err := json.Marshal(act)
+			if err != nil {
+				klog.Errorf("api watch marshal %v err: %v", act, err)
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", act.EventID, act.Action, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
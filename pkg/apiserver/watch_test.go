@@ -0,0 +1,192 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+func Test_watchFilter_match(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   watchFilter
+		activity activity.Activity
+		want     bool
+	}{
+		{
+			name:     "all namespaces",
+			filter:   watchFilter{},
+			activity: activity.Activity{Namespace: "dev", Image: "web:v2"},
+			want:     true,
+		},
+		{
+			name:     "activity without namespace to all namespaces",
+			filter:   watchFilter{},
+			activity: activity.Activity{Action: activity.Received, Image: "web:v2"},
+			want:     true,
+		},
+		{
+			name:     "same namespace",
+			filter:   watchFilter{namespace: "dev"},
+			activity: activity.Activity{Namespace: "dev", Image: "web:v2"},
+			want:     true,
+		},
+		{
+			name:     "other namespace",
+			filter:   watchFilter{namespace: "dev"},
+			activity: activity.Activity{Namespace: "prod", Image: "web:v2"},
+			want:     false,
+		},
+		{
+			name:     "activity without namespace to namespace",
+			filter:   watchFilter{namespace: "dev"},
+			activity: activity.Activity{Action: activity.Received, Image: "web:v2"},
+			want:     false,
+		},
+		{
+			name:     "image",
+			filter:   watchFilter{image: "web"},
+			activity: activity.Activity{Namespace: "dev", Image: "web:v2"},
+			want:     true,
+		},
+		{
+			name:     "old image",
+			filter:   watchFilter{image: "web:v1"},
+			activity: activity.Activity{Namespace: "dev", Image: "web:v2", OldImage: "web:v1"},
+			want:     true,
+		},
+		{
+			name:     "other image",
+			filter:   watchFilter{image: "api"},
+			activity: activity.Activity{Namespace: "dev", Image: "web:v2"},
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.match(tt.activity); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_apiServer_watch(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		allow      func(attr authorizationv1.ResourceAttributes) bool
+		activities []activity.Activity
+		wantCode   int
+		wantIDs    []string
+	}{
+		{
+			name:  "all namespaces",
+			query: "",
+			allow: allowAll,
+			activities: []activity.Activity{
+				{EventID: "1", Action: activity.Received, Image: "web:v2"},
+				{EventID: "1", Action: activity.Applied, Namespace: "dev", Image: "web:v2"},
+				{EventID: "1", Action: activity.Applied, Namespace: "prod", Image: "web:v2"},
+			},
+			wantCode: http.StatusOK,
+			wantIDs:  []string{"Received", "Applied/dev", "Applied/prod"},
+		},
+		{
+			name:  "namespace",
+			query: "?namespace=dev",
+			allow: allowNamespace("dev"),
+			activities: []activity.Activity{
+				{EventID: "1", Action: activity.Received, Image: "web:v2"},
+				{EventID: "1", Action: activity.Applied, Namespace: "prod", Image: "web:v2"},
+				{EventID: "1", Action: activity.Applied, Namespace: "dev", Image: "web:v2"},
+			},
+			wantCode: http.StatusOK,
+			wantIDs:  []string{"Applied/dev"},
+		},
+		{
+			name:     "forbidden",
+			query:    "?namespace=dev",
+			allow:    allowNamespace("prod"),
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broadcaster := activity.NewBroadcaster()
+			server := httptest.NewServer(NewAPIServer(fakeReviewClient(tt.allow), nil, nil, broadcaster, nil))
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+PathPrefix+"watch"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("watch err: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("watch code = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			// the headers are flushed after the subscription
+			for _, act := range tt.activities {
+				broadcaster.Record(act)
+			}
+			// the marker ends the stream of the test, every watcher receives it
+			broadcaster.Record(activity.Activity{EventID: "end", Action: activity.Applied, Namespace: "dev", Image: "end"})
+
+			var got []string
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if !strings.HasPrefix(line, "data: ") {
+					continue
+				}
+				var act activity.Activity
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &act); err != nil {
+					t.Fatalf("unmarshal %s err: %v", line, err)
+				}
+				if act.EventID == "end" {
+					break
+				}
+				id := string(act.Action)
+				if act.Namespace != "" {
+					id = id + "/" + act.Namespace
+				}
+				got = append(got, id)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("watch received %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
@@ -19,8 +19,19 @@ package config
 import (
 	"fmt"
 
+	"github.com/arugal/laborer/pkg/dashboard"
+	"github.com/arugal/laborer/pkg/notifier"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/service/filter"
+	"github.com/arugal/laborer/pkg/service/policy"
 	"github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/service/signature"
+	"github.com/arugal/laborer/pkg/service/vulnerability"
 	"github.com/arugal/laborer/pkg/simple/client/k8s"
+	"github.com/arugal/laborer/pkg/webhook/image/generic"
+	"github.com/arugal/laborer/pkg/webhook/image/gitlab"
+	"github.com/arugal/laborer/pkg/webhook/image/harbor"
+	"github.com/arugal/laborer/pkg/webhook/image/latesttag"
 	"github.com/spf13/viper"
 )
 
@@ -33,14 +44,38 @@ const (
 )
 
 type Config struct {
-	KubernetesOptions        *k8s.KubernetesOptions               `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty" mapstructure:"kubernetes"`
-	RepositoryServiceOptions *repository.RepositoryServiceOptions `json:"repository,omitempty" yaml:"repository,omitempty" mapstructure:"repository"`
+	KubernetesOptions        *k8s.KubernetesOptions                  `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty" mapstructure:"kubernetes"`
+	RepositoryServiceOptions *repository.RepositoryServiceOptions    `json:"repository,omitempty" yaml:"repository,omitempty" mapstructure:"repository"`
+	DashboardOptions         *dashboard.DashboardOptions             `json:"dashboard,omitempty" yaml:"dashboard,omitempty" mapstructure:"dashboard"`
+	NotifierOptions          *notifier.NotifierOptions               `json:"notification,omitempty" yaml:"notification,omitempty" mapstructure:"notification"`
+	LatestTagOptions         *latesttag.LatestTagOptions             `json:"latestTag,omitempty" yaml:"latestTag,omitempty" mapstructure:"latestTag"`
+	ImagePolicyOptions       *latesttag.ImagePolicyOptions           `json:"imagePolicy,omitempty" yaml:"imagePolicy,omitempty" mapstructure:"imagePolicy"`
+	GitLabOptions            *gitlab.GitLabOptions                   `json:"gitlab,omitempty" yaml:"gitlab,omitempty" mapstructure:"gitlab"`
+	HarborOptions            *harbor.HarborOptions                   `json:"harbor,omitempty" yaml:"harbor,omitempty" mapstructure:"harbor"`
+	VulnerabilityGateOptions *vulnerability.VulnerabilityGateOptions `json:"vulnerability,omitempty" yaml:"vulnerability,omitempty" mapstructure:"vulnerability"`
+	SignatureOptions         *signature.SignatureOptions             `json:"signature,omitempty" yaml:"signature,omitempty" mapstructure:"signature"`
+	FilterOptions            *filter.FilterOptions                   `json:"filter,omitempty" yaml:"filter,omitempty" mapstructure:"filter"`
+	ImageAliasOptions        *eventservice.ImageAliasOptions         `json:"imageAliases,omitempty" yaml:"imageAliases,omitempty" mapstructure:"imageAliases"`
+	ImageEventPolicyOptions  *policy.ImageEventPolicyOptions         `json:"imageEventPolicy,omitempty" yaml:"imageEventPolicy,omitempty" mapstructure:"imageEventPolicy"`
+	GenericWebhookOptions    *generic.GenericWebhookOptions          `json:"genericWebhook,omitempty" yaml:"genericWebhook,omitempty" mapstructure:"genericWebhook"`
 }
 
 func New() *Config {
 	return &Config{
 		KubernetesOptions:        k8s.NewKubernetesOptions(),
 		RepositoryServiceOptions: repository.NewRepositoryServiceOptions(),
+		DashboardOptions:         dashboard.NewDashboardOptions(),
+		NotifierOptions:          notifier.NewNotifierOptions(),
+		LatestTagOptions:         latesttag.NewLatestTagOptions(),
+		ImagePolicyOptions:       latesttag.NewImagePolicyOptions(),
+		GitLabOptions:            gitlab.NewGitLabOptions(),
+		HarborOptions:            harbor.NewHarborOptions(),
+		VulnerabilityGateOptions: vulnerability.NewVulnerabilityGateOptions(),
+		SignatureOptions:         signature.NewSignatureOptions(),
+		FilterOptions:            filter.NewFilterOptions(),
+		ImageAliasOptions:        eventservice.NewImageAliasOptions(),
+		ImageEventPolicyOptions:  policy.NewImageEventPolicyOptions(),
+		GenericWebhookOptions:    generic.NewGenericWebhookOptions(),
 	}
 }
 
@@ -17,8 +17,13 @@
 package namespace
 
 import (
+	"fmt"
+
 	"github.com/arugal/laborer/pkg/informers"
+	"github.com/arugal/laborer/pkg/service/activity"
 	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/service/policy"
+	"github.com/arugal/laborer/pkg/service/signature"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -35,12 +40,48 @@ func RegisterNewControllerFunc(newFunc NewControllerFunc) {
 type Controller interface {
 	// return the namespace of the current controller
 	Namespace() string
+	// return the name of the current controller, eg: deployment
+	Name() string
 	Run()
 	Stop()
 	ProcessImageEvent(event eventservice.ImageEvent)
 }
 
-type NewControllerFunc func(namespace string, k8sClient kubernetes.Interface, namespaceInformerFactory informers.InformerFactory) Controller
+// ConfigMapRestarter restart the deployments associated with the configmap
+type ConfigMapRestarter interface {
+	RestartConfigMap(name string) error
+}
+
+// ConfigMapAssociator return the deployments associated with each configmap
+type ConfigMapAssociator interface {
+	ConfigMapAssociations() map[string][]string
+}
+
+// ControllerContext the dependencies shared by all controllers of a namespace
+type ControllerContext struct {
+	Namespace                string
+	K8sClient                kubernetes.Interface
+	NamespaceInformerFactory informers.InformerFactory
+	Recorder                 activity.Recorder
+	// Verifier verify the signatures of the new images, nil if the verification is disabled
+	Verifier signature.Verifier
+	// Aliases the images of the events and the workloads are compared after the aliases are replaced
+	Aliases *eventservice.ImageAliases
+	// Policy which image events may update the workloads of the namespace, nil allows every event
+	Policy policy.Authorizer
+}
+
+type NewControllerFunc func(ctrlCtx *ControllerContext) Controller
+
+// NotSupportError none of the controllers in the namespace supports the operation
+type NotSupportError struct {
+	namespace string
+	operation string
+}
+
+func (e NotSupportError) Error() string {
+	return fmt.Sprintf("namespace %s does not support %s", e.namespace, e.operation)
+}
 
 // BaseController empty implementation
 type BaseController struct {
@@ -59,7 +100,6 @@ func (b BaseController) ProcessImageEvent(eventservice.ImageEvent) {
 type aggregationController struct {
 	BaseController
 
-	k8sClient                kubernetes.Interface
 	namespaceInformerFactory informers.InformerFactory
 
 	controllers []Controller
@@ -67,23 +107,36 @@ type aggregationController struct {
 	stopCh chan struct{}
 }
 
-func NewAggregationController(namespace string, k8sClient kubernetes.Interface) Controller {
+func NewAggregationController(namespace string, k8sClient kubernetes.Interface, recorder activity.Recorder,
+	verifier signature.Verifier, aliases *eventservice.ImageAliases, authorizer policy.Authorizer) Controller {
 	c := &aggregationController{
 		BaseController: BaseController{
 			NameSpace: namespace,
 		},
-		k8sClient:                k8sClient,
 		namespaceInformerFactory: informers.NewWithNamespaceInformerFactories(k8sClient, namespace),
 		stopCh:                   make(chan struct{}),
 	}
 
+	ctrlCtx := &ControllerContext{
+		Namespace:                namespace,
+		K8sClient:                k8sClient,
+		NamespaceInformerFactory: c.namespaceInformerFactory,
+		Recorder:                 recorder,
+		Verifier:                 verifier,
+		Aliases:                  aliases,
+		Policy:                   authorizer,
+	}
 	for _, newFunc := range newControllerFuncs {
-		c.controllers = append(c.controllers, newFunc(namespace, k8sClient, c.namespaceInformerFactory))
+		c.controllers = append(c.controllers, newFunc(ctrlCtx))
 	}
 
 	return c
 }
 
+func (a *aggregationController) Name() string {
+	return "aggregation"
+}
+
 func (a *aggregationController) Run() {
 	a.namespaceInformerFactory.Start(a.stopCh)
 
@@ -104,3 +157,29 @@ func (a *aggregationController) ProcessImageEvent(event eventservice.ImageEvent)
 		c.ProcessImageEvent(event)
 	}
 }
+
+func (a *aggregationController) RestartConfigMap(name string) error {
+	for _, c := range a.controllers {
+		if restarter, ok := c.(ConfigMapRestarter); ok {
+			return restarter.RestartConfigMap(name)
+		}
+	}
+	return &NotSupportError{namespace: a.NameSpace, operation: "configmap restart"}
+}
+
+func (a *aggregationController) ConfigMapAssociations() map[string][]string {
+	for _, c := range a.controllers {
+		if associator, ok := c.(ConfigMapAssociator); ok {
+			return associator.ConfigMapAssociations()
+		}
+	}
+	return nil
+}
+
+// controllerNames return the names of the sub controllers
+func (a *aggregationController) controllerNames() (names []string) {
+	for _, c := range a.controllers {
+		names = append(names, c.Name())
+	}
+	return names
+}
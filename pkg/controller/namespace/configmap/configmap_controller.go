@@ -20,18 +20,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	k8sv1 "github.com/arugal/laborer/pkg/api/k8s/v1"
 	"github.com/arugal/laborer/pkg/controller/namespace"
-	"github.com/arugal/laborer/pkg/informers"
+	"github.com/arugal/laborer/pkg/service/activity"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/client-go/kubernetes"
+	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	listerappsv1 "k8s.io/client-go/listers/apps/v1"
+	listercorev1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
 )
@@ -42,6 +46,9 @@ const (
 	restartedAt = "kubectl.kubernetes.io/restartedAt"
 
 	annotationName = "laborer.configmap.associate.deployment"
+
+	sourceInformer = "configmap"
+	sourceManual   = "api"
 )
 
 func init() {
@@ -54,13 +61,30 @@ type configmapController struct {
 
 	stopCh                  chan struct{}
 	configmapInformerSynced cache.InformerSynced
+
+	configmapLister   listercorev1.ConfigMapLister
+	deploymentsLister listerappsv1.DeploymentLister
+	deploymentsClient appsv1.DeploymentInterface
+
+	recorder activity.Recorder
 }
 
 // newConfigmapControllerFunc
 func newConfigmapControllerFunc() namespace.NewControllerFunc {
-	return func(ns string, k8sClient kubernetes.Interface, namespaceInformerFactory informers.InformerFactory) namespace.Controller {
-		deploymentsLister := namespaceInformerFactory.KubernetesSharedInformerFactory().Apps().V1().Deployments().Lister()
-		deploymentsClient := k8sClient.AppsV1().Deployments(ns)
+	return func(ctrlCtx *namespace.ControllerContext) namespace.Controller {
+		ns := ctrlCtx.Namespace
+		informerFactory := ctrlCtx.NamespaceInformerFactory.KubernetesSharedInformerFactory()
+
+		c := &configmapController{
+			BaseController: namespace.BaseController{
+				NameSpace: ns,
+			},
+			stopCh:            make(chan struct{}),
+			configmapLister:   informerFactory.Core().V1().ConfigMaps().Lister(),
+			deploymentsLister: informerFactory.Apps().V1().Deployments().Lister(),
+			deploymentsClient: ctrlCtx.K8sClient.AppsV1().Deployments(ns),
+			recorder:          ctrlCtx.Recorder,
+		}
 
 		handlerFunc := cache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
@@ -80,40 +104,7 @@ func newConfigmapControllerFunc() namespace.NewControllerFunc {
 				}
 
 				klog.V(2).Infof("configmap update: %s.%s", ns, newConfigmap.Name)
-				needRestartDeployments := analyzeDeployments(newConfigmap)
-
-				for _, deploymentName := range needRestartDeployments {
-					deploy, err := deploymentsLister.Deployments(ns).Get(deploymentName)
-					if err != nil || deploy == nil {
-						if !errors.IsNotFound(err) {
-							klog.Errorf("[%s] get deployment [%s] err: %v", ns, deploymentName, err)
-						}
-						continue
-					}
-
-					newDeployment := k8sv1.Deployment{
-						Spec: k8sv1.DeploymentSpec{
-							Template: k8sv1.PodTemplateSpec{
-								Metadata: k8sv1.Metadata{
-									Annotations: map[string]string{
-										restartedAt: time.Now().Format(time.RFC3339),
-									},
-								},
-							},
-						},
-					}
-
-					data, err := json.Marshal(newDeployment)
-					if err != nil {
-						klog.Errorf("configmap [%s] controller marshal %v err: %s", ns, newDeployment, err)
-						return
-					}
-
-					klog.Infof("configmap trigger %s.%s restarted", newConfigmap.Namespace, deploymentName)
-					if _, err = deploymentsClient.Patch(context.Background(), deploymentName, types.StrategicMergePatchType, data, metav1.PatchOptions{}); err != nil {
-						klog.Errorf("configmap [%s] controller patch %v err: %s", ns, string(data), err)
-					}
-				}
+				c.restartDeployments(newConfigmap, sourceInformer)
 			},
 			DeleteFunc: func(obj interface{}) {
 				if klog.V(2) {
@@ -123,16 +114,99 @@ func newConfigmapControllerFunc() namespace.NewControllerFunc {
 			},
 		}
 
-		informer := namespaceInformerFactory.KubernetesSharedInformerFactory().Core().V1().ConfigMaps().Informer()
+		informer := informerFactory.Core().V1().ConfigMaps().Informer()
 		informer.AddEventHandler(handlerFunc)
+		c.configmapInformerSynced = informer.HasSynced
 
-		return &configmapController{
-			BaseController: namespace.BaseController{
-				NameSpace: ns,
+		return c
+	}
+}
+
+func (c *configmapController) Name() string {
+	return "configmap"
+}
+
+// RestartConfigMap restart the deployments associated with the configmap on demand
+func (c *configmapController) RestartConfigMap(name string) error {
+	configmap, err := c.configmapLister.ConfigMaps(c.NameSpace).Get(name)
+	if err != nil {
+		return err
+	}
+	c.restartDeployments(configmap, sourceManual)
+	return nil
+}
+
+// ConfigMapAssociations return the deployments associated with each configmap, see analyzeDeployments
+func (c *configmapController) ConfigMapAssociations() map[string][]string {
+	configmaps, err := c.configmapLister.ConfigMaps(c.NameSpace).List(labels.Everything())
+	if err != nil {
+		klog.Errorf("[%s] list configmap err: %v", c.NameSpace, err)
+		return nil
+	}
+
+	associations := map[string][]string{}
+	for _, configmap := range configmaps {
+		deployments := analyzeDeployments(configmap)
+		if len(deployments) == 0 {
+			continue
+		}
+		sort.Strings(deployments)
+		associations[configmap.Name] = deployments
+	}
+	return associations
+}
+
+// restartDeployments restart the deployments associated with the configmap
+func (c *configmapController) restartDeployments(configmap *v1.ConfigMap, source string) {
+	ns := c.NameSpace
+	eventID := activity.NewEventID()
+	needRestartDeployments := analyzeDeployments(configmap)
+
+	for _, deploymentName := range needRestartDeployments {
+		deploy, err := c.deploymentsLister.Deployments(ns).Get(deploymentName)
+		if err != nil || deploy == nil {
+			if !errors.IsNotFound(err) {
+				klog.Errorf("[%s] get deployment [%s] err: %v", ns, deploymentName, err)
+			}
+			continue
+		}
+
+		newDeployment := k8sv1.Deployment{
+			Spec: k8sv1.DeploymentSpec{
+				Template: k8sv1.PodTemplateSpec{
+					Metadata: k8sv1.Metadata{
+						Annotations: map[string]string{
+							restartedAt: time.Now().Format(time.RFC3339),
+						},
+					},
+				},
 			},
-			stopCh:                  make(chan struct{}),
-			configmapInformerSynced: informer.HasSynced,
 		}
+
+		data, err := json.Marshal(newDeployment)
+		if err != nil {
+			klog.Errorf("configmap [%s] controller marshal %v err: %s", ns, newDeployment, err)
+			return
+		}
+
+		a := activity.Activity{
+			EventID:   eventID,
+			Action:    activity.Restarted,
+			Source:    source,
+			Namespace: ns,
+			Kind:      "Deployment",
+			Name:      deploymentName,
+			ConfigMap: configmap.Name,
+			Message:   fmt.Sprintf("configmap %s changed", configmap.Name),
+		}
+
+		klog.Infof("configmap trigger %s.%s restarted", configmap.Namespace, deploymentName)
+		if _, err = c.deploymentsClient.Patch(context.Background(), deploymentName, types.StrategicMergePatchType, data, metav1.PatchOptions{}); err != nil {
+			klog.Errorf("configmap [%s] controller patch %v err: %s", ns, string(data), err)
+			a.Action = activity.Failed
+			a.Message = err.Error()
+		}
+		activity.Record(c.recorder, a)
 	}
 }
 
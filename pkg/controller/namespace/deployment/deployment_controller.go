@@ -24,8 +24,11 @@ import (
 	k8sv1 "github.com/arugal/laborer/pkg/api/k8s/v1"
 	"github.com/arugal/laborer/pkg/controller/namespace"
 	"github.com/arugal/laborer/pkg/crash"
-	"github.com/arugal/laborer/pkg/informers"
+	"github.com/arugal/laborer/pkg/service/activity"
 	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/service/policy"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/service/signature"
 	apiappsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -52,12 +55,21 @@ type deploymentController struct {
 	deploymentLister         v1.DeploymentLister
 
 	deploymentsClient appsv1.DeploymentInterface
+	replicaSetsClient appsv1.ReplicaSetInterface
+	// client 读取 deployment 的 imagePullSecrets
+	client kubernetes.Interface
+
+	recorder activity.Recorder
+	verifier signature.Verifier
+	aliases  *eventservice.ImageAliases
+	policy   policy.Authorizer
 }
 
 // newDeploymentControllerFunc 创建 deployment 控制器
-func newDeploymentControllerFunc(ns string, k8sClient kubernetes.Interface, namespaceInformerFactory informers.InformerFactory) namespace.Controller {
-	deploymentLister := namespaceInformerFactory.KubernetesSharedInformerFactory().Apps().V1().Deployments().Lister()
-	deploymentInformer := namespaceInformerFactory.KubernetesSharedInformerFactory().Apps().V1().Deployments().Informer()
+func newDeploymentControllerFunc(ctrlCtx *namespace.ControllerContext) namespace.Controller {
+	ns := ctrlCtx.Namespace
+	deploymentLister := ctrlCtx.NamespaceInformerFactory.KubernetesSharedInformerFactory().Apps().V1().Deployments().Lister()
+	deploymentInformer := ctrlCtx.NamespaceInformerFactory.KubernetesSharedInformerFactory().Apps().V1().Deployments().Informer()
 
 	deploymentInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -82,7 +94,7 @@ func newDeploymentControllerFunc(ns string, k8sClient kubernetes.Interface, name
 		},
 	})
 
-	deploymentsClient := k8sClient.AppsV1().Deployments(ns)
+	deploymentsClient := ctrlCtx.K8sClient.AppsV1().Deployments(ns)
 
 	return &deploymentController{
 		BaseController: namespace.BaseController{
@@ -92,9 +104,19 @@ func newDeploymentControllerFunc(ns string, k8sClient kubernetes.Interface, name
 		deploymentInformerSynced: deploymentInformer.HasSynced,
 		deploymentLister:         deploymentLister,
 		deploymentsClient:        deploymentsClient,
+		replicaSetsClient:        ctrlCtx.K8sClient.AppsV1().ReplicaSets(ns),
+		client:                   ctrlCtx.K8sClient,
+		recorder:                 ctrlCtx.Recorder,
+		verifier:                 ctrlCtx.Verifier,
+		aliases:                  ctrlCtx.Aliases,
+		policy:                   ctrlCtx.Policy,
 	}
 }
 
+func (d *deploymentController) Name() string {
+	return "deployment"
+}
+
 func (d *deploymentController) Run() {
 	defer crash.HandleCrash()
 	klog.Infof("Starting deployment controller from namespace: %s", d.NameSpace)
@@ -113,26 +135,69 @@ func (d *deploymentController) Stop() {
 func (d *deploymentController) ProcessImageEvent(event eventservice.ImageEvent) {
 	defer crash.HandleCrash(crash.DefaultHandler)
 
+	switch {
+	case event.IsPush():
+		d.processPushEvent(event)
+	case event.Type == eventservice.DeleteEvent:
+		d.processDeleteEvent(event)
+	}
+}
+
+// processPushEvent 更新使用同一镜像不同 tag 的容器
+func (d *deploymentController) processPushEvent(event eventservice.ImageEvent) {
 	deployments, err := d.deploymentLister.List(labels.Everything())
 	if err != nil {
 		klog.Errorf("[%s] list deployment err: %v", d.Namespace(), err)
 		return
 	}
 
+	// verified 同一事件中通过签名校验的新镜像 -> digest
+	verified := map[string]string{}
 	for _, deployment := range deployments {
-		var updateContainers []k8sv1.Container
-
+		var matchedContainers []k8sv1.Container
 		for _, container := range deployment.Spec.Template.Spec.Containers {
 			containerImage := eventservice.OfImageEvent(container.Image)
-			if containerImage.Image == event.Image && containerImage.Tag != event.Tag {
-				updateContainers = append(updateContainers, k8sv1.Container{
+			// 补全并替换别名之后再比较, nginx 与 docker.io/library/nginx 是同一个镜像, 更新时保持工作负载原有的写法,
+			// 只以 digest 固定的镜像 (repo@sha256:...) 不更新
+			if d.aliases.SameImage(containerImage.Image, event.Image) && containerImage.Tag != "" && containerImage.Tag != event.Tag {
+				matchedContainers = append(matchedContainers, k8sv1.Container{
 					Name:  container.Name,
-					Image: event.String(),
+					Image: container.Image,
 				})
 			}
 		}
+		if len(matchedContainers) == 0 || !d.authorized(event, deployment.Name) {
+			continue
+		}
+		var keychain repositoryservice.Keychain
+		if d.verifier != nil {
+			keychain = repositoryservice.PullSecretsKeychain(context.Background(), d.client, d.NameSpace, &deployment.Spec.Template.Spec)
+		}
+
+		var updateContainers []k8sv1.Container
+		var oldImages []string
+		for _, container := range matchedContainers {
+			newContainer := k8sv1.Container{
+				Name:  container.Name,
+				Image: fmt.Sprintf("%s:%s", eventservice.OfImageEvent(container.Image).Image, event.Tag),
+			}
+			digest, err := d.verify(verified, newContainer.Image, event.Digest, keychain)
+			if err != nil {
+				klog.Warningf("deployment [%s] controller refuse %s of %s: %v", d.NameSpace, newContainer.Image, deployment.Name, err)
+				d.recordContainers(event, activity.Unverified, deployment.Name, []k8sv1.Container{newContainer}, []string{container.Image}, err.Error())
+				continue
+			}
+			if digest != "" {
+				// 固定为通过校验的 digest, 校验之后重新 push 的 tag 不会被使用
+				newContainer.Image = eventservice.PinDigest(newContainer.Image, digest)
+			}
+			updateContainers = append(updateContainers, newContainer)
+			oldImages = append(oldImages, container.Image)
+		}
 
 		if len(updateContainers) > 0 {
+			d.recordContainers(event, activity.Matched, deployment.Name, updateContainers, oldImages, "")
+
 			newDeployment := k8sv1.Deployment{
 				Spec: k8sv1.DeploymentSpec{
 					Template: k8sv1.PodTemplateSpec{
@@ -142,6 +207,13 @@ func (d *deploymentController) ProcessImageEvent(event eventservice.ImageEvent)
 					},
 				},
 			}
+			// 更新后的容器不再使用被删除的镜像
+			if deleted := parseDeletedImages(deployment.Annotations[imageDeletedAnnotation]); len(deleted) > 0 {
+				for _, container := range updateContainers {
+					delete(deleted, container.Name)
+				}
+				newDeployment.Metadata = deletedImagesMetadata(deleted)
+			}
 
 			data, err := json.Marshal(newDeployment)
 			if err != nil {
@@ -150,9 +222,64 @@ func (d *deploymentController) ProcessImageEvent(event eventservice.ImageEvent)
 			}
 
 			klog.Infof("image event trigger %s.%s update, new image: %s", deployment.Namespace, deployment.Name, event)
-			if _, err = d.deploymentsClient.Patch(context.Background(), deployment.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{}); err != nil {
+			_, err = d.deploymentsClient.Patch(context.Background(), deployment.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{})
+			if err != nil {
 				klog.Errorf("deployment [%s] controller patch %v err: %s", d.NameSpace, string(data), err)
+				d.recordContainers(event, activity.Failed, deployment.Name, updateContainers, oldImages, err.Error())
+			} else {
+				d.recordContainers(event, activity.Applied, deployment.Name, updateContainers, oldImages, "")
 			}
 		}
 	}
 }
+
+// authorized 事件能否更新当前 namespace 中的 deployment, 不允许时记录日志
+func (d *deploymentController) authorized(event eventservice.ImageEvent, name string) bool {
+	if d.policy == nil {
+		return true
+	}
+	allowed, reason := d.policy.Authorize(d.NameSpace, event)
+	if !allowed {
+		klog.Warningf("image event %s from %s denied to update %s.%s: %s", event, event.Source, d.NameSpace, name, reason)
+	}
+	return allowed
+}
+
+// verify 使用 deployment 的凭证校验新镜像的签名并返回通过校验的 digest, 未开启签名校验或 namespace 未配置公钥时返回空,
+// 事件带有 digest 时校验该 digest 而不是 tag 当前的 digest. 只缓存通过的结果, 未通过可能是因为当前 deployment 的凭证无法读取签名
+func (d *deploymentController) verify(verified map[string]string, image, digest string, keychain repositoryservice.Keychain) (string, error) {
+	if d.verifier == nil {
+		return "", nil
+	}
+	if digest != "" {
+		image = eventservice.PinDigest(image, digest)
+	}
+	if verifiedDigest, ok := verified[image]; ok {
+		return verifiedDigest, nil
+	}
+	verifiedDigest, err := d.verifier.Verify(context.Background(), d.NameSpace, image, keychain)
+	if err != nil {
+		return "", err
+	}
+	verified[image] = verifiedDigest
+	return verifiedDigest, nil
+}
+
+// recordContainers record the action for every updated container
+func (d *deploymentController) recordContainers(event eventservice.ImageEvent, action activity.Action, name string,
+	containers []k8sv1.Container, oldImages []string, message string) {
+	for i, container := range containers {
+		activity.Record(d.recorder, activity.Activity{
+			EventID:   event.ID,
+			Action:    action,
+			Source:    event.Source,
+			Namespace: d.NameSpace,
+			Kind:      "Deployment",
+			Name:      name,
+			Container: container.Name,
+			Image:     container.Image,
+			OldImage:  oldImages[i],
+			Message:   message,
+		})
+	}
+}
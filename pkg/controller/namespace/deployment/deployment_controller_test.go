@@ -0,0 +1,274 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/arugal/laborer/pkg/controller/namespace"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/service/policy"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/service/signature"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testNamespace = "test"
+
+func newDeployment(image string, annotations map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: testNamespace, UID: "web-uid", Annotations: annotations},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "web", Image: image}},
+				},
+			},
+		},
+	}
+}
+
+func newReplicaSet(deployment *appsv1.Deployment, revision, image string) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-" + revision,
+			Namespace:       testNamespace,
+			Labels:          map[string]string{"app": "web"},
+			Annotations:     map[string]string{revisionAnnotation: revision},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "web", Image: image}},
+				},
+			},
+		},
+	}
+}
+
+// verifiedDigest the digest of the tags which pass the fake verification
+const verifiedDigest = "sha256:5ca1ab1e"
+
+// fakeVerifier image -> error of the verification, the pinned digest or verifiedDigest is returned when passed
+type fakeVerifier map[string]error
+
+func (f fakeVerifier) Verify(ctx context.Context, namespace, image string, keychain repositoryservice.Keychain) (string, error) {
+	if err := f[image]; err != nil {
+		return "", err
+	}
+	if digest := eventservice.OfImageEvent(image).Digest; digest != "" {
+		return digest, nil
+	}
+	return verifiedDigest, nil
+}
+
+// fakeAuthorizer namespace -> whether image events are allowed
+type fakeAuthorizer map[string]bool
+
+func (f fakeAuthorizer) Authorize(namespace string, event eventservice.ImageEvent) (bool, string) {
+	return f[namespace], "fake"
+}
+
+func Test_deploymentController_ProcessImageEvent(t *testing.T) {
+	deleted := eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v2", Type: eventservice.DeleteEvent}
+	rollback := map[string]string{rollbackAnnotation: rollbackEnabled}
+	pushAliases := eventservice.NewImageAliases(&eventservice.ImageAliasOptions{Aliases: []eventservice.ImageAlias{
+		{Prefix: "registry.example.com", Aliases: []string{"harbor.build.internal"}},
+	}})
+
+	tests := []struct {
+		name            string
+		deployment      *appsv1.Deployment
+		replicaSets     func(deployment *appsv1.Deployment) []runtime.Object
+		event           eventservice.ImageEvent
+		verifier        signature.Verifier
+		aliases         *eventservice.ImageAliases
+		policy          policy.Authorizer
+		wantImage       string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:            "flag deleted image",
+			deployment:      newDeployment("harbor.example.com/library/web:v2", nil),
+			event:           deleted,
+			wantImage:       "harbor.example.com/library/web:v2",
+			wantAnnotations: map[string]string{imageDeletedAnnotation: "web=harbor.example.com/library/web:v2"},
+		},
+		{
+			name:       "rollback to previous revision",
+			deployment: newDeployment("harbor.example.com/library/web:v2", rollback),
+			replicaSets: func(deployment *appsv1.Deployment) []runtime.Object {
+				return []runtime.Object{
+					newReplicaSet(deployment, "1", "harbor.example.com/library/web:v0"),
+					newReplicaSet(deployment, "2", "harbor.example.com/library/web:v1"),
+					newReplicaSet(deployment, "3", "harbor.example.com/library/web:v2"),
+				}
+			},
+			event:           deleted,
+			wantImage:       "harbor.example.com/library/web:v1",
+			wantAnnotations: rollback,
+		},
+		{
+			name:            "flag when no previous revision",
+			deployment:      newDeployment("harbor.example.com/library/web:v2", rollback),
+			event:           deleted,
+			wantImage:       "harbor.example.com/library/web:v2",
+			wantAnnotations: map[string]string{rollbackAnnotation: rollbackEnabled, imageDeletedAnnotation: "web=harbor.example.com/library/web:v2"},
+		},
+		{
+			name:       "other tag deleted",
+			deployment: newDeployment("harbor.example.com/library/web:v3", nil),
+			event:      deleted,
+			wantImage:  "harbor.example.com/library/web:v3",
+		},
+		{
+			name: "push clears the flag",
+			deployment: newDeployment("harbor.example.com/library/web:v2",
+				map[string]string{imageDeletedAnnotation: "web=harbor.example.com/library/web:v2"}),
+			event:     eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3"},
+			wantImage: "harbor.example.com/library/web:v3",
+		},
+		{
+			name:       "push keeps the spelling of the workload",
+			deployment: newDeployment("nginx:1.19", nil),
+			event:      eventservice.ImageEvent{Image: "docker.io/library/nginx", Tag: "1.20"},
+			wantImage:  "nginx:1.20",
+		},
+		{
+			name:       "scan event is ignored",
+			deployment: newDeployment("harbor.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3", Type: eventservice.ScanEvent},
+			wantImage:  "harbor.example.com/library/web:v2",
+		},
+		{
+			name:       "push from the alias keeps the spelling of the workload",
+			deployment: newDeployment("registry.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.build.internal/library/web", Tag: "v3"},
+			aliases:    pushAliases,
+			wantImage:  "registry.example.com/library/web:v3",
+		},
+		{
+			name:       "push from other host",
+			deployment: newDeployment("registry.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.build.internal/library/web", Tag: "v3"},
+			wantImage:  "registry.example.com/library/web:v2",
+		},
+		{
+			name:       "push verified image",
+			deployment: newDeployment("harbor.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3"},
+			verifier:   fakeVerifier{"harbor.example.com/library/web:v4": errors.New("not signed")},
+			wantImage:  "harbor.example.com/library/web:v3@" + verifiedDigest,
+		},
+		{
+			name:       "push verifies the digest of the event",
+			deployment: newDeployment("harbor.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3", Digest: "sha256:65ff"},
+			verifier:   fakeVerifier{"harbor.example.com/library/web:v3": errors.New("re-pushed")},
+			wantImage:  "harbor.example.com/library/web:v3@sha256:65ff",
+		},
+		{
+			name:       "push updates the pinned image",
+			deployment: newDeployment("harbor.example.com/library/web:v2@sha256:0a1b", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3"},
+			wantImage:  "harbor.example.com/library/web:v3",
+		},
+		{
+			name:       "push keeps the image pinned by digest only",
+			deployment: newDeployment("harbor.example.com/library/web@sha256:0a1b", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3"},
+			wantImage:  "harbor.example.com/library/web@sha256:0a1b",
+		},
+		{
+			name:       "push unverified image is refused",
+			deployment: newDeployment("harbor.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3"},
+			verifier:   fakeVerifier{"harbor.example.com/library/web:v3": errors.New("not signed")},
+			wantImage:  "harbor.example.com/library/web:v2",
+		},
+		{
+			name:       "push authorized image",
+			deployment: newDeployment("harbor.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3"},
+			policy:     fakeAuthorizer{testNamespace: true},
+			wantImage:  "harbor.example.com/library/web:v3",
+		},
+		{
+			name:       "push unauthorized image is denied",
+			deployment: newDeployment("harbor.example.com/library/web:v2", nil),
+			event:      eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v3"},
+			policy:     fakeAuthorizer{},
+			wantImage:  "harbor.example.com/library/web:v2",
+		},
+		{
+			name:       "unauthorized delete is ignored",
+			deployment: newDeployment("harbor.example.com/library/web:v2", nil),
+			event:      deleted,
+			policy:     fakeAuthorizer{},
+			wantImage:  "harbor.example.com/library/web:v2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{tt.deployment}
+			if tt.replicaSets != nil {
+				objects = append(objects, tt.replicaSets(tt.deployment)...)
+			}
+			client := fake.NewSimpleClientset(objects...)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			_ = indexer.Add(tt.deployment)
+
+			d := &deploymentController{
+				BaseController:    namespace.BaseController{NameSpace: testNamespace},
+				deploymentLister:  v1.NewDeploymentLister(indexer),
+				deploymentsClient: client.AppsV1().Deployments(testNamespace),
+				replicaSetsClient: client.AppsV1().ReplicaSets(testNamespace),
+				client:            client,
+				verifier:          tt.verifier,
+				aliases:           tt.aliases,
+				policy:            tt.policy,
+			}
+			d.ProcessImageEvent(tt.event)
+
+			got, err := client.AppsV1().Deployments(testNamespace).Get(context.Background(), "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get deployment err: %v", err)
+			}
+			if image := got.Spec.Template.Spec.Containers[0].Image; image != tt.wantImage {
+				t.Errorf("ProcessImageEvent() image = %v, want %v", image, tt.wantImage)
+			}
+			if len(got.Annotations) != len(tt.wantAnnotations) {
+				t.Errorf("ProcessImageEvent() annotations = %v, want %v", got.Annotations, tt.wantAnnotations)
+			}
+			for key, value := range tt.wantAnnotations {
+				if got.Annotations[key] != value {
+					t.Errorf("ProcessImageEvent() annotations = %v, want %v", got.Annotations, tt.wantAnnotations)
+				}
+			}
+		})
+	}
+}
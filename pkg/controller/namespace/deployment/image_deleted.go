@@ -0,0 +1,199 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	k8sv1 "github.com/arugal/laborer/pkg/api/k8s/v1"
+	"github.com/arugal/laborer/pkg/service/activity"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	apiappsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+const (
+	// imageDeletedAnnotation 容器仍在使用的已被删除的镜像, 格式为 <container>=<image>,<container>=<image>
+	imageDeletedAnnotation = "laborer.image-deleted"
+	// rollbackAnnotation 为 true 时, 镜像被删除后回滚至容器之前的镜像
+	rollbackAnnotation = "laborer.image-deleted.rollback"
+	rollbackEnabled    = "true"
+
+	// revisionAnnotation deployment 控制器记录在 replicaset 上的版本号
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+
+	imageDeletedMessage = "the image has been deleted from the repository"
+)
+
+// processDeleteEvent 标记仍在使用被删除镜像的 deployment, 开启回滚时回滚至之前的镜像, 避免重新调度时拉取镜像失败
+func (d *deploymentController) processDeleteEvent(event eventservice.ImageEvent) {
+	deployments, err := d.deploymentLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("[%s] list deployment err: %v", d.Namespace(), err)
+		return
+	}
+
+	for _, deployment := range deployments {
+		var deletedContainers []k8sv1.Container
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			if sameImageTag(d.aliases, container.Image, event.String()) {
+				deletedContainers = append(deletedContainers, k8sv1.Container{
+					Name:  container.Name,
+					Image: container.Image,
+				})
+			}
+		}
+		if len(deletedContainers) == 0 || !d.authorized(event, deployment.Name) {
+			continue
+		}
+
+		var previous map[string]string
+		if deployment.Annotations[rollbackAnnotation] == rollbackEnabled {
+			previous = d.previousImages(deployment, deletedContainers)
+		}
+
+		deleted := parseDeletedImages(deployment.Annotations[imageDeletedAnnotation])
+		var flaggedContainers, rollbackContainers []k8sv1.Container
+		var oldImages []string
+		for _, container := range deletedContainers {
+			if image, ok := previous[container.Name]; ok {
+				delete(deleted, container.Name)
+				rollbackContainers = append(rollbackContainers, k8sv1.Container{
+					Name:  container.Name,
+					Image: image,
+				})
+				oldImages = append(oldImages, container.Image)
+			} else {
+				deleted[container.Name] = container.Image
+				flaggedContainers = append(flaggedContainers, container)
+			}
+		}
+
+		newDeployment := k8sv1.Deployment{
+			Metadata: deletedImagesMetadata(deleted),
+			Spec: k8sv1.DeploymentSpec{
+				Template: k8sv1.PodTemplateSpec{
+					Spec: k8sv1.PodSpec{
+						Containers: rollbackContainers,
+					},
+				},
+			},
+		}
+
+		data, err := json.Marshal(newDeployment)
+		if err != nil {
+			klog.Errorf("deployment [%s] controller marshal %v err: %s", d.NameSpace, newDeployment, err)
+			return
+		}
+
+		klog.Infof("image %s deleted, flag %s.%s, rollback containers: %v", event, deployment.Namespace, deployment.Name, rollbackContainers)
+		_, err = d.deploymentsClient.Patch(context.Background(), deployment.Name, types.StrategicMergePatchType, data, metav1.PatchOptions{})
+		if err != nil {
+			klog.Errorf("deployment [%s] controller patch %v err: %s", d.NameSpace, string(data), err)
+			d.recordContainers(event, activity.Failed, deployment.Name, deletedContainers, make([]string, len(deletedContainers)), err.Error())
+			continue
+		}
+		d.recordContainers(event, activity.Flagged, deployment.Name, flaggedContainers, make([]string, len(flaggedContainers)), imageDeletedMessage)
+		d.recordContainers(event, activity.RolledBack, deployment.Name, rollbackContainers, oldImages, imageDeletedMessage)
+	}
+}
+
+// previousImages 按版本从新到旧查找 deployment 的 replicaset, 返回容器在使用被删除的镜像之前的镜像
+func (d *deploymentController) previousImages(deployment *apiappsv1.Deployment, containers []k8sv1.Container) map[string]string {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		klog.Errorf("[%s] deployment %s has invalid selector: %v", d.NameSpace, deployment.Name, err)
+		return nil
+	}
+	replicaSets, err := d.replicaSetsClient.List(context.Background(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		klog.Errorf("[%s] list replicaset of deployment %s err: %v", d.NameSpace, deployment.Name, err)
+		return nil
+	}
+
+	var owned []apiappsv1.ReplicaSet
+	for _, replicaSet := range replicaSets.Items {
+		if metav1.IsControlledBy(&replicaSet, deployment) {
+			owned = append(owned, replicaSet)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return revision(&owned[i]) > revision(&owned[j])
+	})
+
+	previous := map[string]string{}
+	for _, container := range containers {
+	replicaSets:
+		for _, replicaSet := range owned {
+			for _, c := range replicaSet.Spec.Template.Spec.Containers {
+				if c.Name == container.Name && !sameImageTag(d.aliases, c.Image, container.Image) {
+					previous[container.Name] = c.Image
+					break replicaSets
+				}
+			}
+		}
+	}
+	return previous
+}
+
+func revision(replicaSet *apiappsv1.ReplicaSet) int64 {
+	v, _ := strconv.ParseInt(replicaSet.Annotations[revisionAnnotation], 10, 64)
+	return v
+}
+
+// sameImageTag 补全并替换别名之后镜像和 tag 都相同
+func sameImageTag(aliases *eventservice.ImageAliases, a, b string) bool {
+	imageA, imageB := eventservice.OfImageEvent(a), eventservice.OfImageEvent(b)
+	return aliases.SameImage(imageA.Image, imageB.Image) && imageA.Tag == imageB.Tag
+}
+
+// parseDeletedImages 解析 imageDeletedAnnotation, key 为容器名称
+func parseDeletedImages(value string) map[string]string {
+	deleted := map[string]string{}
+	for _, item := range strings.Split(value, ",") {
+		if parts := strings.SplitN(strings.TrimSpace(item), "=", 2); len(parts) == 2 {
+			deleted[parts[0]] = parts[1]
+		}
+	}
+	return deleted
+}
+
+// deletedImagesMetadata 设置 imageDeletedAnnotation, 没有被删除的镜像时移除
+func deletedImagesMetadata(deleted map[string]string) *k8sv1.ObjectMetadata {
+	var value *string
+	if len(deleted) > 0 {
+		items := make([]string, 0, len(deleted))
+		for container, image := range deleted {
+			items = append(items, container+"="+image)
+		}
+		sort.Strings(items)
+		joined := strings.Join(items, ",")
+		value = &joined
+	}
+	return &k8sv1.ObjectMetadata{
+		Annotations: map[string]*string{
+			imageDeletedAnnotation: value,
+		},
+	}
+}
@@ -19,11 +19,17 @@ package namespace
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/arugal/laborer/pkg/crash"
 	"github.com/arugal/laborer/pkg/informers"
+	"github.com/arugal/laborer/pkg/service/activity"
 	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/service/policy"
+	"github.com/arugal/laborer/pkg/service/signature"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	informerv1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
@@ -40,30 +46,84 @@ const (
 
 	laborerEnable = "laborer.enable"
 	enabled       = "true"
+
+	// latestTagEnable selected by the latest-tag MutatingWebhookConfiguration
+	latestTagEnable  = "laborere.latest-tag"
+	latestTagEnabled = "enabled"
+
+	// FeatureImageEvent update the image of the deployments on image events
+	FeatureImageEvent = "image-event"
+	// FeatureConfigMapRestart restart the deployments when the configmap changes
+	FeatureConfigMapRestart = "configmap-restart"
+	// FeatureLatestTag set the image tag to the latest when the deployment is created
+	FeatureLatestTag = "latest-tag"
 )
 
 // +kubebuilder:rbac:groups="",resources=configmaps;namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=list;watch;patch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=list
+
+// NotManagedError the namespace has no running AggregationController
+type NotManagedError struct {
+	namespace string
+}
+
+func (e NotManagedError) Error() string {
+	return fmt.Sprintf("namespace %s is not managed by laborer", e.namespace)
+}
+
+// ManagedNamespace the namespace which has a running AggregationController
+type ManagedNamespace struct {
+	Name        string   `json:"name"`
+	Controllers []string `json:"controllers"`
+}
+
+// NamespaceStatus the laborer features enabled by the namespace labels
+type NamespaceStatus struct {
+	Name        string   `json:"name"`
+	Features    []string `json:"features"`
+	Controllers []string `json:"controllers,omitempty"`
+}
+
+// ConfigMapAssociation the deployments restarted when the configmap changes
+type ConfigMapAssociation struct {
+	Namespace   string   `json:"namespace"`
+	ConfigMap   string   `json:"configMap"`
+	Deployments []string `json:"deployments"`
+}
 
 // NamespaceController namespace 控制器，根据 namespace 的 labels 判断是否启动 AggregationController
 type NamespaceController struct {
-	client kubernetes.Interface
+	client   kubernetes.Interface
+	recorder activity.Recorder
+	verifier signature.Verifier
+	aliases  *eventservice.ImageAliases
+	policy   policy.Authorizer
 
 	namespaceInformer       informerv1.NamespaceInformer
 	namespaceInformerSynced cache.InformerSynced
 
 	aggregationControllerMap map[string]Controller
+
+	// mu protects access to the aggregationControllerMap
+	mu sync.RWMutex
 }
 
-func NewNamespaceController(informers informers.InformerFactory, client kubernetes.Interface, imageEventCollect eventservice.ImageEventCollect) *NamespaceController {
+func NewNamespaceController(informers informers.InformerFactory, client kubernetes.Interface, imageEventCollect eventservice.ImageEventCollect,
+	recorder activity.Recorder, verifier signature.Verifier, aliases *eventservice.ImageAliases, authorizer policy.Authorizer) *NamespaceController {
 	n := &NamespaceController{
 		client:                   client,
+		recorder:                 recorder,
+		verifier:                 verifier,
+		aliases:                  aliases,
+		policy:                   authorizer,
 		aggregationControllerMap: map[string]Controller{},
 	}
 
 	namespaceInformer := informers.KubernetesSharedInformerFactory().Core().V1().Namespaces()
 	namespaceInformer.Informer().AddEventHandler(n.newResourceEventHandlerFuncs())
 
+	n.namespaceInformer = namespaceInformer
 	n.namespaceInformerSynced = namespaceInformer.Informer().HasSynced
 
 	imageEventCollect.RegisterHandlerFunc(n.ImageEventHandlerFunc)
@@ -89,6 +149,9 @@ func (n *NamespaceController) syncAggregationController(et eventType, obj interf
 	defer crash.HandleCrash(crash.DefaultHandler)
 	namespace := obj.(*v1.Namespace)
 
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
 	switch et {
 	case added:
 		if enable, ok := namespace.Labels[laborerEnable]; ok && enable == enabled {
@@ -111,7 +174,7 @@ func (n *NamespaceController) syncAggregationController(et eventType, obj interf
 }
 
 func (n *NamespaceController) addNewAggregationController(namespace string) {
-	controller := NewAggregationController(namespace, n.client)
+	controller := NewAggregationController(namespace, n.client, n.recorder, n.verifier, n.aliases, n.policy)
 	controller.Run()
 	n.aggregationControllerMap[namespace] = controller
 }
@@ -123,11 +186,126 @@ func (n *NamespaceController) stopAggregationController(c Controller) {
 
 // ImageEventHandlerFunc update the deployment container image based on event.
 func (n *NamespaceController) ImageEventHandlerFunc(event eventservice.ImageEvent) {
-	for _, ctrl := range n.aggregationControllerMap {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for ns, ctrl := range n.aggregationControllerMap {
+		if event.Namespace != "" && event.Namespace != ns {
+			continue
+		}
 		ctrl.ProcessImageEvent(event)
 	}
 }
 
+// ManagedNamespaces return the namespaces which have a running AggregationController
+func (n *NamespaceController) ManagedNamespaces() []ManagedNamespace {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	namespaces := make([]ManagedNamespace, 0, len(n.aggregationControllerMap))
+	for ns, ctrl := range n.aggregationControllerMap {
+		managed := ManagedNamespace{
+			Name: ns,
+		}
+		if aggregation, ok := ctrl.(*aggregationController); ok {
+			managed.Controllers = aggregation.controllerNames()
+		}
+		namespaces = append(namespaces, managed)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	return namespaces
+}
+
+// NamespaceStatuses return the namespaces which enable any laborer feature
+func (n *NamespaceController) NamespaceStatuses() []NamespaceStatus {
+	namespaces, err := n.namespaceInformer.Lister().List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list namespace err: %v", err)
+		return nil
+	}
+
+	managed := map[string][]string{}
+	for _, m := range n.ManagedNamespaces() {
+		managed[m.Name] = m.Controllers
+	}
+
+	var statuses []NamespaceStatus
+	for _, ns := range namespaces {
+		status := NamespaceStatus{
+			Name: ns.Name,
+		}
+		if controllers, ok := managed[ns.Name]; ok {
+			status.Features = append(status.Features, FeatureImageEvent, FeatureConfigMapRestart)
+			status.Controllers = controllers
+		}
+		if ns.Labels[latestTagEnable] == latestTagEnabled {
+			status.Features = append(status.Features, FeatureLatestTag)
+		}
+		if len(status.Features) > 0 {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// ConfigMapAssociations return the configmap associations of all managed namespaces
+func (n *NamespaceController) ConfigMapAssociations() []ConfigMapAssociation {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var associations []ConfigMapAssociation
+	for ns, ctrl := range n.aggregationControllerMap {
+		associator, ok := ctrl.(ConfigMapAssociator)
+		if !ok {
+			continue
+		}
+		for configmap, deployments := range associator.ConfigMapAssociations() {
+			associations = append(associations, ConfigMapAssociation{
+				Namespace:   ns,
+				ConfigMap:   configmap,
+				Deployments: deployments,
+			})
+		}
+	}
+	sort.Slice(associations, func(i, j int) bool {
+		if associations[i].Namespace != associations[j].Namespace {
+			return associations[i].Namespace < associations[j].Namespace
+		}
+		return associations[i].ConfigMap < associations[j].ConfigMap
+	})
+	return associations
+}
+
+// IsManaged return true if the namespace has a running AggregationController
+func (n *NamespaceController) IsManaged(namespace string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	_, ok := n.aggregationControllerMap[namespace]
+	return ok
+}
+
+// RestartConfigMap restart the deployments associated with the configmap of the namespace
+func (n *NamespaceController) RestartConfigMap(namespace, name string) error {
+	n.mu.RLock()
+	ctrl, ok := n.aggregationControllerMap[namespace]
+	n.mu.RUnlock()
+
+	if !ok {
+		return &NotManagedError{namespace: namespace}
+	}
+	restarter, ok := ctrl.(ConfigMapRestarter)
+	if !ok {
+		return &NotSupportError{namespace: namespace, operation: "configmap restart"}
+	}
+	return restarter.RestartConfigMap(name)
+}
+
 func (n *NamespaceController) newResourceEventHandlerFuncs() cache.ResourceEventHandlerFuncs {
 	return cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -0,0 +1,152 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/arugal/laborer/pkg/apiserver"
+	"github.com/arugal/laborer/pkg/controller/namespace"
+	"github.com/arugal/laborer/pkg/service/activity"
+	"k8s.io/klog"
+)
+
+const (
+	// PathPrefix the prefix of the dashboard
+	PathPrefix = "/dashboard/"
+
+	recentEvents = 50
+)
+
+// actionStatus the status of a workload action
+type actionStatus string
+
+const (
+	pending actionStatus = "pending"
+	failed  actionStatus = "failed"
+)
+
+// NamespaceLister return the namespaces shown by the dashboard
+type NamespaceLister interface {
+	NamespaceStatuses() []namespace.NamespaceStatus
+	ConfigMapAssociations() []namespace.ConfigMapAssociation
+}
+
+// Action a workload action which is pending or failed
+type Action struct {
+	Status actionStatus `json:"status"`
+	activity.Activity
+}
+
+// Overview everything shown by the dashboard
+type Overview struct {
+	Namespaces   []namespace.NamespaceStatus      `json:"namespaces"`
+	Events       []activity.EventRecord           `json:"events"`
+	Associations []namespace.ConfigMapAssociation `json:"associations"`
+	Actions      []Action                         `json:"actions"`
+	// Replay show the replay buttons which call the admin api
+	Replay  bool   `json:"replay"`
+	APIPath string `json:"apiPath"`
+}
+
+// dashboard a read-only page of the laborer activity, the writes go through the admin api
+type dashboard struct {
+	options *DashboardOptions
+
+	namespaces NamespaceLister
+	history    *activity.History
+}
+
+// NewDashboard return the handler of the dashboard, it should be registered with PathPrefix
+func NewDashboard(options *DashboardOptions, namespaces NamespaceLister, history *activity.History) http.Handler {
+	return &dashboard{
+		options:    options,
+		namespaces: namespaces,
+		history:    history,
+	}
+}
+
+func (d *dashboard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch strings.TrimPrefix(req.URL.Path, PathPrefix) {
+	case "", "index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(indexHTML))
+	case "api/overview":
+		d.overview(w)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (d *dashboard) overview(w http.ResponseWriter) {
+	_, events := d.history.List(0, recentEvents)
+
+	overview := Overview{
+		Namespaces:   d.namespaces.NamespaceStatuses(),
+		Events:       events,
+		Associations: d.namespaces.ConfigMapAssociations(),
+		Actions:      pendingOrFailedActions(events),
+		Replay:       d.options.Replay,
+		APIPath:      apiserver.PathPrefix,
+	}
+
+	data, err := json.Marshal(overview)
+	if err != nil {
+		klog.Errorf("dashboard marshal overview err: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// pendingOrFailedActions return the workloads whose last activity is matched, failed or flagged
+func pendingOrFailedActions(events []activity.EventRecord) []Action {
+	actions := []Action{}
+	for _, event := range events {
+		last := map[string]activity.Activity{}
+		var keys []string
+		for _, a := range event.Activities {
+			if a.Name == "" {
+				continue
+			}
+			key := strings.Join([]string{a.Namespace, a.Kind, a.Name, a.Container}, "/")
+			if _, ok := last[key]; !ok {
+				keys = append(keys, key)
+			}
+			last[key] = a
+		}
+
+		for _, key := range keys {
+			a := last[key]
+			switch a.Action {
+			case activity.Matched:
+				actions = append(actions, Action{Status: pending, Activity: a})
+			case activity.Failed, activity.Flagged:
+				actions = append(actions, Action{Status: failed, Activity: a})
+			}
+		}
+	}
+	return actions
+}
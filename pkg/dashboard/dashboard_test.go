@@ -0,0 +1,71 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package dashboard
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+)
+
+func Test_pendingOrFailedActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		activities []activity.Activity
+		want       []actionStatus
+	}{
+		{
+			name: "applied",
+			activities: []activity.Activity{
+				{Action: activity.Queued},
+				{Action: activity.Matched, Namespace: "test", Kind: "Deployment", Name: "web", Container: "web"},
+				{Action: activity.Applied, Namespace: "test", Kind: "Deployment", Name: "web", Container: "web"},
+			},
+			want: nil,
+		},
+		{
+			name: "pending",
+			activities: []activity.Activity{
+				{Action: activity.Queued},
+				{Action: activity.Matched, Namespace: "test", Kind: "Deployment", Name: "web", Container: "web"},
+			},
+			want: []actionStatus{pending},
+		},
+		{
+			name: "failed and applied",
+			activities: []activity.Activity{
+				{Action: activity.Matched, Namespace: "a", Kind: "Deployment", Name: "web", Container: "web"},
+				{Action: activity.Matched, Namespace: "b", Kind: "Deployment", Name: "web", Container: "web"},
+				{Action: activity.Failed, Namespace: "a", Kind: "Deployment", Name: "web", Container: "web"},
+				{Action: activity.Applied, Namespace: "b", Kind: "Deployment", Name: "web", Container: "web"},
+			},
+			want: []actionStatus{failed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []actionStatus
+			for _, a := range pendingOrFailedActions([]activity.EventRecord{{ID: "1", Activities: tt.activities}}) {
+				got = append(got, a.Status)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pendingOrFailedActions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package dashboard
+
+import "github.com/spf13/pflag"
+
+type DashboardOptions struct {
+	// Enabled the dashboard is not authenticated and shows the events of all namespaces, it is disabled by default
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Replay show the replay buttons, the replay is sent to the admin api with the bearer token of the user
+	Replay bool `json:"replay" yaml:"replay"`
+}
+
+func (d *DashboardOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&d.Enabled, "dashboard-enabled", d.Enabled, "serve the read-only dashboard at /dashboard/ of the http server, "+
+		"it is not authenticated and shows the image events of all namespaces")
+	fs.BoolVar(&d.Replay, "dashboard-replay", d.Replay, "show the replay buttons of the failed actions, "+
+		"the replay requires a bearer token authorized by the admin api")
+}
+
+func (d *DashboardOptions) Validate() (errs []error) {
+	return errs
+}
+
+func NewDashboardOptions() *DashboardOptions {
+	return &DashboardOptions{
+		Enabled: false,
+		Replay:  false,
+	}
+}
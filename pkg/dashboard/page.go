@@ -0,0 +1,141 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package dashboard
+
+// indexHTML the single page of the dashboard, it polls api/overview and only
+// writes through the admin api with the bearer token entered by the user
+const indexHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Laborer</title>
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 24px; color: #24292e; }
+  h1 { font-size: 22px; }
+  h2 { font-size: 16px; margin-top: 28px; border-bottom: 1px solid #e1e4e8; padding-bottom: 4px; }
+  table { border-collapse: collapse; width: 100%; font-size: 13px; }
+  th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eaecef; vertical-align: top; }
+  th { background: #f6f8fa; }
+  .tag { display: inline-block; padding: 0 6px; margin-right: 4px; border-radius: 3px; background: #e1ecf4; }
+  .Applied, .Restarted, .RolledBack { color: #22863a; }
+  .Failed, .Flagged, .Refused, .Unverified, .failed { color: #cb2431; }
+  .Matched, .Held, .pending { color: #b08800; }
+  .muted { color: #6a737d; }
+  #token { width: 360px; }
+  #message { margin-left: 8px; }
+</style>
+</head>
+<body>
+<h1>Laborer</h1>
+<div id="auth" hidden>
+  <input id="token" type="password" placeholder="Bearer token for the admin api">
+  <span id="message" class="muted"></span>
+</div>
+
+<h2>Namespaces</h2>
+<table><thead><tr><th>Namespace</th><th>Features</th><th>Controllers</th></tr></thead><tbody id="namespaces"></tbody></table>
+
+<h2>Pending and failed actions</h2>
+<table><thead><tr><th>Time</th><th>Status</th><th>Workload</th><th>Image</th><th>Message</th><th></th></tr></thead><tbody id="actions"></tbody></table>
+
+<h2>Recent events</h2>
+<table><thead><tr><th>Time</th><th>Source</th><th>Image</th><th>Workloads</th></tr></thead><tbody id="events"></tbody></table>
+
+<h2>ConfigMap associations</h2>
+<table><thead><tr><th>Namespace</th><th>ConfigMap</th><th>Deployments</th></tr></thead><tbody id="associations"></tbody></table>
+
+<script>
+  var overview = {};
+
+  function esc(v) {
+    return String(v == null ? "" : v).replace(/[&<>"']/g, function (c) {
+      return { "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" }[c];
+    });
+  }
+
+  function time(t) {
+    return esc(new Date(t).toLocaleString());
+  }
+
+  function tags(items) {
+    return (items || []).map(function (i) { return '<span class="tag">' + esc(i) + '</span>'; }).join("");
+  }
+
+  function workload(a) {
+    var w = a.namespace + "/" + a.name;
+    return esc(a.container ? w + " [" + a.container + "]" : w);
+  }
+
+  function render() {
+    document.getElementById("auth").hidden = !overview.replay;
+
+    document.getElementById("namespaces").innerHTML = (overview.namespaces || []).map(function (n) {
+      return "<tr><td>" + esc(n.name) + "</td><td>" + tags(n.features) + "</td><td>" + tags(n.controllers) + "</td></tr>";
+    }).join("");
+
+    document.getElementById("actions").innerHTML = (overview.actions || []).map(function (a, i) {
+      var button = overview.replay && a.status === "failed" ? '<button onclick="replay(' + i + ')">Replay</button>' : "";
+      return "<tr><td>" + time(a.time) + '</td><td class="' + esc(a.status) + '">' + esc(a.status) + "</td><td>" + workload(a) +
+        "</td><td>" + esc(a.image || a.configMap) + '</td><td class="muted">' + esc(a.message) + "</td><td>" + button + "</td></tr>";
+    }).join("");
+
+    document.getElementById("events").innerHTML = (overview.events || []).map(function (e) {
+      var workloads = (e.activities || []).filter(function (a) { return a.name; }).map(function (a) {
+        return '<div class="' + esc(a.action) + '">' + esc(a.action) + " " + workload(a) + "</div>";
+      }).join("");
+      return "<tr><td>" + time(e.time) + "</td><td>" + esc(e.source) + "</td><td>" + esc(e.image) + "</td><td>" +
+        (workloads || '<span class="muted">no workload matched</span>') + "</td></tr>";
+    }).join("");
+
+    document.getElementById("associations").innerHTML = (overview.associations || []).map(function (a) {
+      return "<tr><td>" + esc(a.namespace) + "</td><td>" + esc(a.configMap) + "</td><td>" + tags(a.deployments) + "</td></tr>";
+    }).join("");
+  }
+
+  function refresh() {
+    fetch("api/overview").then(function (r) { return r.json(); }).then(function (o) {
+      overview = o;
+      render();
+    });
+  }
+
+  function replay(i) {
+    var a = overview.actions[i];
+    var path, body;
+    if (a.configMap) {
+      path = "namespaces/" + encodeURIComponent(a.namespace) + "/configmaps/" + encodeURIComponent(a.configMap) + "/restart";
+    } else {
+      path = "namespaces/" + encodeURIComponent(a.namespace) + "/imageevents";
+      body = JSON.stringify({ image: a.image });
+    }
+    var message = document.getElementById("message");
+    fetch(overview.apiPath + path, {
+      method: "POST",
+      headers: { "Authorization": "Bearer " + document.getElementById("token").value, "Content-Type": "application/json" },
+      body: body
+    }).then(function (r) { return r.json(); }).then(function (s) {
+      message.textContent = s.message;
+      refresh();
+    });
+  }
+
+  refresh();
+  setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,320 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+)
+
+const (
+	dingTalkType = "dingtalk"
+	feishuType   = "feishu"
+	weComType    = "wecom"
+	slackType    = "slack"
+)
+
+// chatChannel send the activity as a formatted message to the robot of the chat tools
+type chatChannel struct {
+	name     string
+	typ      string
+	url      string
+	secret   string
+	headers  map[string]string
+	template *template.Template
+
+	now func() time.Time
+}
+
+func newChatChannel(options ChannelOptions) (Channel, error) {
+	c := &chatChannel{
+		name:    options.Name,
+		typ:     options.Type,
+		url:     options.URL,
+		secret:  options.Secret,
+		headers: options.Headers,
+		now:     time.Now,
+	}
+	if options.Template != "" {
+		tmpl, err := template.New(options.Name).Funcs(templateFuncs).Parse(options.Template)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %s template err: %v", options.Name, err)
+		}
+		c.template = tmpl
+	}
+	return c, nil
+}
+
+func (c *chatChannel) Name() string {
+	return c.name
+}
+
+func (c *chatChannel) Send(ctx context.Context, client *http.Client, a activity.Activity) error {
+	var (
+		reqURL = c.url
+		body   interface{}
+		err    error
+	)
+	switch c.typ {
+	case dingTalkType:
+		reqURL, body, err = c.dingTalk(a)
+	case feishuType:
+		body, err = c.feishu(a)
+	case weComType:
+		body, err = c.weCom(a)
+	case slackType:
+		body, err = c.slack(a)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := post(ctx, client, reqURL, data, c.headers)
+	if err != nil {
+		return err
+	}
+	return c.checkResponse(resp)
+}
+
+// dingTalk markdown message, signed with timestamp and secret in the url
+func (c *chatChannel) dingTalk(a activity.Activity) (string, interface{}, error) {
+	text, err := c.text(a, "**", "\n\n")
+	if err != nil {
+		return "", nil, err
+	}
+	body := map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": title(a),
+			"text":  fmt.Sprintf("#### %s\n\n%s", title(a), text),
+		},
+	}
+	if c.secret == "" {
+		return c.url, body, nil
+	}
+
+	timestamp := strconv.FormatInt(c.now().UnixNano()/int64(time.Millisecond), 10)
+	sign := hmacBase64([]byte(c.secret), []byte(timestamp+"\n"+c.secret))
+	separator := "?"
+	if strings.Contains(c.url, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%stimestamp=%s&sign=%s", c.url, separator, timestamp, url.QueryEscape(sign)), body, nil
+}
+
+// feishu interactive card, signed with timestamp and secret in the body
+func (c *chatChannel) feishu(a activity.Activity) (interface{}, error) {
+	text, err := c.text(a, "**", "\n")
+	if err != nil {
+		return nil, err
+	}
+	color := "blue"
+	switch a.Action {
+	case activity.Failed, activity.Refused, activity.Unverified:
+		color = "red"
+	case activity.Flagged, activity.Held:
+		color = "orange"
+	case activity.Applied, activity.Restarted, activity.Mutated, activity.RolledBack:
+		color = "green"
+	}
+	body := map[string]interface{}{
+		"msg_type": "interactive",
+		"card": map[string]interface{}{
+			"config": map[string]bool{
+				"wide_screen_mode": true,
+			},
+			"header": map[string]interface{}{
+				"title": map[string]string{
+					"tag":     "plain_text",
+					"content": title(a),
+				},
+				"template": color,
+			},
+			"elements": []interface{}{
+				map[string]interface{}{
+					"tag": "div",
+					"text": map[string]string{
+						"tag":     "lark_md",
+						"content": text,
+					},
+				},
+			},
+		},
+	}
+	if c.secret != "" {
+		timestamp := strconv.FormatInt(c.now().Unix(), 10)
+		body["timestamp"] = timestamp
+		body["sign"] = hmacBase64([]byte(timestamp+"\n"+c.secret), nil)
+	}
+	return body, nil
+}
+
+// weCom markdown message
+func (c *chatChannel) weCom(a activity.Activity) (interface{}, error) {
+	text, err := c.text(a, "**", "\n")
+	if err != nil {
+		return nil, err
+	}
+	color := "info"
+	if a.Action == activity.Failed {
+		color = "warning"
+	}
+	return map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": fmt.Sprintf("<font color=\"%s\">%s</font>\n%s", color, title(a), text),
+		},
+	}, nil
+}
+
+// slack mrkdwn section block
+func (c *chatChannel) slack(a activity.Activity) (interface{}, error) {
+	text, err := c.text(a, "*", "\n")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"text": title(a),
+		"blocks": []interface{}{
+			map[string]interface{}{
+				"type": "header",
+				"text": map[string]string{
+					"type": "plain_text",
+					"text": title(a),
+				},
+			},
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": text,
+				},
+			},
+		},
+	}, nil
+}
+
+// checkResponse the robots answer 200 with an error code in the body
+func (c *chatChannel) checkResponse(resp []byte) error {
+	if c.typ == slackType {
+		if strings.TrimSpace(string(resp)) != "ok" {
+			return fmt.Errorf("slack response: %s", string(resp))
+		}
+		return nil
+	}
+
+	var result struct {
+		ErrCode    int    `json:"errcode"`
+		ErrMsg     string `json:"errmsg"`
+		Code       int    `json:"code"`
+		Msg        string `json:"msg"`
+		StatusCode int    `json:"StatusCode"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return fmt.Errorf("%s response %s: %v", c.typ, string(resp), err)
+	}
+	if result.ErrCode != 0 || result.Code != 0 || result.StatusCode != 0 {
+		return fmt.Errorf("%s response: %s", c.typ, string(resp))
+	}
+	return nil
+}
+
+// text render the template, or the built-in message with the bold marker and line separator of the chat tool
+func (c *chatChannel) text(a activity.Activity, bold, separator string) (string, error) {
+	if c.template != nil {
+		var buf bytes.Buffer
+		if err := c.template.Execute(&buf, a); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	var lines []string
+	field := func(name, value string) {
+		if value != "" {
+			lines = append(lines, fmt.Sprintf("%s%s%s: %s", bold, name, bold, value))
+		}
+	}
+	field("Namespace", a.Namespace)
+	if a.Name != "" {
+		field("Workload", fmt.Sprintf("%s/%s", a.Kind, a.Name))
+	}
+	field("Container", a.Container)
+	if a.OldImage != "" {
+		field("Image", fmt.Sprintf("%s -> %s", a.OldImage, a.Image))
+	} else {
+		field("Image", a.Image)
+	}
+	field("ConfigMap", a.ConfigMap)
+	field("Source", a.Source)
+	field("Message", a.Message)
+	field("Time", a.Time.Format(time.RFC3339))
+	return strings.Join(lines, separator), nil
+}
+
+func title(a activity.Activity) string {
+	var action string
+	switch a.Action {
+	case activity.Applied:
+		action = "Image updated"
+	case activity.Restarted:
+		action = "Workload restarted"
+	case activity.Mutated:
+		action = "Latest tag resolved"
+	case activity.Failed:
+		action = "Update failed"
+	case activity.Flagged:
+		action = "Image deleted"
+	case activity.RolledBack:
+		action = "Image rolled back"
+	case activity.Held:
+		action = "Update held by vulnerabilities"
+	case activity.Refused:
+		action = "Update refused by vulnerabilities"
+	case activity.Unverified:
+		action = "Update refused by signature verification"
+	default:
+		action = string(a.Action)
+	}
+	if a.Name == "" {
+		return fmt.Sprintf("[Laborer] %s", action)
+	}
+	return fmt.Sprintf("[Laborer] %s: %s/%s", action, a.Namespace, a.Name)
+}
+
+func hmacBase64(key, message []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,155 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+)
+
+func Test_chatChannel_Send(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	a := activity.Activity{
+		Action:    activity.Failed,
+		Namespace: "test",
+		Kind:      "Deployment",
+		Name:      "web",
+		Image:     "web:v2",
+		OldImage:  "web:v1",
+		Message:   "forbidden",
+		Time:      now,
+	}
+	tests := []struct {
+		name      string
+		typ       string
+		secret    string
+		response  string
+		wantQuery string
+		wantBody  []string
+		wantErr   bool
+	}{
+		{
+			name:     "dingtalk",
+			typ:      dingTalkType,
+			secret:   "secret",
+			response: `{"errcode":0,"errmsg":"ok"}`,
+			// base64(HMAC-SHA256(key: secret, message: "1600000000000\nsecret"))
+			wantQuery: "timestamp=1600000000000&sign=" + url.QueryEscape("XHSnLTbboLLBCrXfAQRHx6W9LkLB43RYwgcsOS2j3vs="),
+			wantBody:  []string{`"msgtype":"markdown"`, `**Image**: web:v1 -> web:v2`},
+		},
+		{
+			name:     "dingtalk error code",
+			typ:      dingTalkType,
+			response: `{"errcode":310000,"errmsg":"sign not match"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "feishu",
+			typ:      feishuType,
+			secret:   "secret",
+			response: `{"code":0,"msg":"success"}`,
+			wantBody: []string{`"msg_type":"interactive"`, `"template":"red"`, `"timestamp":"1600000000"`,
+				// base64(HMAC-SHA256(key: "1600000000\nsecret", message: empty))
+				`"sign":"vvU1S4ucHy95pQ90meMW66yQJ+Szge4s9g7hQUu9yP8="`},
+		},
+		{
+			name:     "wecom",
+			typ:      weComType,
+			response: `{"errcode":0,"errmsg":"ok"}`,
+			wantBody: []string{`"msgtype":"markdown"`, `color=\"warning\"`},
+		},
+		{
+			name:     "slack",
+			typ:      slackType,
+			response: `ok`,
+			wantBody: []string{`"type":"mrkdwn"`, `*Namespace*: test`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery, gotBody string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := ioutil.ReadAll(req.Body)
+				gotQuery, gotBody = req.URL.RawQuery, string(body)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			channel, err := newChatChannel(ChannelOptions{Name: tt.name, Type: tt.typ, URL: server.URL, Secret: tt.secret})
+			if err != nil {
+				t.Fatalf("newChatChannel() error = %v", err)
+			}
+			channel.(*chatChannel).now = func() time.Time { return now }
+
+			err = channel.Send(context.Background(), server.Client(), a)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantQuery != "" {
+				wantQuery, _ := url.ParseQuery(tt.wantQuery)
+				gotQuery, _ := url.ParseQuery(gotQuery)
+				if !reflect.DeepEqual(gotQuery, wantQuery) {
+					t.Errorf("Send() query = %v, want %v", gotQuery, wantQuery)
+				}
+			}
+			if !json.Valid([]byte(gotBody)) {
+				t.Errorf("Send() body is not json: %s", gotBody)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(gotBody, want) {
+					t.Errorf("Send() body = %s, want contains %s", gotBody, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_title(t *testing.T) {
+	tests := []struct {
+		name     string
+		activity activity.Activity
+		want     string
+	}{
+		{
+			name:     "refused by vulnerabilities",
+			activity: activity.Activity{Action: activity.Refused, Image: "web:v2"},
+			want:     "[Laborer] Update refused by vulnerabilities",
+		},
+		{
+			name:     "refused by signature verification",
+			activity: activity.Activity{Action: activity.Unverified, Namespace: "test", Name: "web"},
+			want:     "[Laborer] Update refused by signature verification: test/web",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := title(tt.activity); got != tt.want {
+				t.Errorf("title() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
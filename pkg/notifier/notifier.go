@@ -0,0 +1,204 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/arugal/laborer/pkg/crash"
+	"github.com/arugal/laborer/pkg/service/activity"
+	"k8s.io/klog"
+)
+
+const (
+	subscribeBuffer = 1000
+
+	// retryInterval the interval before the first retry, doubled after each retry
+	retryInterval = time.Second
+)
+
+var (
+	// defaultActions the outcomes of the pipeline
+	defaultActions = []string{string(activity.Applied), string(activity.Failed), string(activity.Restarted), string(activity.Mutated),
+		string(activity.Flagged), string(activity.RolledBack), string(activity.Held), string(activity.Refused),
+		string(activity.Unverified)}
+)
+
+// Channel deliver the activity to a destination
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, client *http.Client, a activity.Activity) error
+}
+
+// newChannel create the channel by type
+func newChannel(options ChannelOptions) (Channel, error) {
+	if options.Name == "" {
+		return nil, fmt.Errorf("notification channel name is required")
+	}
+	if options.URL == "" {
+		return nil, fmt.Errorf("notification channel %s url is required", options.Name)
+	}
+	switch options.Type {
+	case "", webhookType:
+		return newWebhookChannel(options)
+	case dingTalkType, feishuType, weComType, slackType:
+		return newChatChannel(options)
+	default:
+		return nil, fmt.Errorf("notification channel %s type %s is not supported", options.Name, options.Type)
+	}
+}
+
+// route deliver the activities of the namespaces and actions to the channel
+type route struct {
+	channel    Channel
+	namespaces map[string]struct{}
+	actions    map[activity.Action]struct{}
+}
+
+func (r route) match(a activity.Activity) bool {
+	if _, ok := r.actions[a.Action]; !ok {
+		return false
+	}
+	if len(r.namespaces) == 0 {
+		return true
+	}
+	_, ok := r.namespaces[a.Namespace]
+	return ok
+}
+
+// Notifier send the outcomes of the pipeline to the configured channels
+type Notifier struct {
+	options     *NotifierOptions
+	broadcaster *activity.Broadcaster
+	client      *http.Client
+
+	routes []route
+}
+
+func NewNotifier(options *NotifierOptions, broadcaster *activity.Broadcaster) (*Notifier, error) {
+	n := &Notifier{
+		options:     options,
+		broadcaster: broadcaster,
+		client: &http.Client{
+			Timeout: options.Timeout,
+		},
+	}
+
+	for _, c := range options.Channels {
+		channel, err := newChannel(c)
+		if err != nil {
+			return nil, err
+		}
+		r := route{
+			channel:    channel,
+			namespaces: map[string]struct{}{},
+			actions:    map[activity.Action]struct{}{},
+		}
+		for _, ns := range c.Namespaces {
+			r.namespaces[ns] = struct{}{}
+		}
+		actions := c.Actions
+		if len(actions) == 0 {
+			actions = defaultActions
+		}
+		for _, action := range actions {
+			r.actions[activity.Action(action)] = struct{}{}
+		}
+		n.routes = append(n.routes, r)
+	}
+	return n, nil
+}
+
+func (n *Notifier) Start(ctx context.Context) error {
+	if len(n.routes) == 0 {
+		klog.V(0).Info("no notification channel configured, notifier is not going to run")
+		return nil
+	}
+
+	klog.V(0).Infof("starting notifier with %d channels", len(n.routes))
+	activities, cancel := n.broadcaster.Subscribe(subscribeBuffer)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			klog.V(0).Info("shutting down notifier")
+			return nil
+		case a := <-activities:
+			for _, r := range n.routes {
+				if r.match(a) {
+					go n.send(ctx, r.channel, a)
+				}
+			}
+		}
+	}
+}
+
+// send deliver the activity, retry with exponential backoff on failure
+func (n *Notifier) send(ctx context.Context, channel Channel, a activity.Activity) {
+	defer crash.HandleCrash(crash.DefaultHandler)
+
+	interval := retryInterval
+	for i := 0; ; i++ {
+		err := channel.Send(ctx, n.client, a)
+		if err == nil {
+			klog.V(2).Infof("notification %s %s sent to %s", a.Action, a.EventID, channel.Name())
+			return
+		}
+		if i >= n.options.Retries {
+			klog.Errorf("notification %s %s to %s err: %v, give up after %d retries", a.Action, a.EventID, channel.Name(), err, i)
+			return
+		}
+		klog.Warningf("notification %s %s to %s err: %v, retry after %s", a.Action, a.EventID, channel.Name(), err, interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// post send the body to the url and return the response body, any status other than 2xx is an error
+func post(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return respBody, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
@@ -0,0 +1,80 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package notifier
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type NotifierOptions struct {
+	// Retries number of retries after the first failed delivery
+	Retries int           `json:"retries" yaml:"retries"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// Channels only configurable through the configuration file
+	Channels []ChannelOptions `json:"channels,omitempty" yaml:"channels,omitempty"`
+}
+
+type ChannelOptions struct {
+	Name string `json:"name" yaml:"name"`
+	// Type of the channel, optional: webhook, dingtalk, feishu, wecom, slack
+	Type string `json:"type" yaml:"type"`
+	URL  string `json:"url" yaml:"url"`
+	// Template go template, the activity is the data. For webhook it renders the request body, empty means
+	// the json of the activity; for the others it renders the markdown text, empty means the built-in message
+	Template string            `json:"template,omitempty" yaml:"template,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Secret for webhook sign the request body with HMAC-SHA256, for dingtalk and feishu
+	// it is the secret of the signature verification of the robot
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// Namespaces the notified namespaces, empty means all namespaces
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Actions the notified actions, empty means the outcomes of the pipeline (defaultActions): Applied, Failed,
+	// Restarted, Mutated, Flagged, RolledBack, Held, Refused and Unverified
+	Actions []string `json:"actions,omitempty" yaml:"actions,omitempty"`
+}
+
+func (n *NotifierOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&n.Retries, "notification-retries", n.Retries, "number of retries when a notification fails to be delivered")
+	fs.DurationVar(&n.Timeout, "notification-timeout", n.Timeout, "timeout of a single notification request")
+}
+
+func (n *NotifierOptions) Validate() (errs []error) {
+	if n.Retries < 0 {
+		errs = append(errs, fmt.Errorf("notification retries must not be negative"))
+	}
+	names := map[string]struct{}{}
+	for _, c := range n.Channels {
+		if _, ok := names[c.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate notification channel %s", c.Name))
+		}
+		names[c.Name] = struct{}{}
+		if _, err := newChannel(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func NewNotifierOptions() *NotifierOptions {
+	return &NotifierOptions{
+		Retries: 3,
+		Timeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+)
+
+const (
+	webhookType = "webhook"
+
+	// SignatureHeader the HMAC-SHA256 signature of the body, eg: sha256=<hex>
+	SignatureHeader = "X-Laborer-Signature"
+	// ActionHeader the action of the activity
+	ActionHeader = "X-Laborer-Action"
+)
+
+var (
+	templateFuncs = template.FuncMap{
+		// json quote the value as a json value, eg: {"image": {{ json .Image }}}
+		"json": func(v interface{}) (string, error) {
+			data, err := marshal(v)
+			return string(data), err
+		},
+	}
+)
+
+// webhookChannel POST the rendered activity to a generic webhook
+type webhookChannel struct {
+	name     string
+	url      string
+	template *template.Template
+	headers  map[string]string
+	secret   string
+}
+
+func newWebhookChannel(options ChannelOptions) (Channel, error) {
+	w := &webhookChannel{
+		name:    options.Name,
+		url:     options.URL,
+		headers: options.Headers,
+		secret:  options.Secret,
+	}
+	if options.Template != "" {
+		tmpl, err := template.New(options.Name).Funcs(templateFuncs).Parse(options.Template)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %s template err: %v", options.Name, err)
+		}
+		w.template = tmpl
+	}
+	return w, nil
+}
+
+func (w *webhookChannel) Name() string {
+	return w.name
+}
+
+func (w *webhookChannel) Send(ctx context.Context, client *http.Client, a activity.Activity) error {
+	body, err := w.render(a)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		ActionHeader: string(a.Action),
+	}
+	for k, v := range w.headers {
+		headers[k] = v
+	}
+	if w.secret != "" {
+		headers[SignatureHeader] = "sha256=" + sign(w.secret, body)
+	}
+	_, err = post(ctx, client, w.url, body, headers)
+	return err
+}
+
+func (w *webhookChannel) render(a activity.Activity) ([]byte, error) {
+	if w.template == nil {
+		return marshal(a)
+	}
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, a); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sign return the hex HMAC-SHA256 of the body
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// marshal encode the value as json without escaping the html characters, eg: ->
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
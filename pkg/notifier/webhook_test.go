@@ -0,0 +1,143 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package notifier
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+)
+
+// standIn record the requests and fail the first failures requests
+type standIn struct {
+	failures int
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(req.Body)
+	s.requests = append(s.requests, req)
+	s.bodies = append(s.bodies, string(body))
+	if len(s.requests) <= s.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func Test_webhookChannel_Send(t *testing.T) {
+	a := activity.Activity{
+		EventID:   "1",
+		Action:    activity.Applied,
+		Namespace: "test",
+		Kind:      "Deployment",
+		Name:      "web",
+		Image:     "web:v2",
+	}
+	tests := []struct {
+		name          string
+		options       ChannelOptions
+		wantBody      string
+		wantSignature string
+	}{
+		{
+			name:     "template",
+			options:  ChannelOptions{Name: "t", Template: `{"text": {{ json (printf "%s/%s -> %s" .Namespace .Name .Image) }}}`},
+			wantBody: `{"text": "test/web -> web:v2"}`,
+		},
+		{
+			name:          "signature",
+			options:       ChannelOptions{Name: "s", Template: `{{ .Action }}`, Secret: "secret"},
+			wantBody:      `Applied`,
+			wantSignature: "sha256=" + sign("secret", []byte("Applied")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &standIn{}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			tt.options.URL = server.URL
+			channel, err := newWebhookChannel(tt.options)
+			if err != nil {
+				t.Fatalf("newWebhookChannel() error = %v", err)
+			}
+			if err = channel.Send(context.Background(), server.Client(), a); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if s.bodies[0] != tt.wantBody {
+				t.Errorf("Send() body = %v, want %v", s.bodies[0], tt.wantBody)
+			}
+			if got := s.requests[0].Header.Get(SignatureHeader); got != tt.wantSignature {
+				t.Errorf("Send() signature = %v, want %v", got, tt.wantSignature)
+			}
+		})
+	}
+}
+
+func TestNotifier_route(t *testing.T) {
+	s := &standIn{failures: 1}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	broadcaster := activity.NewBroadcaster()
+	n, err := NewNotifier(&NotifierOptions{
+		Retries: 1,
+		Timeout: time.Second,
+		Channels: []ChannelOptions{
+			{Name: "test", URL: server.URL, Namespaces: []string{"test"}},
+		},
+	}, broadcaster)
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = n.Start(ctx)
+	}()
+	// wait for the subscription
+	time.Sleep(100 * time.Millisecond)
+
+	broadcaster.Record(activity.Activity{Action: activity.Applied, Namespace: "other"})
+	broadcaster.Record(activity.Activity{Action: activity.Queued, Namespace: "test"})
+	broadcaster.Record(activity.Activity{Action: activity.Applied, Namespace: "test"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		got := len(s.requests)
+		s.mu.Unlock()
+		if got == 2 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Errorf("expect 2 requests (1 failure and 1 retry), got %d", len(s.requests))
+}
@@ -91,6 +91,10 @@ func (h *HttpServer) Start(ctx context.Context) error {
 
 	srv := &http.Server{
 		Handler: h.serveMux,
+		// cancel the long-lived requests, eg: event stream, when the server is stopping
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 	}
 
 	idleConnsClosed := make(chan struct{})
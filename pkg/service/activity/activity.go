@@ -0,0 +1,176 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package activity
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// Action what happened to an event in the pipeline
+type Action string
+
+const (
+	// Received a webhook request has been received from the image repository
+	Received Action = "Received"
+	// Queued the image event has been accepted by the ImageEventCollect
+	Queued Action = "Queued"
+	// Matched a workload uses the image of the event
+	Matched Action = "Matched"
+	// Applied the workload has been patched with the new image
+	Applied Action = "Applied"
+	// Failed the workload could not be patched
+	Failed Action = "Failed"
+	// Restarted the workload has been restarted because its configmap changed
+	Restarted Action = "Restarted"
+	// Mutated the image of the workload has been set to the latest tag on admission
+	Mutated Action = "Mutated"
+	// Flagged the workload still uses an image which has been deleted from the repository
+	Flagged Action = "Flagged"
+	// RolledBack the workload has been rolled back because its image has been deleted from the repository
+	RolledBack Action = "RolledBack"
+	// Held the update is held by the vulnerability gate until a later scan passes
+	Held Action = "Held"
+	// Refused the update is refused by the vulnerability gate
+	Refused Action = "Refused"
+	// Unverified the update is refused because the cosign signature of the image could not be verified
+	Unverified Action = "Unverified"
+)
+
+// Activity a single step of the pipeline
+type Activity struct {
+	// EventID groups the activities caused by the same event
+	EventID   string    `json:"eventId"`
+	Time      time.Time `json:"time"`
+	Action    Action    `json:"action"`
+	Source    string    `json:"source,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Kind      string    `json:"kind,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	OldImage  string    `json:"oldImage,omitempty"`
+	// ConfigMap the configmap which triggered the restart
+	ConfigMap string `json:"configMap,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Recorder records the activities of the pipeline
+type Recorder interface {
+	Record(activity Activity)
+}
+
+// Recorders record the activity with every recorder
+type Recorders []Recorder
+
+func (r Recorders) Record(activity Activity) {
+	for _, recorder := range r {
+		recorder.Record(activity)
+	}
+}
+
+// NewEventID generate a unique event id
+func NewEventID() string {
+	return string(uuid.NewUUID())
+}
+
+// Record fill in the time of the activity and hand it to the recorder, a nil recorder is ignored
+func Record(recorder Recorder, activity Activity) {
+	if recorder == nil {
+		return
+	}
+	if activity.Time.IsZero() {
+		activity.Time = time.Now()
+	}
+	if activity.EventID == "" {
+		activity.EventID = NewEventID()
+	}
+	recorder.Record(activity)
+}
+
+// recordingImageEventCollect assign an id to every collected event and record it as queued
+type recordingImageEventCollect struct {
+	eventservice.ImageEventCollect
+
+	recorder Recorder
+}
+
+// NewRecordingImageEventCollect wrap the collect so that every collected event is recorded
+func NewRecordingImageEventCollect(collect eventservice.ImageEventCollect, recorder Recorder) eventservice.ImageEventCollect {
+	return &recordingImageEventCollect{
+		ImageEventCollect: collect,
+		recorder:          recorder,
+	}
+}
+
+func (r *recordingImageEventCollect) Collect(event eventservice.ImageEvent) {
+	if event.ID == "" {
+		event.ID = NewEventID()
+	}
+	Record(r.recorder, Activity{
+		EventID:   event.ID,
+		Action:    Queued,
+		Source:    event.Source,
+		Namespace: event.Namespace,
+		Image:     event.String(),
+		Message:   eventMessage(event),
+	})
+	r.ImageEventCollect.Collect(event)
+}
+
+// eventMessage the type and the vulnerability summary of the event, empty for the plain push event
+func eventMessage(event eventservice.ImageEvent) string {
+	var parts []string
+	if !event.IsPush() {
+		parts = append(parts, string(event.Type))
+	}
+	if event.Scan != nil {
+		parts = append(parts, event.Scan.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// receivedHandler record every webhook request before handing it to the handler
+type receivedHandler struct {
+	http.Handler
+
+	source   string
+	recorder Recorder
+}
+
+// NewReceivedHandler wrap the webhook handler so that every request is recorded as received
+func NewReceivedHandler(handler http.Handler, source string, recorder Recorder) http.Handler {
+	return &receivedHandler{
+		Handler:  handler,
+		source:   source,
+		recorder: recorder,
+	}
+}
+
+func (r *receivedHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	Record(r.recorder, Activity{
+		Action:  Received,
+		Source:  r.source,
+		Message: fmt.Sprintf("%s %s from %s", req.Method, req.URL.Path, req.RemoteAddr),
+	})
+	r.Handler.ServeHTTP(w, req)
+}
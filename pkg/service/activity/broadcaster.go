@@ -0,0 +1,75 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package activity
+
+import (
+	"sync"
+
+	"k8s.io/klog"
+)
+
+// Broadcaster publish every activity to all subscribers
+type Broadcaster struct {
+	subscribers map[int]chan Activity
+	nextID      int
+
+	// mu protects access to the subscribers
+	mu sync.Mutex
+}
+
+// NewBroadcaster
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: map[int]chan Activity{},
+	}
+}
+
+// Record publish the activity, subscribers whose buffer is full miss it
+func (b *Broadcaster) Record(activity Activity) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- activity:
+		default:
+			klog.V(2).Infof("activity subscriber %d is too slow, dropped %s %s", id, activity.Action, activity.EventID)
+		}
+	}
+}
+
+// Subscribe return the channel of activities and the function to cancel the subscription
+func (b *Broadcaster) Subscribe(buffer int) (<-chan Activity, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Activity, buffer)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+}
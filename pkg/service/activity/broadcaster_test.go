@@ -0,0 +1,70 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package activity
+
+import (
+	"testing"
+)
+
+func TestBroadcaster_Record(t *testing.T) {
+	b := NewBroadcaster()
+	slow, cancelSlow := b.Subscribe(1)
+	defer cancelSlow()
+	fast, cancelFast := b.Subscribe(2)
+	defer cancelFast()
+
+	b.Record(Activity{EventID: "1"})
+	b.Record(Activity{EventID: "2"})
+
+	if got := receive(slow); len(got) != 1 || got[0] != "1" {
+		t.Errorf("slow subscriber received %v, want [1]", got)
+	}
+	if got := receive(fast); len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("fast subscriber received %v, want [1 2]", got)
+	}
+}
+
+func TestBroadcaster_Subscribe(t *testing.T) {
+	b := NewBroadcaster()
+	ch, cancel := b.Subscribe(1)
+
+	cancel()
+	// cancel twice should not panic
+	cancel()
+	// record after cancel should not send on the closed channel
+	b.Record(Activity{EventID: "1"})
+
+	if _, ok := <-ch; ok {
+		t.Errorf("channel should be closed after cancel")
+	}
+	if len(b.subscribers) != 0 {
+		t.Errorf("subscribers should be empty after cancel, got %d", len(b.subscribers))
+	}
+}
+
+// receive return the event ids in the buffer of the channel
+func receive(ch <-chan Activity) []string {
+	var ids []string
+	for {
+		select {
+		case a := <-ch:
+			ids = append(ids, a.EventID)
+		default:
+			return ids
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package activity
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistoryCapacity = 500
+)
+
+// EventRecord an event and all the activities it caused
+type EventRecord struct {
+	ID         string     `json:"id"`
+	Time       time.Time  `json:"time"`
+	Source     string     `json:"source,omitempty"`
+	Namespace  string     `json:"namespace,omitempty"`
+	Image      string     `json:"image,omitempty"`
+	Activities []Activity `json:"activities"`
+}
+
+// History keeps the most recent event records in memory
+type History struct {
+	capacity int
+
+	// records ordered from oldest to newest
+	records []*EventRecord
+	index   map[string]*EventRecord
+
+	mu sync.RWMutex
+}
+
+// NewHistory create a history, capacity <= 0 means the default capacity
+func NewHistory(capacity int) *History {
+	if capacity <= 0 {
+		capacity = defaultHistoryCapacity
+	}
+	return &History{
+		capacity: capacity,
+		index:    map[string]*EventRecord{},
+	}
+}
+
+func (h *History) Record(activity Activity) {
+	// webhook requests are not events, the events they produce are recorded as queued
+	if activity.Action == Received {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	record, ok := h.index[activity.EventID]
+	if !ok {
+		record = &EventRecord{
+			ID:        activity.EventID,
+			Time:      activity.Time,
+			Source:    activity.Source,
+			Namespace: activity.Namespace,
+			Image:     activity.Image,
+		}
+		h.records = append(h.records, record)
+		h.index[record.ID] = record
+
+		if len(h.records) > h.capacity {
+			delete(h.index, h.records[0].ID)
+			h.records = h.records[1:]
+		}
+	}
+	record.Activities = append(record.Activities, activity)
+}
+
+// List return the records from newest to oldest, skipping offset records
+func (h *History) List(offset, limit int) (total int, records []EventRecord) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	total = len(h.records)
+	for i := total - 1 - offset; i >= 0 && len(records) < limit; i-- {
+		records = append(records, h.records[i].copy())
+	}
+	return total, records
+}
+
+// Get return the record of the event
+func (h *History) Get(id string) (EventRecord, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	record, ok := h.index[id]
+	if !ok {
+		return EventRecord{}, false
+	}
+	return record.copy(), true
+}
+
+func (r *EventRecord) copy() EventRecord {
+	c := *r
+	c.Activities = append([]Activity(nil), r.Activities...)
+	return c
+}
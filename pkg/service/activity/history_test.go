@@ -0,0 +1,97 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package activity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistory_List(t *testing.T) {
+	type args struct {
+		offset int
+		limit  int
+	}
+	tests := []struct {
+		name      string
+		capacity  int
+		eventIDs  []string
+		args      args
+		wantTotal int
+		wantIDs   []string
+	}{
+		{
+			name:      "newest first",
+			capacity:  10,
+			eventIDs:  []string{"1", "2", "3"},
+			args:      args{offset: 0, limit: 10},
+			wantTotal: 3,
+			wantIDs:   []string{"3", "2", "1"},
+		},
+		{
+			name:      "group by event",
+			capacity:  10,
+			eventIDs:  []string{"1", "2", "1", "2"},
+			args:      args{offset: 0, limit: 10},
+			wantTotal: 2,
+			wantIDs:   []string{"2", "1"},
+		},
+		{
+			name:      "page",
+			capacity:  10,
+			eventIDs:  []string{"1", "2", "3", "4"},
+			args:      args{offset: 1, limit: 2},
+			wantTotal: 4,
+			wantIDs:   []string{"3", "2"},
+		},
+		{
+			name:      "evict oldest",
+			capacity:  2,
+			eventIDs:  []string{"1", "2", "3"},
+			args:      args{offset: 0, limit: 10},
+			wantTotal: 2,
+			wantIDs:   []string{"3", "2"},
+		},
+		{
+			name:      "offset out of range",
+			capacity:  10,
+			eventIDs:  []string{"1"},
+			args:      args{offset: 5, limit: 10},
+			wantTotal: 1,
+			wantIDs:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistory(tt.capacity)
+			for _, id := range tt.eventIDs {
+				Record(h, Activity{EventID: id, Action: Queued})
+			}
+			gotTotal, gotRecords := h.List(tt.args.offset, tt.args.limit)
+			if gotTotal != tt.wantTotal {
+				t.Errorf("List() gotTotal = %v, want %v", gotTotal, tt.wantTotal)
+			}
+			var gotIDs []string
+			for _, record := range gotRecords {
+				gotIDs = append(gotIDs, record.ID)
+			}
+			if !reflect.DeepEqual(gotIDs, tt.wantIDs) {
+				t.Errorf("List() gotIDs = %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package event
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ImageAlias the prefixes which refer to the same images, eg: the push and pull addresses of a registry
+type ImageAlias struct {
+	// Prefix the canonical prefix, a host optionally followed by path segments, eg: registry.example.com
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Aliases the equivalent prefixes, eg: harbor.build.internal, cache.example.com/harbor
+	Aliases []string `json:"aliases" yaml:"aliases"`
+}
+
+type ImageAliasOptions struct {
+	// Aliases the images are compared after the aliases are replaced with the prefixes.
+	// Only configurable through the configuration file
+	Aliases []ImageAlias `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+func (i *ImageAliasOptions) Validate() (errs []error) {
+	aliases := map[string]struct{}{}
+	for _, alias := range i.Aliases {
+		if err := validPrefix(alias.Prefix); err != nil {
+			errs = append(errs, err)
+		}
+		for _, a := range alias.Aliases {
+			if err := validPrefix(a); err != nil {
+				errs = append(errs, err)
+			}
+			if _, ok := aliases[a]; ok {
+				errs = append(errs, fmt.Errorf("duplicate image alias %s", a))
+			}
+			aliases[a] = struct{}{}
+		}
+	}
+	return errs
+}
+
+func NewImageAliasOptions() *ImageAliasOptions {
+	return &ImageAliasOptions{}
+}
+
+// validPrefix 前缀必须以镜像仓库的 host 开头, 并且不包含 tag 和 digest
+func validPrefix(prefix string) error {
+	host := strings.SplitN(prefix, "/", 2)[0]
+	if !IsRegistryHost(host) || strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix[len(host):], ":@") {
+		return fmt.Errorf("image alias %q must be a registry host optionally followed by path segments", prefix)
+	}
+	return nil
+}
+
+// aliasRule 别名 -> 规范的前缀
+type aliasRule struct {
+	alias  string
+	prefix string
+}
+
+// ImageAliases 将镜像中的别名替换为规范的前缀, nil 的 ImageAliases 只补全镜像
+type ImageAliases struct {
+	// rules 按别名的长度倒序, 优先替换最长的前缀
+	rules []aliasRule
+}
+
+// NewImageAliases 没有配置别名时返回 nil
+func NewImageAliases(options *ImageAliasOptions) *ImageAliases {
+	var rules []aliasRule
+	for _, alias := range options.Aliases {
+		for _, a := range alias.Aliases {
+			rules = append(rules, aliasRule{alias: a, prefix: alias.Prefix})
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return len(rules[i].alias) > len(rules[j].alias) })
+	return &ImageAliases{rules: rules}
+}
+
+// Canonical 补全镜像并将别名替换为规范的前缀, 别名只匹配完整的路径:
+// harbor.build.internal/library/web -> registry.example.com/library/web
+// cache.example.com/dockerhub/nginx -> docker.io/library/nginx
+func (a *ImageAliases) Canonical(image string) string {
+	image = NormalizeImage(image)
+	if a == nil {
+		return image
+	}
+	for _, rule := range a.rules {
+		if image == rule.alias || strings.HasPrefix(image, rule.alias+"/") {
+			return NormalizeImage(rule.prefix + image[len(rule.alias):])
+		}
+	}
+	return image
+}
+
+// SameImage 两个镜像替换别名之后是否相同
+func (a *ImageAliases) SameImage(x, y string) bool {
+	return a.Canonical(x) == a.Canonical(y)
+}
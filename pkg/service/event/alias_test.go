@@ -0,0 +1,81 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package event
+
+import "testing"
+
+func TestImageAliases_Canonical(t *testing.T) {
+	aliases := NewImageAliases(&ImageAliasOptions{Aliases: []ImageAlias{
+		{Prefix: "registry.example.com", Aliases: []string{"harbor.build.internal", "10.0.0.1:443"}},
+		{Prefix: "registry.example.com/mirror", Aliases: []string{"harbor.build.internal/mirror"}},
+		{Prefix: "docker.io", Aliases: []string{"cache.example.com/dockerhub"}},
+	}})
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "harbor.build.internal/library/web", want: "registry.example.com/library/web"},
+		{image: "10.0.0.1:443/library/web", want: "registry.example.com/library/web"},
+		{image: "registry.example.com/library/web", want: "registry.example.com/library/web"},
+		{image: "harbor.build.internal/mirror/web", want: "registry.example.com/mirror/web"},
+		{image: "harbor.build.internal.example.com/library/web", want: "harbor.build.internal.example.com/library/web"},
+		{image: "cache.example.com/dockerhub/nginx", want: "docker.io/library/nginx"},
+		{image: "cache.example.com/dockerhub/org/app", want: "docker.io/org/app"},
+		{image: "nginx", want: "docker.io/library/nginx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := aliases.Canonical(tt.image); got != tt.want {
+				t.Errorf("Canonical() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var none *ImageAliases
+	if got := none.Canonical("nginx"); got != "docker.io/library/nginx" {
+		t.Errorf("nil Canonical() = %v, want docker.io/library/nginx", got)
+	}
+}
+
+func TestImageAliasOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		aliases  []ImageAlias
+		wantErrs int
+	}{
+		{name: "valid", aliases: []ImageAlias{{Prefix: "docker.io", Aliases: []string{"cache.example.com/dockerhub", "localhost:5000"}}}},
+		{name: "prefix without host", aliases: []ImageAlias{{Prefix: "library", Aliases: []string{"harbor.build.internal"}}}, wantErrs: 1},
+		{name: "alias with tag", aliases: []ImageAlias{{Prefix: "registry.example.com", Aliases: []string{"harbor.build.internal/web:v1"}}}, wantErrs: 1},
+		{
+			name: "duplicate alias",
+			aliases: []ImageAlias{
+				{Prefix: "registry.example.com", Aliases: []string{"harbor.build.internal"}},
+				{Prefix: "mirror.example.com", Aliases: []string{"harbor.build.internal"}},
+			},
+			wantErrs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &ImageAliasOptions{Aliases: tt.aliases}
+			if errs := options.Validate(); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() errs = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
@@ -24,21 +24,67 @@ import (
 )
 
 type ImageEvent struct {
+	// ID assigned when the event is collected
+	ID    string `json:"id,omitempty"`
 	Image string `json:"image"`
 	Tag   string `json:"tag"`
+	// Source where the event comes from, eg: harbor, github
+	Source string `json:"source,omitempty"`
+	// Namespace if not empty, only the namespace is processed
+	Namespace string `json:"namespace,omitempty"`
+	// Type what happened to the image, empty means the image has been pushed
+	Type EventType `json:"type,omitempty"`
+	// Digest of the artifact, empty if the source does not provide it
+	Digest string `json:"digest,omitempty"`
+	// ArtifactType of the artifact, eg: image, chart, empty if the source does not provide it
+	ArtifactType string `json:"artifactType,omitempty"`
+	// Scan the vulnerability summary of the artifact, nil if it has not been scanned
+	Scan *ScanSummary `json:"scan,omitempty"`
+}
+
+// EventType what happened to the image
+type EventType string
+
+const (
+	// PushEvent a new tag of the image has been pushed
+	PushEvent EventType = "push"
+	// DeleteEvent the tag of the image has been deleted from the repository
+	DeleteEvent EventType = "delete"
+	// ScanEvent the image has been scanned, the workloads are not updated
+	ScanEvent EventType = "scan"
+)
+
+// IsPush 事件是否为 push, 没有 type 的事件都是 push
+func (e ImageEvent) IsPush() bool {
+	return e.Type == "" || e.Type == PushEvent
+}
+
+// Artifact 制品的类型, 来源未提供或为镜像时由 tag 的约定得出, cosign 的签名等同样是镜像格式
+func (e ImageEvent) Artifact() string {
+	if e.ArtifactType != "" && e.ArtifactType != ImageArtifact {
+		return e.ArtifactType
+	}
+	return ArtifactTypeOf(e.Tag)
 }
 
 func (e ImageEvent) String() string {
 	return fmt.Sprintf("%s:%s", e.Image, e.Tag)
 }
 
+// OfImageEvent 解析镜像, 以 digest 固定的镜像 (repo:tag@sha256:...) 的 digest 保存在 Digest 中, 只有 digest 时 tag 为空
 func OfImageEvent(image string) ImageEvent {
 	imageEvent := ImageEvent{
 		Image: image,
 		Tag:   "latest",
 	}
-	if strings.Contains(image, ":") {
-		index := strings.LastIndex(image, ":")
+	if index := strings.Index(image, "@"); index >= 0 {
+		imageEvent.Digest = image[index+1:]
+		imageEvent.Tag = ""
+		image = image[:index]
+		imageEvent.Image = image
+	}
+	// 只有最后一个 / 之后的 : 才是 tag 的分隔符, 之前的是镜像仓库的端口
+	if index := strings.LastIndex(image, ":"); index > strings.LastIndex(image, "/") {
 		imageEvent.Image = image[:index]
 		imageEvent.Tag = image[index+1:]
 	}
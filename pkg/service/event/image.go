@@ -0,0 +1,98 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package event
+
+import "strings"
+
+const (
+	// DockerHubHost docker hub 镜像的 host
+	DockerHubHost = "docker.io"
+
+	legacyDockerHubHost = "index.docker.io"
+	officialRepository  = "library"
+)
+
+// NormalizeImage 将不带 tag 的镜像补全为完整的写法, 与 docker 的规则一致:
+// nginx -> docker.io/library/nginx
+// org/app -> docker.io/org/app
+// index.docker.io/org/app -> docker.io/org/app
+// 其他镜像仓库的镜像保持原样
+func NormalizeImage(image string) string {
+	index := strings.Index(image, "/")
+	if index < 0 || !IsRegistryHost(image[:index]) {
+		image = DockerHubHost + "/" + image
+	} else if image[:index] == legacyDockerHubHost {
+		image = DockerHubHost + image[index:]
+	}
+
+	if strings.HasPrefix(image, DockerHubHost+"/") && !strings.Contains(image[len(DockerHubHost)+1:], "/") {
+		image = DockerHubHost + "/" + officialRepository + image[len(DockerHubHost):]
+	}
+	return image
+}
+
+// SameImage 两个镜像补全之后是否相同
+func SameImage(a, b string) bool {
+	return NormalizeImage(a) == NormalizeImage(b)
+}
+
+// PinDigest 将镜像固定为 digest, 保留 tag 以便阅读, 例如: web:v1 -> web:v1@sha256:...
+func PinDigest(image, digest string) string {
+	if index := strings.Index(image, "@"); index >= 0 {
+		image = image[:index]
+	}
+	return image + "@" + digest
+}
+
+// IsRegistryHost 镜像的第一段包含 . 或 : 或者为 localhost 时是镜像仓库的 host
+func IsRegistryHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
+
+// 制品的类型, 由事件来源提供或 tag 的约定得出
+const (
+	// ImageArtifact 镜像
+	ImageArtifact = "image"
+	// SignatureArtifact cosign 签名, tag 为 sha256-<hex>.sig
+	SignatureArtifact = "signature"
+	// AttestationArtifact cosign 证明, tag 为 sha256-<hex>.att
+	AttestationArtifact = "attestation"
+	// SBOMArtifact cosign 上传的 sbom, tag 为 sha256-<hex>.sbom
+	SBOMArtifact = "sbom"
+	// ChartArtifact helm chart, 只能由事件来源提供, 如 harbor 的 artifact 类型
+	ChartArtifact = "chart"
+)
+
+// artifactTagSuffixes 与镜像使用同一 repository 的制品的 tag 后缀
+var artifactTagSuffixes = map[string]string{
+	".sig":  SignatureArtifact,
+	".att":  AttestationArtifact,
+	".sbom": SBOMArtifact,
+}
+
+// ArtifactTypeOf tag 对应的制品类型, 不符合约定的 tag 都是镜像
+func ArtifactTypeOf(tag string) string {
+	if !strings.HasPrefix(tag, "sha256-") {
+		return ImageArtifact
+	}
+	for suffix, artifactType := range artifactTagSuffixes {
+		if strings.HasSuffix(tag, suffix) {
+			return artifactType
+		}
+	}
+	return ImageArtifact
+}
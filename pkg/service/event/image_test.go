@@ -0,0 +1,85 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package event
+
+import "testing"
+
+func TestNormalizeImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "nginx", want: "docker.io/library/nginx"},
+		{image: "library/nginx", want: "docker.io/library/nginx"},
+		{image: "org/app", want: "docker.io/org/app"},
+		{image: "docker.io/nginx", want: "docker.io/library/nginx"},
+		{image: "docker.io/org/app", want: "docker.io/org/app"},
+		{image: "index.docker.io/org/app", want: "docker.io/org/app"},
+		{image: "quay.io/org/app", want: "quay.io/org/app"},
+		{image: "localhost/app", want: "localhost/app"},
+		{image: "registry.example.com:5000/project/web", want: "registry.example.com:5000/project/web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := NormalizeImage(tt.image); got != tt.want {
+				t.Errorf("NormalizeImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOfImageEvent(t *testing.T) {
+	tests := []struct {
+		image string
+		want  ImageEvent
+	}{
+		{image: "nginx", want: ImageEvent{Image: "nginx", Tag: "latest"}},
+		{image: "nginx:1.19", want: ImageEvent{Image: "nginx", Tag: "1.19"}},
+		{image: "localhost:5000/web", want: ImageEvent{Image: "localhost:5000/web", Tag: "latest"}},
+		{image: "localhost:5000/web:v1", want: ImageEvent{Image: "localhost:5000/web", Tag: "v1"}},
+		{image: "localhost:5000/web:v1@sha256:3f1a", want: ImageEvent{Image: "localhost:5000/web", Tag: "v1", Digest: "sha256:3f1a"}},
+		{image: "localhost:5000/web@sha256:3f1a", want: ImageEvent{Image: "localhost:5000/web", Digest: "sha256:3f1a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := OfImageEvent(tt.image); got != tt.want {
+				t.Errorf("OfImageEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArtifactTypeOf(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{tag: "v1.0.0", want: ImageArtifact},
+		{tag: "sha256-3f1a.sig", want: SignatureArtifact},
+		{tag: "sha256-3f1a.att", want: AttestationArtifact},
+		{tag: "sha256-3f1a.sbom", want: SBOMArtifact},
+		{tag: "release.sig", want: ImageArtifact},
+		{tag: "sha256-3f1a", want: ImageArtifact},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := ArtifactTypeOf(tt.tag); got != tt.want {
+				t.Errorf("ArtifactTypeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
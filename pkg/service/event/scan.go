@@ -0,0 +1,62 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package event
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ScanStatus result of the vulnerability scan
+type ScanStatus string
+
+const (
+	ScanSuccess ScanStatus = "Success"
+	ScanFailed  ScanStatus = "Failed"
+)
+
+// ScanSummary the vulnerability summary of the artifact reported by the image repository
+type ScanSummary struct {
+	Status ScanStatus `json:"status"`
+	// Severity the highest severity of the vulnerabilities, eg: Critical, High
+	Severity string `json:"severity,omitempty"`
+	Total    int    `json:"total"`
+	Fixable  int    `json:"fixable"`
+	// Summary the number of the vulnerabilities by severity
+	Summary map[string]int `json:"summary,omitempty"`
+	// Scanner eg: Trivy
+	Scanner string `json:"scanner,omitempty"`
+}
+
+func (s ScanSummary) String() string {
+	if s.Status != ScanSuccess {
+		return fmt.Sprintf("scan %s", strings.ToLower(string(s.Status)))
+	}
+	if s.Total == 0 {
+		return "no vulnerabilities"
+	}
+
+	severities := make([]string, 0, len(s.Summary))
+	for severity, count := range s.Summary {
+		if count > 0 {
+			severities = append(severities, fmt.Sprintf("%s %d", severity, count))
+		}
+	}
+	sort.Strings(severities)
+	return fmt.Sprintf("%d vulnerabilities (%s), %d fixable", s.Total, strings.Join(severities, ", "), s.Fixable)
+}
@@ -0,0 +1,86 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package filter
+
+import (
+	"context"
+	"strings"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"k8s.io/klog"
+)
+
+// filteredImageEventCollect 丢弃不允许的镜像事件, 例如 cosign 的签名
+type filteredImageEventCollect struct {
+	eventservice.ImageEventCollect
+
+	filter *Filter
+}
+
+// NewFilteredImageEventCollect filter 为 nil 时直接返回 collect
+func NewFilteredImageEventCollect(collect eventservice.ImageEventCollect, filter *Filter) eventservice.ImageEventCollect {
+	if filter == nil {
+		return collect
+	}
+	return &filteredImageEventCollect{
+		ImageEventCollect: collect,
+		filter:            filter,
+	}
+}
+
+func (f *filteredImageEventCollect) Collect(event eventservice.ImageEvent) {
+	if ok, reason := f.filter.AllowEvent(event); !ok {
+		klog.V(2).Infof("Image event %s from %s is filtered: %s", event, event.Source, reason)
+		return
+	}
+	f.ImageEventCollect.Collect(event)
+}
+
+// filteredRepositoryService 查询最新 tag 时只选择允许的 tag
+type filteredRepositoryService struct {
+	repositoryservice.RepositoryService
+
+	filter *Filter
+}
+
+// NewFilteredRepositoryService filter 为 nil 时直接返回 service
+func NewFilteredRepositoryService(service repositoryservice.RepositoryService, filter *Filter) repositoryservice.RepositoryService {
+	if filter == nil {
+		return service
+	}
+	return &filteredRepositoryService{
+		RepositoryService: service,
+		filter:            filter,
+	}
+}
+
+func (f *filteredRepositoryService) LatestTag(ctx context.Context, host, projectName, repoName string,
+	opts ...repositoryservice.LookupOption) (string, error) {
+	var parts []string
+	for _, part := range []string{host, projectName, repoName} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	repository := strings.Join(parts, "/")
+	opts = append(opts, repositoryservice.WithTagFilter(func(tag string) bool {
+		ok, _ := f.filter.Allow(repository, tag)
+		return ok
+	}))
+	return f.RepositoryService.LatestTag(ctx, host, projectName, repoName, opts...)
+}
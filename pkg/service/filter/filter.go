@@ -0,0 +1,174 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+// rule 编译之后的规则, 为 nil 的正则匹配所有值
+type rule struct {
+	source       Rule
+	repository   *regexp.Regexp
+	tag          *regexp.Regexp
+	artifactType string
+}
+
+func compile(source Rule) (*rule, error) {
+	if source.Repository == "" && source.Tag == "" && source.ArtifactType == "" {
+		return nil, fmt.Errorf("filter rule must have at least one of repository, tag, artifactType")
+	}
+	if err := validArtifactType(source.ArtifactType); err != nil {
+		return nil, err
+	}
+	r := &rule{source: source, artifactType: source.ArtifactType}
+	var err error
+	if r.repository, err = compilePattern(source.Repository, source.Regex); err != nil {
+		return nil, fmt.Errorf("invalid filter repository %q: %v", source.Repository, err)
+	}
+	if r.tag, err = compilePattern(source.Tag, source.Regex); err != nil {
+		return nil, fmt.Errorf("invalid filter tag %q: %v", source.Tag, err)
+	}
+	return r, nil
+}
+
+// compilePattern 将 glob 或正则编译为匹配整个值的正则
+func compilePattern(pattern string, regex bool) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if !regex {
+		pattern = globToRegexp(pattern)
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// CompileGlob 将 glob 编译为匹配整个值的正则, 与过滤规则的写法一致
+func CompileGlob(glob string) (*regexp.Regexp, error) {
+	return compilePattern(glob, false)
+}
+
+// globToRegexp ** 匹配任意字符, * 和 ? 不匹配 /
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+func (r *rule) match(repository, tag, artifactType string) bool {
+	if r.repository != nil && !r.repository.MatchString(repository) {
+		return false
+	}
+	if r.tag != nil && !r.tag.MatchString(tag) {
+		return false
+	}
+	return r.artifactType == "" || r.artifactType == artifactType
+}
+
+func (r *rule) String() string {
+	var parts []string
+	if r.source.Repository != "" {
+		parts = append(parts, "repository="+r.source.Repository)
+	}
+	if r.source.Tag != "" {
+		parts = append(parts, "tag="+r.source.Tag)
+	}
+	if r.source.ArtifactType != "" {
+		parts = append(parts, "artifactType="+r.source.ArtifactType)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Filter 全局的 repository 和 tag 过滤规则, 在镜像事件分发之前以及查询最新 tag 时生效
+type Filter struct {
+	imagesOnly bool
+	include    []*rule
+	exclude    []*rule
+}
+
+// NewFilter 没有任何规则时返回 nil, nil 的 Filter 允许所有的镜像
+func NewFilter(options *FilterOptions) (*Filter, error) {
+	if !options.ImagesOnly && len(options.Include) == 0 && len(options.Exclude) == 0 {
+		return nil, nil
+	}
+	f := &Filter{imagesOnly: options.ImagesOnly}
+	for _, source := range options.Include {
+		r, err := compile(source)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, r)
+	}
+	for _, source := range options.Exclude {
+		r, err := compile(source)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, r)
+	}
+	return f, nil
+}
+
+// Allow 镜像的 tag 是否被处理, 不允许时返回原因. repository 为不带 tag 的镜像, 比较之前会补全
+func (f *Filter) Allow(repository, tag string) (bool, string) {
+	return f.allow(repository, tag, eventservice.ArtifactTypeOf(tag))
+}
+
+// AllowEvent 与 Allow 相同, 优先使用事件来源提供的制品类型
+func (f *Filter) AllowEvent(event eventservice.ImageEvent) (bool, string) {
+	return f.allow(event.Image, event.Tag, event.Artifact())
+}
+
+func (f *Filter) allow(repository, tag, artifactType string) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	repository = eventservice.NormalizeImage(repository)
+	if f.imagesOnly && artifactType != eventservice.ImageArtifact {
+		return false, fmt.Sprintf("%s is not an image", artifactType)
+	}
+	for _, r := range f.exclude {
+		if r.match(repository, tag, artifactType) {
+			return false, fmt.Sprintf("excluded by %s", r)
+		}
+	}
+	if len(f.include) == 0 {
+		return true, ""
+	}
+	for _, r := range f.include {
+		if r.match(repository, tag, artifactType) {
+			return true, ""
+		}
+	}
+	return false, "not included"
+}
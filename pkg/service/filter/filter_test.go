@@ -0,0 +1,263 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package filter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/simple/client/registry/registrytest"
+)
+
+func TestFilter_Allow(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    FilterOptions
+		repository string
+		tag        string
+		want       bool
+	}{
+		{name: "images only", options: FilterOptions{ImagesOnly: true}, repository: "nginx", tag: "1.19", want: true},
+		{name: "signature", options: FilterOptions{ImagesOnly: true}, repository: "nginx", tag: "sha256-3f1a.sig"},
+		{name: "attestation", options: FilterOptions{ImagesOnly: true}, repository: "nginx", tag: "sha256-3f1a.att"},
+		{name: "signature allowed", repository: "nginx", tag: "sha256-3f1a.sig", want: true,
+			options: FilterOptions{Exclude: []Rule{{Tag: "buildcache"}}}},
+		{
+			name:       "exclude tag glob",
+			options:    FilterOptions{Exclude: []Rule{{Tag: "buildcache-*"}}},
+			repository: "harbor.example.com/library/web",
+			tag:        "buildcache-amd64",
+		},
+		{
+			name:       "exclude repository glob",
+			options:    FilterOptions{Exclude: []Rule{{Repository: "harbor.example.com/**/cache"}}},
+			repository: "harbor.example.com/library/web/cache",
+			tag:        "v1",
+		},
+		{
+			name:       "glob does not cross segments",
+			options:    FilterOptions{Exclude: []Rule{{Repository: "harbor.example.com/*/cache"}}},
+			repository: "harbor.example.com/library/web/cache",
+			tag:        "v1",
+			want:       true,
+		},
+		{
+			name:       "repository is normalized",
+			options:    FilterOptions{Exclude: []Rule{{Repository: "docker.io/library/*"}}},
+			repository: "nginx",
+			tag:        "1.19",
+		},
+		{
+			name:       "regex",
+			options:    FilterOptions{Exclude: []Rule{{Tag: `v\d+-rc\d*`, Regex: true}}},
+			repository: "web",
+			tag:        "v1-rc2",
+		},
+		{
+			name:       "regex matches the whole tag",
+			options:    FilterOptions{Exclude: []Rule{{Tag: `v\d+`, Regex: true}}},
+			repository: "web",
+			tag:        "v1-rc2",
+			want:       true,
+		},
+		{
+			name:       "included",
+			options:    FilterOptions{Include: []Rule{{Repository: "harbor.example.com/**"}}},
+			repository: "harbor.example.com/library/web",
+			tag:        "v1",
+			want:       true,
+		},
+		{
+			name:       "not included",
+			options:    FilterOptions{Include: []Rule{{Repository: "harbor.example.com/**"}}},
+			repository: "nginx",
+			tag:        "1.19",
+		},
+		{
+			name: "exclude takes precedence",
+			options: FilterOptions{
+				Include: []Rule{{Repository: "harbor.example.com/**"}},
+				Exclude: []Rule{{Repository: "harbor.example.com/charts/**"}},
+			},
+			repository: "harbor.example.com/charts/web",
+			tag:        "0.1.0",
+		},
+		{
+			name:       "artifact type",
+			options:    FilterOptions{Exclude: []Rule{{Repository: "harbor.example.com/**", ArtifactType: eventservice.SignatureArtifact}}},
+			repository: "harbor.example.com/library/web",
+			tag:        "sha256-3f1a.sig",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(&tt.options)
+			if err != nil {
+				t.Fatalf("NewFilter() err = %v", err)
+			}
+			if got, reason := f.Allow(tt.repository, tt.tag); got != tt.want {
+				t.Errorf("Allow() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_AllowEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		options FilterOptions
+		event   eventservice.ImageEvent
+		want    bool
+	}{
+		{
+			name:    "chart",
+			options: FilterOptions{ImagesOnly: true},
+			event:   eventservice.ImageEvent{Image: "harbor.example.com/charts/web", Tag: "0.1.0", ArtifactType: eventservice.ChartArtifact},
+		},
+		{
+			name:    "chart excluded",
+			options: FilterOptions{Exclude: []Rule{{ArtifactType: eventservice.ChartArtifact}}},
+			event:   eventservice.ImageEvent{Image: "harbor.example.com/charts/web", Tag: "0.1.0", ArtifactType: eventservice.ChartArtifact},
+		},
+		{
+			name:    "chart included",
+			options: FilterOptions{Include: []Rule{{ArtifactType: eventservice.ChartArtifact}}},
+			event:   eventservice.ImageEvent{Image: "harbor.example.com/charts/web", Tag: "0.1.0", ArtifactType: eventservice.ChartArtifact},
+			want:    true,
+		},
+		{
+			name:    "image excluded as chart",
+			options: FilterOptions{Exclude: []Rule{{ArtifactType: eventservice.ChartArtifact}}},
+			event:   eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "0.1.0", ArtifactType: eventservice.ImageArtifact},
+			want:    true,
+		},
+		{
+			name:    "signature reported as image",
+			options: FilterOptions{ImagesOnly: true},
+			event:   eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "sha256-3f1a.sig", ArtifactType: eventservice.ImageArtifact},
+		},
+		{
+			name:    "without artifact type",
+			options: FilterOptions{ImagesOnly: true},
+			event:   eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v1"},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFilter(&tt.options)
+			if err != nil {
+				t.Fatalf("NewFilter() err = %v", err)
+			}
+			if got, reason := f.AllowEvent(tt.event); got != tt.want {
+				t.Errorf("AllowEvent() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []Rule
+		wantErrs int
+	}{
+		{name: "valid", rules: []Rule{{Repository: "docker.io/**"}, {Tag: "^v", Regex: true}, {ArtifactType: eventservice.SBOMArtifact},
+			{ArtifactType: eventservice.ChartArtifact}}},
+		{name: "empty rule", rules: []Rule{{}}, wantErrs: 1},
+		{name: "invalid regex", rules: []Rule{{Tag: "v(", Regex: true}}, wantErrs: 1},
+		{name: "unknown artifact type", rules: []Rule{{ArtifactType: "cnab"}}, wantErrs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewFilterOptions()
+			options.Exclude = tt.rules
+			if errs := options.Validate(); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() errs = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+type collected struct {
+	eventservice.ImageEventCollect
+
+	events []eventservice.ImageEvent
+}
+
+func (c *collected) Collect(event eventservice.ImageEvent) {
+	c.events = append(c.events, event)
+}
+
+func Test_filteredImageEventCollect_Collect(t *testing.T) {
+	f, _ := NewFilter(&FilterOptions{ImagesOnly: true, Exclude: []Rule{{Tag: "buildcache"}}})
+	inner := &collected{}
+	collect := NewFilteredImageEventCollect(inner, f)
+
+	collect.Collect(eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "v2"})
+	collect.Collect(eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "sha256-3f1a.sig"})
+	collect.Collect(eventservice.ImageEvent{Image: "harbor.example.com/library/web", Tag: "buildcache"})
+	collect.Collect(eventservice.ImageEvent{Image: "harbor.example.com/charts/web", Tag: "0.1.0", ArtifactType: eventservice.ChartArtifact})
+
+	want := []eventservice.ImageEvent{{Image: "harbor.example.com/library/web", Tag: "v2"}}
+	if !reflect.DeepEqual(inner.events, want) {
+		t.Errorf("Collect() collected = %v, want %v", inner.events, want)
+	}
+}
+
+func Test_filteredRepositoryService_LatestTag(t *testing.T) {
+	base := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	r := registrytest.NewRegistry()
+	defer r.Close()
+	r.PushImage("project/web", "v1", base)
+	r.PushImage("project/web", "v2", base.Add(time.Hour))
+	r.PushImage("project/web", "buildcache", base.Add(2*time.Hour))
+
+	options := repositoryservice.NewRepositoryServiceOptions()
+	options.Registries = []repositoryservice.RegistryOptions{{Type: repositoryservice.RegistryType, Endpoint: r.URL}}
+	service, err := repositoryservice.NewRepositoryService(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options FilterOptions
+		wantTag string
+	}{
+		{name: "no rules", wantTag: "buildcache"},
+		{name: "exclude build cache", options: FilterOptions{Exclude: []Rule{{Tag: "buildcache"}}}, wantTag: "v2"},
+		{name: "exclude repository", options: FilterOptions{Exclude: []Rule{{Repository: r.Host() + "/project/*", Tag: "v2"}, {Tag: "buildcache"}}},
+			wantTag: "v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _ := NewFilter(&tt.options)
+			tag, err := NewFilteredRepositoryService(service, f).LatestTag(context.Background(), r.Host(), "project", "web")
+			if err != nil {
+				t.Fatalf("LatestTag() err = %v", err)
+			}
+			if tag != tt.wantTag {
+				t.Errorf("LatestTag() = %v, want %v", tag, tt.wantTag)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package filter
+
+import (
+	"fmt"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/spf13/pflag"
+)
+
+// Rule matches the repositories and tags, the empty fields match everything
+type Rule struct {
+	// Repository glob of the repository with the host, eg: docker.io/library/*, harbor.example.com/**/cache.
+	// * matches a path segment, ** matches any segments
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+	// Tag glob of the tag, eg: buildcache-*
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	// ArtifactType optional: image; signature; attestation; sbom; chart
+	ArtifactType string `json:"artifactType,omitempty" yaml:"artifactType,omitempty"`
+	// Regex Repository and Tag are regular expressions matching the whole value instead of globs
+	Regex bool `json:"regex,omitempty" yaml:"regex,omitempty"`
+}
+
+type FilterOptions struct {
+	// ImagesOnly ignore the signatures, attestations and sboms pushed along with the images, eg: sha256-<hex>.sig of cosign
+	ImagesOnly bool `json:"imagesOnly" yaml:"imagesOnly"`
+	// Include only the repositories and tags matching one of the rules are processed, empty includes everything.
+	// Only configurable through the configuration file
+	Include []Rule `json:"include,omitempty" yaml:"include,omitempty"`
+	// Exclude the repositories and tags matching one of the rules are ignored, it takes precedence over Include.
+	// Only configurable through the configuration file
+	Exclude []Rule `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+func (f *FilterOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&f.ImagesOnly, "filter-images-only", f.ImagesOnly, "ignore the signatures, attestations and sboms pushed along with the images, "+
+		"eg: the tag sha256-<hex>.sig of cosign, in the image events and the latest tag lookups")
+}
+
+func (f *FilterOptions) Validate() (errs []error) {
+	for _, rules := range [][]Rule{f.Include, f.Exclude} {
+		for _, rule := range rules {
+			if _, err := compile(rule); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+func NewFilterOptions() *FilterOptions {
+	return &FilterOptions{
+		ImagesOnly: true,
+	}
+}
+
+// validArtifactType the artifact types of the rules
+func validArtifactType(artifactType string) error {
+	switch artifactType {
+	case "", eventservice.ImageArtifact, eventservice.SignatureArtifact, eventservice.AttestationArtifact, eventservice.SBOMArtifact,
+		eventservice.ChartArtifact:
+		return nil
+	}
+	return fmt.Errorf("filter artifact type only support %s, %s, %s, %s, %s", eventservice.ImageArtifact, eventservice.SignatureArtifact,
+		eventservice.AttestationArtifact, eventservice.SBOMArtifact, eventservice.ChartArtifact)
+}
@@ -0,0 +1,92 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/arugal/laborer/pkg/service/filter"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// AllowAction the namespaces without any rule accept the events of every repository
+	AllowAction = "allow"
+	// DenyAction the namespaces without any rule accept no event
+	DenyAction = "deny"
+)
+
+// PolicyRule the repositories which may update the workloads of the namespaces
+type PolicyRule struct {
+	// Namespaces globs of the namespace names, eg: team-a-*
+	Namespaces []string `json:"namespaces" yaml:"namespaces"`
+	// Repositories globs of the repositories with the host, after the image aliases are replaced,
+	// eg: harbor.example.com/team-a/** for the project team-a
+	Repositories []string `json:"repositories" yaml:"repositories"`
+}
+
+type ImageEventPolicyOptions struct {
+	// Default what happens to the namespaces without any rule or annotation, optional: allow; deny
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+	// Rules only configurable through the configuration file, the namespace annotation is added to the rules
+	Rules []PolicyRule `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+func (i *ImageEventPolicyOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&i.Default, "image-event-policy-default", i.Default, "what happens to the image events of the namespaces without any policy rule or "+
+		RepositoriesAnnotation+" annotation, optional: allow, deny")
+}
+
+func (i *ImageEventPolicyOptions) Validate() (errs []error) {
+	if i.Default != AllowAction && i.Default != DenyAction {
+		errs = append(errs, fmt.Errorf("image event policy default only support %s, %s", AllowAction, DenyAction))
+	}
+	for _, rule := range i.Rules {
+		if len(rule.Namespaces) == 0 || len(rule.Repositories) == 0 {
+			errs = append(errs, fmt.Errorf("image event policy rule must have namespaces and repositories"))
+			continue
+		}
+		if _, err := compileRule(rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func NewImageEventPolicyOptions() *ImageEventPolicyOptions {
+	return &ImageEventPolicyOptions{
+		Default: AllowAction,
+	}
+}
+
+// compileGlobs 编译 namespace 或 repository 的 glob
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, glob := range globs {
+		if glob = strings.TrimSpace(glob); glob == "" {
+			continue
+		}
+		re, err := filter.CompileGlob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image event policy glob %q: %v", glob, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
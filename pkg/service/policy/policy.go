@@ -0,0 +1,158 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// RepositoriesAnnotation namespace 的 annotation, 逗号分隔的 repository glob, 与配置的规则一起决定可以更新该 namespace 的镜像
+const RepositoriesAnnotation = "laborer.image-event.repositories"
+
+// deniedTotal 被策略拒绝的匹配, 同一事件匹配多个工作负载时分别计数
+var deniedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "laborer_image_event_denied_total",
+	Help: "Number of the workloads matched by an image event but denied by the image event policy",
+}, []string{"namespace", "source"})
+
+func init() {
+	metrics.Registry.MustRegister(deniedTotal)
+}
+
+// Authorizer 决定镜像事件能否更新 namespace 中的工作负载
+type Authorizer interface {
+	// Authorize 不允许时返回原因并计数
+	Authorize(namespace string, event eventservice.ImageEvent) (bool, string)
+}
+
+// rule 编译之后的 PolicyRule
+type rule struct {
+	namespaces   []*regexp.Regexp
+	repositories []*regexp.Regexp
+}
+
+func compileRule(source PolicyRule) (*rule, error) {
+	namespaces, err := compileGlobs(source.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+	repositories, err := compileGlobs(source.Repositories)
+	if err != nil {
+		return nil, err
+	}
+	return &rule{namespaces: namespaces, repositories: repositories}, nil
+}
+
+type imageEventPolicy struct {
+	deny  bool
+	rules []*rule
+
+	namespaceLister listerv1.NamespaceLister
+	aliases         *eventservice.ImageAliases
+}
+
+// NewImageEventPolicy namespaceLister 用于读取 namespace 的 annotation, 镜像替换 aliases 之后再匹配
+func NewImageEventPolicy(options *ImageEventPolicyOptions, namespaceLister listerv1.NamespaceLister,
+	aliases *eventservice.ImageAliases) (Authorizer, error) {
+	p := &imageEventPolicy{
+		deny:            options.Default == DenyAction,
+		namespaceLister: namespaceLister,
+		aliases:         aliases,
+	}
+	for _, source := range options.Rules {
+		r, err := compileRule(source)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, r)
+	}
+	return p, nil
+}
+
+func (p *imageEventPolicy) Authorize(namespace string, event eventservice.ImageEvent) (bool, string) {
+	// 指定 namespace 的事件来自管理 API, 已经通过 RBAC 授权
+	if event.Namespace != "" {
+		return true, ""
+	}
+	allowed, reason := p.authorize(namespace, p.aliases.Canonical(event.Image))
+	if !allowed {
+		deniedTotal.WithLabelValues(namespace, event.Source).Inc()
+	}
+	return allowed, reason
+}
+
+func (p *imageEventPolicy) authorize(namespace, repository string) (bool, string) {
+	repositories, err := p.repositories(namespace)
+	if err != nil {
+		return false, err.Error()
+	}
+	if len(repositories) == 0 {
+		if p.deny {
+			return false, fmt.Sprintf("namespace %s has no image event policy", namespace)
+		}
+		return true, ""
+	}
+	for _, re := range repositories {
+		if re.MatchString(repository) {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("repository %s may not update namespace %s", repository, namespace)
+}
+
+// repositories 配置的规则以及 namespace 的 annotation 允许的 repository
+func (p *imageEventPolicy) repositories(namespace string) ([]*regexp.Regexp, error) {
+	var repositories []*regexp.Regexp
+	for _, r := range p.rules {
+		for _, re := range r.namespaces {
+			if re.MatchString(namespace) {
+				repositories = append(repositories, r.repositories...)
+				break
+			}
+		}
+	}
+
+	if p.namespaceLister == nil {
+		return repositories, nil
+	}
+	ns, err := p.namespaceLister.Get(namespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return repositories, nil
+		}
+		klog.Errorf("get namespace %s err: %v", namespace, err)
+		return nil, fmt.Errorf("get namespace %s err: %v", namespace, err)
+	}
+	if value := ns.Annotations[RepositoriesAnnotation]; value != "" {
+		// annotation 无效时拒绝, 以免放开所有的镜像
+		annotated, err := compileGlobs(strings.Split(value, ","))
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s annotation %s: %v", namespace, RepositoriesAnnotation, err)
+		}
+		repositories = append(repositories, annotated...)
+	}
+	return repositories, nil
+}
@@ -0,0 +1,107 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package policy
+
+import (
+	"testing"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_imageEventPolicy_Authorize(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	_ = indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	_ = indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b",
+		Annotations: map[string]string{RepositoriesAnnotation: "harbor.example.com/team-b/**, docker.io/library/*"}}})
+	_ = indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "invalid",
+		Annotations: map[string]string{RepositoriesAnnotation: "harbor.example.com/[team"}}})
+	_ = indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}})
+	lister := listerv1.NewNamespaceLister(indexer)
+	aliases := eventservice.NewImageAliases(&eventservice.ImageAliasOptions{Aliases: []eventservice.ImageAlias{
+		{Prefix: "harbor.example.com", Aliases: []string{"harbor.build.internal"}},
+	}})
+	rules := []PolicyRule{{Namespaces: []string{"team-a*"}, Repositories: []string{"harbor.example.com/team-a/**"}}}
+
+	tests := []struct {
+		name        string
+		defaultDeny bool
+		namespace   string
+		event       eventservice.ImageEvent
+		want        bool
+	}{
+		{name: "rule", namespace: "team-a", event: eventservice.ImageEvent{Image: "harbor.example.com/team-a/web"}, want: true},
+		{name: "alias", namespace: "team-a", event: eventservice.ImageEvent{Image: "harbor.build.internal/team-a/web"}, want: true},
+		{name: "other project", namespace: "team-a", event: eventservice.ImageEvent{Image: "harbor.example.com/team-b/web"}},
+		{name: "annotation", namespace: "team-b", event: eventservice.ImageEvent{Image: "harbor.example.com/team-b/web"}, want: true},
+		{name: "annotation normalized", namespace: "team-b", event: eventservice.ImageEvent{Image: "nginx"}, want: true},
+		{name: "annotation other project", namespace: "team-b", event: eventservice.ImageEvent{Image: "harbor.example.com/team-a/web"}},
+		{name: "invalid annotation", namespace: "invalid", event: eventservice.ImageEvent{Image: "harbor.example.com/team-a/web"}},
+		{name: "no policy", namespace: "sandbox", event: eventservice.ImageEvent{Image: "harbor.example.com/team-a/web"}, want: true},
+		{name: "no policy deny", defaultDeny: true, namespace: "sandbox", event: eventservice.ImageEvent{Image: "harbor.example.com/team-a/web"}},
+		{name: "targeted event", defaultDeny: true, namespace: "sandbox",
+			event: eventservice.ImageEvent{Image: "harbor.example.com/team-a/web", Namespace: "sandbox"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewImageEventPolicyOptions()
+			options.Rules = rules
+			if tt.defaultDeny {
+				options.Default = DenyAction
+			}
+			p, err := NewImageEventPolicy(options, lister, aliases)
+			if err != nil {
+				t.Fatalf("NewImageEventPolicy() err = %v", err)
+			}
+
+			tt.event.Source = "test"
+			before := testutil.ToFloat64(deniedTotal.WithLabelValues(tt.namespace, "test"))
+			got, reason := p.Authorize(tt.namespace, tt.event)
+			if got != tt.want {
+				t.Errorf("Authorize() = %v (%s), want %v", got, reason, tt.want)
+			}
+			if denied := testutil.ToFloat64(deniedTotal.WithLabelValues(tt.namespace, "test")) - before; denied != map[bool]float64{true: 0, false: 1}[tt.want] {
+				t.Errorf("Authorize() counted %v denials", denied)
+			}
+		})
+	}
+}
+
+func TestImageEventPolicyOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  ImageEventPolicyOptions
+		wantErrs int
+	}{
+		{name: "valid", options: ImageEventPolicyOptions{Default: DenyAction,
+			Rules: []PolicyRule{{Namespaces: []string{"team-a"}, Repositories: []string{"harbor.example.com/team-a/**"}}}}},
+		{name: "unknown default", options: ImageEventPolicyOptions{Default: "refuse"}, wantErrs: 1},
+		{name: "rule without repositories", options: ImageEventPolicyOptions{Default: AllowAction,
+			Rules: []PolicyRule{{Namespaces: []string{"team-a"}}}}, wantErrs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := tt.options.Validate(); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() errs = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
@@ -19,12 +19,14 @@ package repository
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	ht "net/http"
+	"io/ioutil"
+	"sort"
+	"strings"
 
-	"github.com/antihax/optional"
-	"github.com/scultura-org/harborapi"
-	"k8s.io/klog"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"k8s.io/client-go/kubernetes"
 )
 
 // NotFoundRepoError 未找到对应的 repo
@@ -48,81 +50,151 @@ func (e NotSupportRegisterError) Error() string {
 // RepositoryService 镜像服务
 type RepositoryService interface {
 	// 获取镜像最新的 tag
-	LatestTag(host, projectName, repoName string) (tag string, err error)
+	LatestTag(ctx context.Context, host, projectName, repoName string, opts ...LookupOption) (tag string, err error)
 }
 
-// TODO support more repository
-// NewRepositoryService
-func NewRepositoryService(options *RepositoryServiceOptions) (RepositoryService, error) {
+// VulnerabilityScanner 镜像仓库的漏洞扫描结果
+type VulnerabilityScanner interface {
+	// 获取 reference (tag 或 digest) 的漏洞扫描结果, 未扫描或扫描未结束时返回 nil
+	ScanSummary(ctx context.Context, host, projectName, repoName, reference string) (*eventservice.ScanSummary, error)
+}
+
+// NewRepositoryService 根据配置的镜像仓库创建镜像服务, 按 image 的 host 路由至对应的仓库
+// client 用于读取镜像仓库凭证所在的 secret, 未配置 secret 时可以为 nil
+func NewRepositoryService(options *RepositoryServiceOptions, client kubernetes.Interface) (RepositoryService, error) {
 	if options.Mock {
 		// mock service
 		return &mockRepositoryService{
 			tags: options.MockTags,
 		}, nil
 	}
-	if options.Host == "" {
+
+	registries := options.registries()
+	if len(registries) == 0 {
 		return &ignoreRepositoryService{}, nil
 	}
 
-	if options.ApiPathPrefix == "" {
-		klog.Warning("repository service api path prefix is empty")
+	router := &routingRepositoryService{
+		services: map[string]RepositoryService{},
+		hosts:    map[string]string{},
 	}
-
-	cfg := harborapi.NewConfiguration()
-	cfg.BasePath = fmt.Sprintf("%s://%s%s", options.Protocol, options.Host, options.ApiPathPrefix)
-
-	// insecureSkipVerify
-	if options.InsecureSkipVerify && options.Protocol == "https" {
-		tr := &ht.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
+	for i := range registries {
+		registry := &registries[i]
+		service, err := newRegistryService(registry, client)
+		if err != nil {
+			return nil, fmt.Errorf("registry %s err: %v", registry.Host(), err)
 		}
-
-		cfg.HTTPClient = &ht.Client{
-			Transport: tr,
+		host := registry.Host()
+		router.services[host] = service
+		for _, alias := range append([]string{host}, registry.Aliases...) {
+			router.hosts[alias] = host
 		}
 	}
+	return router, nil
+}
 
-	service := &harborRepositoryService{
-		host:      options.Host,
-		apiClient: harborapi.NewAPIClient(cfg),
+func newRegistryService(registry *RegistryOptions, client kubernetes.Interface) (RepositoryService, error) {
+	switch registry.Type {
+	case DockerHubType:
+		return newDockerHubRepositoryService(registry), nil
+	case GHCRType:
+		return newGHCRRepositoryService(registry), nil
+	case RegistryType:
+		return newRegistryRepositoryService(registry)
+	default:
+		return newHarborRepositoryService(registry, client)
 	}
-
-	return service, nil
 }
 
-type ignoreRepositoryService struct {
+// tlsConfig https endpoint 的 tls 配置
+func tlsConfig(registry *RegistryOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: registry.InsecureSkipVerify,
+	}
+	if registry.CAFile != "" {
+		ca, err := ioutil.ReadFile(registry.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", registry.CAFile)
+		}
+	}
+	return config, nil
 }
 
-func (i *ignoreRepositoryService) LatestTag(_, _, _ string) (tag string, err error) {
-	return "", &NotSupportRegisterError{host: ""}
+// routingRepositoryService 按 image 的 host 将请求路由至对应的镜像仓库, 未指定 host 的 image 来自 docker.io
+type routingRepositoryService struct {
+	// services 镜像仓库的 host -> 镜像服务
+	services map[string]RepositoryService
+	// hosts 镜像仓库的 host 及别名 -> 镜像仓库的 host
+	hosts map[string]string
 }
 
-type harborRepositoryService struct {
-	host string
-
-	apiClient *harborapi.APIClient
+func (r *routingRepositoryService) LatestTag(ctx context.Context, host, projectName, repoName string, opts ...LookupOption) (tag string, err error) {
+	key := host
+	if key == "" {
+		key = dockerHubHost
+	}
+	registryHost, err := r.registryHost(key)
+	if err != nil {
+		return tag, err
+	}
+	if credential := r.resolveCredential(host, opts); credential != nil {
+		opts = append(opts, withCredential(*credential))
+	}
+	if host != "" {
+		// 别名统一为镜像仓库的 host
+		host = registryHost
+	}
+	return r.services[registryHost].LatestTag(ctx, host, projectName, repoName, opts...)
 }
 
-func (h *harborRepositoryService) LatestTag(host, projectName, repoName string) (tag string, err error) {
-	if host != h.host {
-		return tag, &NotSupportRegisterError{h.host}
+// resolveCredential 查询实际使用的凭证, 凭证可能以 image 中的别名或镜像仓库的 host 保存
+func (r *routingRepositoryService) resolveCredential(host string, opts []LookupOption) *Credential {
+	if host == "" {
+		host = dockerHubHost
+	}
+	if credential := lookupCredential(host, opts); credential != nil {
+		return credential
 	}
+	if registryHost, ok := r.hosts[host]; ok {
+		return lookupCredential(registryHost, opts)
+	}
+	return nil
+}
 
-	artifacts, _, err := h.apiClient.ArtifactApi.ListArtifacts(context.Background(), projectName, repoName, &harborapi.ArtifactApiListArtifactsOpts{
-		PageSize: optional.NewInt64(100),
-	})
+// ScanSummary 路由至镜像仓库的 VulnerabilityScanner, 只有 harbor 支持
+func (r *routingRepositoryService) ScanSummary(ctx context.Context, host, projectName, repoName, reference string) (*eventservice.ScanSummary, error) {
+	registryHost, err := r.registryHost(host)
 	if err != nil {
-		return
+		return nil, err
 	}
-	if len(artifacts) == 0 {
-		return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s/%s not found.", projectName, repoName)}
+	scanner, ok := r.services[registryHost].(VulnerabilityScanner)
+	if !ok {
+		return nil, &NotSupportRegisterError{host: registryHost}
 	}
+	return scanner.ScanSummary(ctx, registryHost, projectName, repoName, reference)
+}
+
+// registryHost 镜像仓库的 host 或别名对应的镜像仓库
+func (r *routingRepositoryService) registryHost(key string) (string, error) {
+	registryHost, ok := r.hosts[key]
+	if !ok {
+		hosts := make([]string, 0, len(r.hosts))
+		for h := range r.hosts {
+			hosts = append(hosts, h)
+		}
+		sort.Strings(hosts)
+		return "", &NotSupportRegisterError{host: strings.Join(hosts, ", ")}
+	}
+	return registryHost, nil
+}
 
-	// 根据 PushTime 对 artifact 和 tag 排序, 找出最新 push 的 image
-	latestArtifact := ArtifactSlice(artifacts).Sort().Latest()
-	latestTag := TagSlice(latestArtifact.Tags).Sort().Latest()
+type ignoreRepositoryService struct {
+}
 
-	return latestTag.Name, nil
+func (i *ignoreRepositoryService) LatestTag(_ context.Context, _, _, _ string, _ ...LookupOption) (tag string, err error) {
+	return "", &NotSupportRegisterError{host: ""}
 }
@@ -0,0 +1,188 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arugal/laborer/pkg/simple/client/registry/registrytest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_routingRepositoryService_LatestTag(t *testing.T) {
+	internal := registrytest.NewRegistry()
+	defer internal.Close()
+	internal.PushImage("project/web", "internal", time.Now())
+
+	dmz := registrytest.NewRegistry()
+	defer dmz.Close()
+	dmz.PushImage("project/web", "dmz", time.Now())
+
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(`{"results": [{"name": "hub", "last_updated": "2021-03-01T00:00:00Z"}]}`))
+	}))
+	defer hub.Close()
+
+	options := NewRepositoryServiceOptions()
+	options.Registries = []RegistryOptions{
+		{Type: RegistryType, Endpoint: internal.URL},
+		{Type: RegistryType, Endpoint: dmz.URL, Aliases: []string{"harbor.dmz.example.com"}},
+		{Type: DockerHubType, Endpoint: hub.URL},
+	}
+	if errs := options.Validate(); len(errs) > 0 {
+		t.Fatalf("Validate() errs = %v", errs)
+	}
+	service, err := NewRepositoryService(options, nil)
+	if err != nil {
+		t.Fatalf("NewRepositoryService() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		project string
+		wantTag string
+		wantErr bool
+	}{
+		{name: "internal", host: internal.Host(), project: "project", wantTag: "internal"},
+		{name: "dmz", host: dmz.Host(), project: "project", wantTag: "dmz"},
+		{name: "dmz alias", host: "harbor.dmz.example.com", project: "project", wantTag: "dmz"},
+		{name: "no host", project: "project", wantTag: "hub"},
+		{name: "docker.io", host: "docker.io", project: "project", wantTag: "hub"},
+		{name: "unknown host", host: "quay.io", project: "project", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTag, err := service.LatestTag(context.Background(), tt.host, tt.project, "web")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotTag != tt.wantTag {
+				t.Errorf("LatestTag() gotTag = %v, want %v", gotTag, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestRepositoryServiceOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		registries []RegistryOptions
+		wantErrs   int
+	}{
+		{
+			name: "valid",
+			registries: []RegistryOptions{
+				{Type: HarborType, Endpoint: "https://harbor.example.com", Aliases: []string{"10.0.0.1:443"}},
+				{Type: GHCRType, Token: "token"},
+			},
+		},
+		{
+			name:       "endpoint without scheme",
+			registries: []RegistryOptions{{Type: HarborType, Endpoint: "harbor.example.com"}},
+			wantErrs:   1,
+		},
+		{
+			name:       "ghcr without token",
+			registries: []RegistryOptions{{Type: GHCRType}},
+			wantErrs:   1,
+		},
+		{
+			name: "duplicate host",
+			registries: []RegistryOptions{
+				{Type: HarborType, Endpoint: "https://harbor.example.com"},
+				{Type: RegistryType, Endpoint: "https://mirror.example.com", Aliases: []string{"harbor.example.com"}},
+			},
+			wantErrs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewRepositoryServiceOptions()
+			options.Registries = tt.registries
+			if errs := options.Validate(); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() errs = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestRepositoryServiceOptions_RegistryClientOptions(t *testing.T) {
+	options := NewRepositoryServiceOptions()
+	options.Registries = []RegistryOptions{
+		{Type: HarborType, Endpoint: "http://harbor.example.com", Username: "robot", Password: "secret", Aliases: []string{"10.0.0.1:80"}},
+		{Type: HarborType, Endpoint: "https://private.example.com", CredentialsSecret: "laborer-system/private-robot"},
+		{Type: GHCRType, Token: "token"},
+		{Type: DockerHubType, Username: "user", Password: "pass"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "laborer-system", Name: "private-robot"},
+		Data:       map[string][]byte{secretUsernameKey: []byte("robot$private"), secretPasswordKey: []byte("v1")},
+	}
+	client := fake.NewSimpleClientset(secret)
+	workload := Keychain{"harbor.example.com": {Username: "workload", Password: "pull"}, "quay.io": {Username: "quay", Password: "pull"}}
+
+	tests := []struct {
+		name         string
+		host         string
+		keychain     Keychain
+		rotate       string
+		wantEndpoint string
+		wantUsername string
+		wantPassword string
+	}{
+		{name: "registry", host: "harbor.example.com", wantEndpoint: "http://harbor.example.com", wantUsername: "robot", wantPassword: "secret"},
+		{name: "alias", host: "10.0.0.1:80", wantEndpoint: "http://harbor.example.com", wantUsername: "robot", wantPassword: "secret"},
+		{name: "keychain", host: "harbor.example.com", keychain: workload, wantEndpoint: "http://harbor.example.com",
+			wantUsername: "workload", wantPassword: "pull"},
+		{name: "keychain of the registry host", host: "10.0.0.1:80", keychain: workload, wantEndpoint: "http://harbor.example.com",
+			wantUsername: "workload", wantPassword: "pull"},
+		{name: "credentials secret", host: "private.example.com", wantEndpoint: "https://private.example.com",
+			wantUsername: "robot$private", wantPassword: "v1"},
+		{name: "rotated credentials secret", host: "private.example.com", rotate: "v2", wantEndpoint: "https://private.example.com",
+			wantUsername: "robot$private", wantPassword: "v2"},
+		{name: "ghcr", host: "ghcr.io", wantEndpoint: "https://ghcr.io", wantUsername: "laborer", wantPassword: "token"},
+		{name: "docker hub", host: "docker.io", wantEndpoint: "https://registry-1.docker.io", wantUsername: "user", wantPassword: "pass"},
+		{name: "anonymous", host: "quay.io", wantEndpoint: "https://quay.io"},
+		{name: "keychain of other host", host: "quay.io", keychain: workload, wantEndpoint: "https://quay.io", wantUsername: "quay", wantPassword: "pull"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rotate != "" {
+				secret.Data[secretPasswordKey] = []byte(tt.rotate)
+				if _, err := client.CoreV1().Secrets(secret.Namespace).Update(context.Background(), secret, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := options.RegistryClientOptions(context.Background(), client, tt.host, tt.keychain)
+			if err != nil {
+				t.Fatalf("RegistryClientOptions() err = %v", err)
+			}
+			if got.Endpoint != tt.wantEndpoint || got.Username != tt.wantUsername || got.Password != tt.wantPassword {
+				t.Errorf("RegistryClientOptions() = %s %s %s, want %s %s %s", got.Endpoint, got.Username, got.Password,
+					tt.wantEndpoint, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
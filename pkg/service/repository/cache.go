@@ -0,0 +1,191 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"k8s.io/klog"
+)
+
+// cachedRepositoryService 缓存最新的 tag, 相同镜像的并发查询合并为一次, 镜像 push 事件到达时失效
+type cachedRepositoryService struct {
+	RepositoryService
+
+	ttl time.Duration
+	// aliases 事件与工作负载中同一镜像的不同写法
+	aliases *eventservice.ImageAliases
+
+	// entries 镜像名称 -> 凭证和策略 -> 缓存的 tag
+	entries map[string]map[string]cacheEntry
+	// generations 镜像失效的次数, 查询期间失效的结果不缓存
+	generations map[string]uint64
+	mu          sync.Mutex
+
+	group *singleflight
+
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	tag     string
+	expires time.Time
+}
+
+// NewCachedRepositoryService ttl 为 0 时不缓存, 只合并并发的查询, collect 中的镜像事件会使对应镜像的缓存失效,
+// 替换 aliases 之后相同的镜像共用缓存
+func NewCachedRepositoryService(service RepositoryService, ttl time.Duration, collect eventservice.ImageEventCollect,
+	aliases *eventservice.ImageAliases) RepositoryService {
+	c := &cachedRepositoryService{
+		RepositoryService: service,
+		ttl:               ttl,
+		aliases:           aliases,
+		entries:           map[string]map[string]cacheEntry{},
+		generations:       map[string]uint64{},
+		group:             &singleflight{calls: map[string]*call{}},
+		now:               time.Now,
+	}
+	if collect != nil {
+		collect.RegisterHandlerFunc(c.invalidate)
+	}
+	return c
+}
+
+func (c *cachedRepositoryService) LatestTag(ctx context.Context, host, projectName, repoName string, opts ...LookupOption) (string, error) {
+	// 补全并替换别名之后作为缓存的 key, 与 docker.io 等镜像中心事件中的写法一致
+	image := c.aliases.Canonical(imageName(host, projectName, repoName))
+	// 不同的凭证可见的镜像可能不同, 不同的策略选择的 tag 不同, 分别缓存
+	lookup := credentialKey(c.resolveCredential(host, opts)) + "@" + lookupStrategy(opts).String()
+
+	c.mu.Lock()
+	entry, ok := c.entries[image][lookup]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.tag, nil
+	}
+
+	return c.group.do(ctx, image+"@"+lookup, func() (string, error) {
+		c.mu.Lock()
+		generation := c.generations[image]
+		c.mu.Unlock()
+
+		tag, err := c.RepositoryService.LatestTag(ctx, host, projectName, repoName, opts...)
+		if err != nil || c.ttl <= 0 {
+			return tag, err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.generations[image] != generation {
+			return tag, nil
+		}
+		if _, ok := c.entries[image]; !ok {
+			c.entries[image] = map[string]cacheEntry{}
+		}
+		c.entries[image][lookup] = cacheEntry{tag: tag, expires: c.now().Add(c.ttl)}
+		return tag, nil
+	})
+}
+
+// credentialResolver 解析查询实际使用的凭证, 如 routingRepositoryService 以别名或镜像仓库的 host 查找凭证
+type credentialResolver interface {
+	resolveCredential(host string, opts []LookupOption) *Credential
+}
+
+// resolveCredential 与被缓存的镜像服务使用相同的凭证, 避免不同凭证的查询共用缓存
+func (c *cachedRepositoryService) resolveCredential(host string, opts []LookupOption) *Credential {
+	if resolver, ok := c.RepositoryService.(credentialResolver); ok {
+		return resolver.resolveCredential(host, opts)
+	}
+	return lookupCredential(host, opts)
+}
+
+// invalidate 镜像 push 后删除缓存
+func (c *cachedRepositoryService) invalidate(event eventservice.ImageEvent) {
+	image := c.aliases.Canonical(event.Image)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[image]++
+	if _, ok := c.entries[image]; ok {
+		klog.V(4).Infof("invalidate the latest tag of %s", image)
+		delete(c.entries, image)
+	}
+}
+
+// imageName 与 image 的写法一致的名称, 不包含 tag
+func imageName(host, projectName, repoName string) string {
+	var parts []string
+	for _, part := range []string{host, projectName, repoName} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func credentialKey(credential *Credential) string {
+	if credential == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(credential.Username+":"+credential.Password)))[:16]
+}
+
+// singleflight 合并相同 key 的并发调用, 由第一个调用者执行, 等待者在自己的 ctx 结束时提前返回
+type singleflight struct {
+	calls map[string]*call
+	mu    sync.Mutex
+}
+
+type call struct {
+	done chan struct{}
+	tag  string
+	err  error
+}
+
+func (g *singleflight) do(ctx context.Context, key string, fn func() (string, error)) (string, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		g.calls[key] = c
+	}
+	g.mu.Unlock()
+
+	if ok {
+		select {
+		case <-c.done:
+			return c.tag, c.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.tag, c.err = fn()
+	return c.tag, c.err
+}
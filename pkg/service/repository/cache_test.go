@@ -0,0 +1,191 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+// countingRepositoryService count the lookups, every lookup waits for release
+type countingRepositoryService struct {
+	lookups int32
+	tag     string
+	release chan struct{}
+}
+
+func (c *countingRepositoryService) LatestTag(ctx context.Context, _, _, _ string, _ ...LookupOption) (string, error) {
+	atomic.AddInt32(&c.lookups, 1)
+	if c.release != nil {
+		select {
+		case <-c.release:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	return c.tag, nil
+}
+
+func Test_cachedRepositoryService_LatestTag(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cached until expired", func(t *testing.T) {
+		backend := &countingRepositoryService{tag: "v1"}
+		c := NewCachedRepositoryService(backend, time.Minute, nil, nil).(*cachedRepositoryService)
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			if tag, err := c.LatestTag(ctx, "harbor.example.com", "project", "web"); err != nil || tag != "v1" {
+				t.Fatalf("LatestTag() = %v, %v", tag, err)
+			}
+		}
+		if backend.lookups != 1 {
+			t.Errorf("lookups = %d, want 1", backend.lookups)
+		}
+
+		now = now.Add(2 * time.Minute)
+		_, _ = c.LatestTag(ctx, "harbor.example.com", "project", "web")
+		if backend.lookups != 2 {
+			t.Errorf("lookups after expired = %d, want 2", backend.lookups)
+		}
+	})
+
+	t.Run("cached by credential", func(t *testing.T) {
+		backend := &countingRepositoryService{tag: "v1"}
+		c := NewCachedRepositoryService(backend, time.Minute, nil, nil)
+
+		_, _ = c.LatestTag(ctx, "harbor.example.com", "project", "web")
+		_, _ = c.LatestTag(ctx, "harbor.example.com", "project", "web",
+			WithKeychain(Keychain{"harbor.example.com": {Username: "admin", Password: "secret"}}))
+		if backend.lookups != 2 {
+			t.Errorf("lookups = %d, want 2", backend.lookups)
+		}
+	})
+
+	t.Run("cached by credential of the registry host", func(t *testing.T) {
+		backend := &countingRepositoryService{tag: "v1"}
+		router := &routingRepositoryService{
+			services: map[string]RepositoryService{"harbor.example.com": backend},
+			hosts:    map[string]string{"harbor.example.com": "harbor.example.com", "harbor.build.internal": "harbor.example.com"},
+		}
+		c := NewCachedRepositoryService(router, time.Minute, nil, nil)
+
+		// the image uses the alias, the credentials are saved with the registry host
+		admin := WithKeychain(Keychain{"harbor.example.com": {Username: "admin", Password: "secret"}})
+		guest := WithKeychain(Keychain{"harbor.example.com": {Username: "guest", Password: "secret"}})
+		_, _ = c.LatestTag(ctx, "harbor.build.internal", "project", "web", admin)
+		_, _ = c.LatestTag(ctx, "harbor.build.internal", "project", "web", guest)
+		if backend.lookups != 2 {
+			t.Errorf("lookups = %d, want 2", backend.lookups)
+		}
+		_, _ = c.LatestTag(ctx, "harbor.build.internal", "project", "web", admin)
+		if backend.lookups != 2 {
+			t.Errorf("lookups with the same credential = %d, want 2", backend.lookups)
+		}
+	})
+
+	t.Run("invalidated by push event", func(t *testing.T) {
+		backend := &countingRepositoryService{tag: "v1"}
+		collect := &stubImageEventCollect{}
+		c := NewCachedRepositoryService(backend, time.Minute, collect, nil)
+
+		_, _ = c.LatestTag(ctx, "harbor.example.com", "project", "web")
+		backend.tag = "v2"
+		collect.handler(eventservice.ImageEvent{Image: "harbor.example.com/project/other", Tag: "v2"})
+		if tag, _ := c.LatestTag(ctx, "harbor.example.com", "project", "web"); tag != "v1" {
+			t.Errorf("LatestTag() after other push = %v, want v1", tag)
+		}
+		collect.handler(eventservice.ImageEvent{Image: "harbor.example.com/project/web", Tag: "v2"})
+		if tag, _ := c.LatestTag(ctx, "harbor.example.com", "project", "web"); tag != "v2" {
+			t.Errorf("LatestTag() after push = %v, want v2", tag)
+		}
+	})
+
+	t.Run("invalidated by push event of the alias", func(t *testing.T) {
+		backend := &countingRepositoryService{tag: "v1"}
+		collect := &stubImageEventCollect{}
+		aliases := eventservice.NewImageAliases(&eventservice.ImageAliasOptions{Aliases: []eventservice.ImageAlias{
+			{Prefix: "harbor.example.com", Aliases: []string{"harbor.build.internal"}},
+		}})
+		c := NewCachedRepositoryService(backend, time.Minute, collect, aliases)
+
+		_, _ = c.LatestTag(ctx, "harbor.example.com", "project", "web")
+		backend.tag = "v2"
+		collect.handler(eventservice.ImageEvent{Image: "harbor.build.internal/project/web", Tag: "v2"})
+		if tag, _ := c.LatestTag(ctx, "harbor.example.com", "project", "web"); tag != "v2" {
+			t.Errorf("LatestTag() after push = %v, want v2", tag)
+		}
+	})
+
+	t.Run("concurrent lookups collapsed", func(t *testing.T) {
+		backend := &countingRepositoryService{tag: "v1", release: make(chan struct{})}
+		c := NewCachedRepositoryService(backend, 0, nil, nil)
+
+		var wg sync.WaitGroup
+		tags := make([]string, 5)
+		for i := range tags {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				tags[i], _ = c.LatestTag(ctx, "harbor.example.com", "project", "web")
+			}(i)
+		}
+		// wait for the lookup to start before releasing it
+		for atomic.LoadInt32(&backend.lookups) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(backend.release)
+		wg.Wait()
+
+		if backend.lookups != 1 {
+			t.Errorf("lookups = %d, want 1", backend.lookups)
+		}
+		for _, tag := range tags {
+			if tag != "v1" {
+				t.Errorf("LatestTag() = %v, want v1", tag)
+			}
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		backend := &countingRepositoryService{tag: "v1", release: make(chan struct{})}
+		c := NewCachedRepositoryService(backend, time.Minute, nil, nil)
+
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := c.LatestTag(timeout, "harbor.example.com", "project", "web"); err != context.DeadlineExceeded {
+			t.Errorf("LatestTag() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+type stubImageEventCollect struct {
+	eventservice.ImageEventCollect
+
+	handler eventservice.ImageEventHandlerFunc
+}
+
+func (s *stubImageEventCollect) RegisterHandlerFunc(handler eventservice.ImageEventHandlerFunc) {
+	s.handler = handler
+}
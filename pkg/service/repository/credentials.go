@@ -0,0 +1,152 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Credential 镜像仓库的用户名和密码
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Keychain 镜像仓库 host -> 凭证
+type Keychain map[string]Credential
+
+// Lookup 查找 host 的凭证, docker.io 的各种写法视为同一个 host
+func (k Keychain) Lookup(host string) (Credential, bool) {
+	credential, ok := k[normalizeRegistryHost(host)]
+	return credential, ok
+}
+
+// Merge 合并 other 中的凭证, 已存在的 host 不会被覆盖
+func (k Keychain) Merge(other Keychain) {
+	for host, credential := range other {
+		if _, ok := k[host]; !ok {
+			k[host] = credential
+		}
+	}
+}
+
+// dockerConfigEntry .dockerconfigjson 中一个镜像仓库的凭证
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// ParseDockerConfigJSON 解析 kubernetes.io/dockerconfigjson 类型 secret 的 .dockerconfigjson
+func ParseDockerConfigJSON(data []byte) (Keychain, error) {
+	var config struct {
+		Auths map[string]dockerConfigEntry `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return newKeychain(config.Auths)
+}
+
+// ParseDockerConfig 解析 kubernetes.io/dockercfg 类型 secret 的 .dockercfg
+func ParseDockerConfig(data []byte) (Keychain, error) {
+	var auths map[string]dockerConfigEntry
+	if err := json.Unmarshal(data, &auths); err != nil {
+		return nil, err
+	}
+	return newKeychain(auths)
+}
+
+func newKeychain(auths map[string]dockerConfigEntry) (Keychain, error) {
+	keychain := Keychain{}
+	for server, entry := range auths {
+		credential := Credential{Username: entry.Username, Password: entry.Password}
+		if entry.Auth != "" {
+			auth, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("decode auth of %s err: %v", server, err)
+			}
+			parts := strings.SplitN(string(auth), ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("auth of %s must be <username>:<password>", server)
+			}
+			credential = Credential{Username: parts[0], Password: parts[1]}
+		}
+		keychain[normalizeRegistryHost(server)] = credential
+	}
+	return keychain, nil
+}
+
+// normalizeRegistryHost 去掉 scheme 和路径, 例如: https://index.docker.io/v1/ -> docker.io
+func normalizeRegistryHost(server string) string {
+	if index := strings.Index(server, "://"); index >= 0 {
+		server = server[index+3:]
+	}
+	if index := strings.Index(server, "/"); index >= 0 {
+		server = server[:index]
+	}
+	if dockerHubHosts[server] {
+		return dockerHubHost
+	}
+	return server
+}
+
+// LookupOptions 单次查询的选项
+type LookupOptions struct {
+	// Keychain 工作负载的镜像仓库凭证, 优先于镜像仓库配置的凭证
+	Keychain Keychain
+	// Strategy 选择 tag 的策略, 默认选择最近 push 的 tag
+	Strategy *TagStrategy
+	// TagFilter 只选择允许的 tag, 为 nil 时不过滤
+	TagFilter func(tag string) bool
+
+	// credential 路由时根据 image 中的 host 确定的凭证
+	credential *Credential
+}
+
+type LookupOption func(options *LookupOptions)
+
+// WithKeychain 使用工作负载的凭证查询, 例如 imagePullSecrets
+func WithKeychain(keychain Keychain) LookupOption {
+	return func(options *LookupOptions) {
+		options.Keychain = keychain
+	}
+}
+
+func withCredential(credential Credential) LookupOption {
+	return func(options *LookupOptions) {
+		options.credential = &credential
+	}
+}
+
+// lookupCredential host 在本次查询中的凭证
+func lookupCredential(host string, opts []LookupOption) *Credential {
+	options := &LookupOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.credential != nil {
+		return options.credential
+	}
+	if credential, ok := options.Keychain.Lookup(host); ok {
+		return &credential
+	}
+	return nil
+}
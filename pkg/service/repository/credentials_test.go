@@ -0,0 +1,116 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arugal/laborer/pkg/simple/client/registry/registrytest"
+)
+
+func TestParseDockerConfigJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Keychain
+		wantErr bool
+	}{
+		{
+			name: "auth",
+			// admin:Harbor12345
+			data: `{"auths": {"harbor.example.com": {"auth": "YWRtaW46SGFyYm9yMTIzNDU="}}}`,
+			want: Keychain{"harbor.example.com": {Username: "admin", Password: "Harbor12345"}},
+		},
+		{
+			name: "username and password",
+			data: `{"auths": {"https://index.docker.io/v1/": {"username": "arugal", "password": "token"}}}`,
+			want: Keychain{"docker.io": {Username: "arugal", Password: "token"}},
+		},
+		{
+			name: "registry with port and path",
+			data: `{"auths": {"http://10.0.0.1:5000/v2/": {"username": "admin", "password": "secret"}}}`,
+			want: Keychain{"10.0.0.1:5000": {Username: "admin", Password: "secret"}},
+		},
+		{
+			name:    "invalid auth",
+			data:    `{"auths": {"harbor.example.com": {"auth": "YWRtaW4="}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid json",
+			data:    `{"auths": [`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDockerConfigJSON([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDockerConfigJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDockerConfigJSON() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryService_LatestTagWithKeychain(t *testing.T) {
+	r := registrytest.NewRegistry()
+	defer r.Close()
+	r.Username, r.Password = "admin", "secret"
+	r.PushImage("project/web", "v1", time.Now())
+
+	options := NewRepositoryServiceOptions()
+	options.Registries = []RegistryOptions{
+		{Type: RegistryType, Endpoint: r.URL, Aliases: []string{"registry.example.com"}},
+	}
+	service, err := NewRepositoryService(options, nil)
+	if err != nil {
+		t.Fatalf("NewRepositoryService() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		keychain Keychain
+		wantTag  string
+		wantErr  bool
+	}{
+		{name: "without credentials", host: r.Host(), wantErr: true},
+		{name: "credentials of the host", host: r.Host(), keychain: Keychain{r.Host(): {Username: "admin", Password: "secret"}}, wantTag: "v1"},
+		{name: "credentials of the alias", host: "registry.example.com", keychain: Keychain{"registry.example.com": {Username: "admin", Password: "secret"}}, wantTag: "v1"},
+		{name: "wrong credentials", host: r.Host(), keychain: Keychain{r.Host(): {Username: "admin", Password: "wrong"}}, wantErr: true},
+		{name: "credentials of other host", host: r.Host(), keychain: Keychain{"harbor.example.com": {Username: "admin", Password: "secret"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTag, err := service.LatestTag(context.Background(), tt.host, "project", "web", WithKeychain(tt.keychain))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotTag != tt.wantTag {
+				t.Errorf("LatestTag() gotTag = %v, want %v", gotTag, tt.wantTag)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dockerHubHost = "docker.io"
+	dockerHubAPI  = "https://hub.docker.com"
+	// dockerHubRegistryEndpoint Docker Hub 的 OCI Distribution API
+	dockerHubRegistryEndpoint = "https://registry-1.docker.io"
+
+	dockerHubOfficialProject = "library"
+
+	// hubTokenTTL Docker Hub jwt 的缓存时间, 短于 jwt 的有效期
+	hubTokenTTL = 10 * time.Minute
+)
+
+// dockerHubHosts image 中 Docker Hub 的写法, 未指定 host 的 image 也来自 Docker Hub
+var dockerHubHosts = map[string]bool{
+	"":                     true,
+	dockerHubHost:          true,
+	"index.docker.io":      true,
+	"registry-1.docker.io": true,
+}
+
+// dockerHubRepositoryService 基于 Docker Hub tags api 的镜像服务, 按 last_updated 排序
+type dockerHubRepositoryService struct {
+	api    *hostedAPI
+	apiURL string
+
+	// tokens 工作负载凭证登录 Docker Hub 后的 jwt
+	tokens map[Credential]hubToken
+	mu     sync.Mutex
+}
+
+type hubToken struct {
+	token   string
+	expires time.Time
+}
+
+func newDockerHubRepositoryService(options *RegistryOptions) RepositoryService {
+	headers := map[string]string{}
+	if options.Token != "" {
+		headers["Authorization"] = "Bearer " + options.Token
+	}
+	apiURL := dockerHubAPI
+	if options.Endpoint != "" {
+		apiURL = strings.TrimSuffix(options.Endpoint, "/")
+	}
+	return &dockerHubRepositoryService{
+		api:    newHostedAPI(dockerHubHost, headers),
+		apiURL: apiURL,
+		tokens: map[Credential]hubToken{},
+	}
+}
+
+func (d *dockerHubRepositoryService) LatestTag(ctx context.Context, host, projectName, repoName string, opts ...LookupOption) (tag string, err error) {
+	if !dockerHubHosts[host] {
+		return tag, &NotSupportRegisterError{dockerHubHost}
+	}
+	if credential := lookupCredential(dockerHubHost, opts); credential != nil {
+		token, err := d.login(ctx, credential)
+		if err != nil {
+			return tag, err
+		}
+		ctx = contextWithAuthorization(ctx, "Bearer "+token)
+	}
+	if projectName == "" {
+		projectName = dockerHubOfficialProject
+	}
+
+	// 由 docker hub 按 last_updated 倒序分页, 按 push 时间选择时第一个有匹配 tag 的页中即为最新的 tag
+	strategy := lookupStrategy(opts)
+	var tags PushedTagSlice
+	next := fmt.Sprintf("%s/v2/repositories/%s/%s/tags?page_size=100&ordering=last_updated", d.apiURL, projectName, repoName)
+	for next != "" {
+		var page struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Name        string    `json:"name"`
+				LastUpdated time.Time `json:"last_updated"`
+			} `json:"results"`
+		}
+		if _, err = d.api.getJSON(ctx, next, &page); err != nil {
+			return
+		}
+		var pageTags PushedTagSlice
+		for _, result := range page.Results {
+			pageTags = append(pageTags, PushedTag{Name: result.Name, PushTime: result.LastUpdated})
+		}
+		if strategy.UsePushTime() {
+			if tag, ok := strategy.Select(pageTags); ok {
+				return tag, nil
+			}
+		}
+		tags = append(tags, pageTags...)
+		next = page.Next
+	}
+	if len(tags) == 0 {
+		return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s/%s not found.", projectName, repoName)}
+	}
+	if tag, ok := strategy.Select(tags); ok {
+		return tag, nil
+	}
+	return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s/%s has no tag matching %s.", projectName, repoName, strategy)}
+}
+
+// login 使用凭证登录 Docker Hub, 返回的 jwt 缓存一段时间
+func (d *dockerHubRepositoryService) login(ctx context.Context, credential *Credential) (string, error) {
+	d.mu.Lock()
+	cached, ok := d.tokens[*credential]
+	d.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": credential.Username, "password": credential.Password})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.apiURL+"/v2/users/login", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.api.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err = d.api.checkRateLimit(resp); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("docker hub login as %s: unexpected status %d", credential.Username, resp.StatusCode)
+	}
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	d.tokens[*credential] = hubToken{token: result.Token, expires: time.Now().Add(hubTokenTTL)}
+	d.mu.Unlock()
+	return result.Token, nil
+}
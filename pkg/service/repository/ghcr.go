@@ -0,0 +1,118 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ghcrHost  = "ghcr.io"
+	githubAPI = "https://api.github.com"
+)
+
+// ghcrRepositoryService 基于 GitHub Packages versions api 的镜像服务, 需要 read:packages 权限的 token
+type ghcrRepositoryService struct {
+	api    *hostedAPI
+	apiURL string
+}
+
+func newGHCRRepositoryService(options *RegistryOptions) RepositoryService {
+	apiURL := githubAPI
+	if options.Endpoint != "" {
+		apiURL = strings.TrimSuffix(options.Endpoint, "/")
+	}
+	return &ghcrRepositoryService{
+		api: newHostedAPI(ghcrHost, map[string]string{
+			"Authorization": "Bearer " + options.Token,
+			"Accept":        "application/vnd.github.v3+json",
+		}),
+		apiURL: apiURL,
+	}
+}
+
+// packageVersion GitHub Packages 中 container 的一个版本, 一个版本对应一个 digest 及其 tags
+type packageVersion struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  struct {
+		Container struct {
+			Tags []string `json:"tags"`
+		} `json:"container"`
+	} `json:"metadata"`
+}
+
+func (g *ghcrRepositoryService) LatestTag(ctx context.Context, host, projectName, repoName string, opts ...LookupOption) (tag string, err error) {
+	if host != ghcrHost {
+		return tag, &NotSupportRegisterError{ghcrHost}
+	}
+
+	// ghcr.io/<owner>/<package>, package 中可以包含 /
+	owner, packageName := projectName, repoName
+	if index := strings.Index(projectName, "/"); index >= 0 {
+		owner, packageName = projectName[:index], projectName[index+1:]+"/"+repoName
+	}
+
+	// imagePullSecrets 中 ghcr.io 的密码即 GitHub token
+	if credential := lookupCredential(ghcrHost, opts); credential != nil {
+		ctx = contextWithAuthorization(ctx, "Bearer "+credential.Password)
+	}
+
+	// 先按组织查询, 不存在时再按用户查询
+	versions, err := g.versions(ctx, "orgs", owner, packageName)
+	if _, ok := err.(*NotFoundRepoError); ok {
+		versions, err = g.versions(ctx, "users", owner, packageName)
+	}
+	if err != nil {
+		return
+	}
+
+	var tags PushedTagSlice
+	for _, version := range versions {
+		for _, name := range version.Metadata.Container.Tags {
+			tags = append(tags, PushedTag{Name: name, PushTime: version.UpdatedAt})
+		}
+	}
+	if len(tags) == 0 {
+		return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s/%s not found.", projectName, repoName)}
+	}
+	strategy := lookupStrategy(opts)
+	if tag, ok := strategy.Select(tags); ok {
+		return tag, nil
+	}
+	return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s/%s has no tag matching %s.", projectName, repoName, strategy)}
+}
+
+func (g *ghcrRepositoryService) versions(ctx context.Context, ownerType, owner, packageName string) ([]packageVersion, error) {
+	var versions []packageVersion
+	next := fmt.Sprintf("%s/%s/%s/packages/container/%s/versions?per_page=100",
+		g.apiURL, ownerType, url.PathEscape(owner), url.PathEscape(packageName))
+	for next != "" {
+		var page []packageVersion
+		var err error
+		if next, err = g.api.getJSON(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		versions = append(versions, page...)
+	}
+	return versions, nil
+}
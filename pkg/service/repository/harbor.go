@@ -0,0 +1,239 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/scultura-org/harborapi"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// harborAPIPathPrefix harbor v2 api 的路径, 未配置 apiPathPrefix 时使用
+	harborAPIPathPrefix = "/api/v2.0"
+
+	// harborImageType harbor 中镜像的 artifact 类型, 其他类型如 CHART, CNAB 以及 cosign 签名 (UNKNOWN) 不参与排序
+	harborImageType = "IMAGE"
+
+	// harborVulnerabilityReportTypes 漏洞报告的 mime type, 决定 scan_overview 中返回的报告
+	harborVulnerabilityReportTypes = "application/vnd.security.vulnerability.report; version=1.1, " +
+		"application/vnd.scanner.adapter.vuln.report.harbor+json; version=1.0"
+	harborScanSuccess = "Success"
+	harborScanError   = "Error"
+	harborScanStopped = "Stopped"
+
+	secretUsernameKey = "username"
+	secretPasswordKey = "password"
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+type harborRepositoryService struct {
+	host    string
+	baseURL string
+
+	api *hostedAPI
+}
+
+func newHarborRepositoryService(registry *RegistryOptions, client kubernetes.Interface) (RepositoryService, error) {
+	apiPathPrefix := registry.ApiPathPrefix
+	if apiPathPrefix == "" {
+		apiPathPrefix = harborAPIPathPrefix
+	}
+
+	api := newHostedAPI(registry.Host(), map[string]string{
+		"Accept":                   "application/json",
+		"X-Accept-Vulnerabilities": harborVulnerabilityReportTypes,
+	})
+	if strings.HasPrefix(registry.Endpoint, "https://") {
+		config, err := tlsConfig(registry)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		api.httpClient.Transport = transport
+	}
+
+	switch {
+	case registry.CredentialsSecret != "":
+		if client == nil {
+			return nil, fmt.Errorf("kubernetes client is required by the credentials secret %s", registry.CredentialsSecret)
+		}
+		api.credentials = secretCredentials(client, registry.CredentialsSecret)
+	case registry.Username != "":
+		api.credentials = func(context.Context) (string, string, error) {
+			return registry.Username, registry.Password, nil
+		}
+	}
+
+	return &harborRepositoryService{
+		host:    registry.Host(),
+		baseURL: strings.TrimSuffix(registry.Endpoint, "/") + apiPathPrefix,
+		api:     api,
+	}, nil
+}
+
+// secretCredentials 从 secret 的 username 和 password 读取凭证, 每次读取以便轮换 robot 账号的密码
+func secretCredentials(client kubernetes.Interface, ref string) func(ctx context.Context) (string, string, error) {
+	namespace, name := splitSecretRef(ref)
+	return func(ctx context.Context) (string, string, error) {
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", "", fmt.Errorf("get credentials secret %s err: %v", ref, err)
+		}
+		return string(secret.Data[secretUsernameKey]), string(secret.Data[secretPasswordKey]), nil
+	}
+}
+
+// splitSecretRef 解析 <namespace>/<name>
+func splitSecretRef(ref string) (namespace, name string) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 {
+		return "", ref
+	}
+	return parts[0], parts[1]
+}
+
+func (h *harborRepositoryService) LatestTag(ctx context.Context, host, projectName, repoName string, opts ...LookupOption) (tag string, err error) {
+	if host != h.host {
+		return tag, &NotSupportRegisterError{h.host}
+	}
+
+	// harbor 的 project 只有一级, 其余部分属于 repository
+	if index := strings.Index(projectName, "/"); index >= 0 {
+		projectName, repoName = projectName[:index], projectName[index+1:]+"/"+repoName
+	}
+
+	if credential := lookupCredential(h.host, opts); credential != nil {
+		ctx = contextWithAuthorization(ctx, basicAuthorization(credential))
+	}
+
+	// 由 harbor 按 push_time 倒序分页, 按 push 时间选择时第一个有匹配 tag 的镜像即为最新的镜像
+	// repository 中的 / 需要两次编码
+	strategy := lookupStrategy(opts)
+	var tags PushedTagSlice
+	next := fmt.Sprintf("%s/projects/%s/repositories/%s/artifacts?page=1&page_size=100&with_tag=true&sort=-push_time",
+		h.baseURL, url.PathEscape(projectName), url.PathEscape(url.PathEscape(repoName)))
+	for next != "" {
+		var artifacts []harborapi.Artifact
+		if next, err = h.api.getJSON(ctx, next, &artifacts); err != nil {
+			return
+		}
+		for _, artifact := range artifacts {
+			if !strategy.UsePushTime() {
+				tags = append(tags, imageTags(artifact)...)
+				continue
+			}
+			if tag, ok := strategy.Select(imageTags(artifact)); ok {
+				return tag, nil
+			}
+		}
+	}
+	if tag, ok := strategy.Select(tags); ok {
+		return tag, nil
+	}
+	return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s/%s has no tag matching %s.", projectName, repoName, strategy)}
+}
+
+// harborScanArtifact 带有漏洞扫描结果的 artifact, harborapi 的 ScanOverview 没有字段
+type harborScanArtifact struct {
+	Digest       string                         `json:"digest"`
+	ScanOverview map[string]harborReportSummary `json:"scan_overview"`
+}
+
+type harborReportSummary struct {
+	ScanStatus string `json:"scan_status"`
+	Severity   string `json:"severity"`
+	Summary    *struct {
+		Total   int            `json:"total"`
+		Fixable int            `json:"fixable"`
+		Summary map[string]int `json:"summary"`
+	} `json:"summary"`
+	Scanner *struct {
+		Name string `json:"name"`
+	} `json:"scanner"`
+}
+
+func (h *harborRepositoryService) ScanSummary(ctx context.Context, host, projectName, repoName, reference string) (*eventservice.ScanSummary, error) {
+	if host != h.host {
+		return nil, &NotSupportRegisterError{h.host}
+	}
+	if index := strings.Index(projectName, "/"); index >= 0 {
+		projectName, repoName = projectName[:index], projectName[index+1:]+"/"+repoName
+	}
+
+	var artifact harborScanArtifact
+	_, err := h.api.getJSON(ctx, fmt.Sprintf("%s/projects/%s/repositories/%s/artifacts/%s?with_scan_overview=true",
+		h.baseURL, url.PathEscape(projectName), url.PathEscape(url.PathEscape(repoName)), url.PathEscape(reference)), &artifact)
+	if err != nil {
+		return nil, err
+	}
+
+	// 有多个报告时使用 mime type 排序后的第一个
+	mimeTypes := make([]string, 0, len(artifact.ScanOverview))
+	for mimeType := range artifact.ScanOverview {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	if len(mimeTypes) == 0 {
+		return nil, nil
+	}
+	sort.Strings(mimeTypes)
+
+	report := artifact.ScanOverview[mimeTypes[0]]
+	switch report.ScanStatus {
+	case harborScanSuccess:
+	case harborScanError, harborScanStopped:
+		return &eventservice.ScanSummary{Status: eventservice.ScanFailed}, nil
+	default:
+		// Pending, Running, Scheduled 等扫描未结束
+		return nil, nil
+	}
+	summary := &eventservice.ScanSummary{
+		Status:   eventservice.ScanSuccess,
+		Severity: report.Severity,
+	}
+	if report.Summary != nil {
+		summary.Total = report.Summary.Total
+		summary.Fixable = report.Summary.Fixable
+		summary.Summary = report.Summary.Summary
+	}
+	if report.Scanner != nil {
+		summary.Scanner = report.Scanner.Name
+	}
+	return summary, nil
+}
+
+// imageTags 镜像 artifact 的 tag, 忽略其他类型的 artifact
+func imageTags(artifact harborapi.Artifact) PushedTagSlice {
+	if artifact.Type_ != "" && artifact.Type_ != harborImageType {
+		return nil
+	}
+	var tags PushedTagSlice
+	for _, tag := range artifact.Tags {
+		tags = append(tags, PushedTag{Name: tag.Name, PushTime: tag.PushTime})
+	}
+	return tags
+}
@@ -0,0 +1,238 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_harborRepositoryService_LatestTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if username, password, ok := req.BasicAuth(); !ok || username != "robot$laborer" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("sort") != "-push_time" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.URL.EscapedPath() {
+		case "/api/v2.0/projects/project/repositories/web/artifacts":
+			if req.URL.Query().Get("page") == "1" {
+				w.Header().Set("Link", `</api/v2.0/projects/project/repositories/web/artifacts?page=2&page_size=100&with_tag=true&sort=-push_time>; rel="next"`)
+				_, _ = w.Write([]byte(`[
+					{"type": "UNKNOWN", "push_time": "2021-03-05T00:00:00Z", "tags": [{"name": "sha256-abc.sig", "push_time": "2021-03-05T00:00:00Z"}]},
+					{"type": "CHART", "push_time": "2021-03-04T00:00:00Z", "tags": [{"name": "chart-1.0.0", "push_time": "2021-03-04T00:00:00Z"}]},
+					{"type": "IMAGE", "push_time": "2021-03-03T00:00:00Z", "tags": []}]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[
+				{"type": "IMAGE", "push_time": "2021-03-02T00:00:00Z", "tags": [
+					{"name": "v2", "push_time": "2021-03-02T00:00:00Z"},
+					{"name": "v2-rc", "push_time": "2021-03-01T00:00:00Z"}]},
+				{"type": "IMAGE", "push_time": "2021-03-01T00:00:00Z", "tags": [{"name": "v1", "push_time": "2021-03-01T00:00:00Z"}]}]`))
+		case "/api/v2.0/projects/project/repositories/team%252Fweb/artifacts":
+			_, _ = w.Write([]byte(`[{"type": "IMAGE", "push_time": "2021-03-01T00:00:00Z", "tags": [{"name": "v1", "push_time": "2021-03-01T00:00:00Z"}]}]`))
+		case "/api/v2.0/projects/project/repositories/chart/artifacts":
+			_, _ = w.Write([]byte(`[{"type": "CHART", "push_time": "2021-03-01T00:00:00Z", "tags": [{"name": "1.0.0", "push_time": "2021-03-01T00:00:00Z"}]}]`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "laborer-system", Name: "harbor-robot"},
+		Data: map[string][]byte{
+			"username": []byte("robot$laborer"),
+			"password": []byte("secret"),
+		},
+	})
+
+	tests := []struct {
+		name     string
+		registry RegistryOptions
+		project  string
+		repo     string
+		strategy *TagStrategy
+		wantTag  string
+		wantErr  bool
+	}{
+		{
+			name:     "skip signatures, charts and untagged artifacts over pages",
+			registry: RegistryOptions{CredentialsSecret: "laborer-system/harbor-robot"},
+			project:  "project",
+			repo:     "web",
+			wantTag:  "v2",
+		},
+		{
+			name:     "filter over pages",
+			registry: RegistryOptions{Username: "robot$laborer", Password: "secret"},
+			project:  "project",
+			repo:     "web",
+			strategy: &TagStrategy{Order: PushTimeOrder, Filter: regexp.MustCompile(`^v1$`)},
+			wantTag:  "v1",
+		},
+		{
+			name:     "alphabetical",
+			registry: RegistryOptions{Username: "robot$laborer", Password: "secret"},
+			project:  "project",
+			repo:     "web",
+			strategy: &TagStrategy{Order: AlphabeticalOrder},
+			wantTag:  "v2-rc",
+		},
+		{
+			name:     "nested repository",
+			registry: RegistryOptions{Username: "robot$laborer", Password: "secret"},
+			project:  "project/team",
+			repo:     "web",
+			wantTag:  "v1",
+		},
+		{
+			name:     "no image",
+			registry: RegistryOptions{Username: "robot$laborer", Password: "secret"},
+			project:  "project",
+			repo:     "chart",
+			wantErr:  true,
+		},
+		{
+			name:     "secret not found",
+			registry: RegistryOptions{CredentialsSecret: "laborer-system/unknown"},
+			project:  "project",
+			repo:     "web",
+			wantErr:  true,
+		},
+		{
+			name:    "anonymous",
+			project: "project",
+			repo:    "web",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := tt.registry
+			registry.Type = HarborType
+			// apiPathPrefix 默认为 /api/v2.0
+			registry.Endpoint = server.URL
+			service, err := newHarborRepositoryService(&registry, client)
+			if err != nil {
+				t.Fatalf("newHarborRepositoryService() error = %v", err)
+			}
+
+			gotTag, err := service.LatestTag(context.Background(), registry.Host(), tt.project, tt.repo, WithTagStrategy(tt.strategy))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotTag != tt.wantTag {
+				t.Errorf("LatestTag() gotTag = %v, want %v", gotTag, tt.wantTag)
+			}
+		})
+	}
+}
+
+func Test_harborRepositoryService_ScanSummary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("with_scan_overview") != "true" || req.Header.Get("X-Accept-Vulnerabilities") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.URL.EscapedPath() {
+		case "/api/v2.0/projects/project/repositories/web/artifacts/v1":
+			_, _ = w.Write([]byte(`{"digest": "sha256:65ff", "scan_overview": {"application/vnd.security.vulnerability.report; version=1.1": {
+				"scan_status": "Success", "severity": "Critical",
+				"summary": {"total": 3, "fixable": 1, "summary": {"Critical": 1, "Low": 2}},
+				"scanner": {"name": "Trivy", "vendor": "Aqua Security", "version": "v0.16.0"}}}}`))
+		case "/api/v2.0/projects/project/repositories/team%252Fweb/artifacts/v1":
+			_, _ = w.Write([]byte(`{"digest": "sha256:65ff", "scan_overview": {"application/vnd.security.vulnerability.report; version=1.1": {"scan_status": "Error"}}}`))
+		case "/api/v2.0/projects/project/repositories/web/artifacts/v2":
+			_, _ = w.Write([]byte(`{"digest": "sha256:65ff", "scan_overview": {"application/vnd.security.vulnerability.report; version=1.1": {"scan_status": "Running"}}}`))
+		case "/api/v2.0/projects/project/repositories/web/artifacts/v3":
+			_, _ = w.Write([]byte(`{"digest": "sha256:65ff"}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		project   string
+		reference string
+		want      *eventservice.ScanSummary
+		wantErr   bool
+	}{
+		{
+			name:      "scanned",
+			project:   "project",
+			reference: "v1",
+			want: &eventservice.ScanSummary{Status: eventservice.ScanSuccess, Severity: "Critical", Total: 3, Fixable: 1,
+				Summary: map[string]int{"Critical": 1, "Low": 2}, Scanner: "Trivy"},
+		},
+		{
+			name:      "scan error of nested repository",
+			project:   "project/team",
+			reference: "v1",
+			want:      &eventservice.ScanSummary{Status: eventservice.ScanFailed},
+		},
+		{
+			name:      "scanning",
+			project:   "project",
+			reference: "v2",
+		},
+		{
+			name:      "not scanned",
+			project:   "project",
+			reference: "v3",
+		},
+		{
+			name:      "not found",
+			project:   "project",
+			reference: "v4",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := RegistryOptions{Type: HarborType, Endpoint: server.URL, ApiPathPrefix: "/api/v2.0"}
+			service, err := newHarborRepositoryService(&registry, nil)
+			if err != nil {
+				t.Fatalf("newHarborRepositoryService() error = %v", err)
+			}
+
+			got, err := service.(VulnerabilityScanner).ScanSummary(context.Background(), registry.Host(), tt.project, "web", tt.reference)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ScanSummary() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScanSummary() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitError 镜像仓库 API 限流, Reset 之后才能再次请求
+type RateLimitError struct {
+	host  string
+	Reset time.Time
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("%s api rate limit exceeded, retry after %s", e.host, e.Reset.Format(time.RFC3339))
+}
+
+// hostedAPI Harbor, Docker Hub, GitHub 等镜像仓库的 http api, 遵守 X-RateLimit-* 和 Retry-After 响应头
+type hostedAPI struct {
+	host       string
+	httpClient *http.Client
+	headers    map[string]string
+	// credentials basic auth 的用户名和密码, 每次请求时获取, 为 nil 时不认证
+	credentials func(ctx context.Context) (username, password string, err error)
+
+	// limitedUntil 限流结束时间, 在此之前不再发送请求
+	limitedUntil time.Time
+	mu           sync.Mutex
+
+	now func() time.Time
+}
+
+func newHostedAPI(host string, headers map[string]string) *hostedAPI {
+	return &hostedAPI{
+		host:       host,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		headers:    headers,
+		now:        time.Now,
+	}
+}
+
+type authorizationKey struct{}
+
+// contextWithAuthorization 本次查询使用的 Authorization 请求头, 优先于 hostedAPI 的凭证
+func contextWithAuthorization(ctx context.Context, authorization string) context.Context {
+	return context.WithValue(ctx, authorizationKey{}, authorization)
+}
+
+// basicAuthorization Basic 认证的 Authorization 请求头
+func basicAuthorization(credential *Credential) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credential.Username+":"+credential.Password))
+}
+
+// getJSON 请求 rawURL 并解析 json 响应, 返回 Link 响应头中的下一页地址
+func (h *hostedAPI) getJSON(ctx context.Context, rawURL string, v interface{}) (next string, err error) {
+	h.mu.Lock()
+	until := h.limitedUntil
+	h.mu.Unlock()
+	if h.now().Before(until) {
+		return "", &RateLimitError{host: h.host, Reset: until}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	if authorization, ok := ctx.Value(authorizationKey{}).(string); ok {
+		req.Header.Set("Authorization", authorization)
+	} else if h.credentials != nil {
+		username, password, err := h.credentials(ctx)
+		if err != nil {
+			return "", err
+		}
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err = h.checkRateLimit(resp); err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", &NotFoundRepoError{message: fmt.Sprintf("%s not found.", rawURL)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("GET %s: unexpected status %d: %s", rawURL, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", err
+	}
+	return nextLink(rawURL, resp.Header.Get("Link")), nil
+}
+
+// checkRateLimit 记录限流结束时间, 请求被限流时返回 RateLimitError
+func (h *hostedAPI) checkRateLimit(resp *http.Response) error {
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && (resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""))
+	exhausted := resp.Header.Get("X-RateLimit-Remaining") == "0"
+	if !limited && !exhausted {
+		return nil
+	}
+
+	// 优先使用 Retry-After, 其次是 X-RateLimit-Reset, 都没有时等待一分钟
+	reset := h.now().Add(time.Minute)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		reset = h.now().Add(time.Duration(seconds) * time.Second)
+	} else if unix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		reset = time.Unix(unix, 0)
+	}
+
+	h.mu.Lock()
+	h.limitedUntil = reset
+	h.mu.Unlock()
+
+	if limited {
+		return &RateLimitError{host: h.host, Reset: reset}
+	}
+	return nil
+}
+
+// nextLink 解析 Link 响应头中 rel="next" 的地址, 例如: <https://api.github.com/...&page=2>; rel="next", <...>; rel="last"
+func nextLink(current, link string) string {
+	for _, part := range strings.Split(link, ",") {
+		start, end := strings.Index(part, "<"), strings.Index(part, ">")
+		if start < 0 || end < start || !strings.Contains(part[end:], `rel="next"`) {
+			continue
+		}
+		base, err := url.Parse(current)
+		if err != nil {
+			return ""
+		}
+		next, err := base.Parse(strings.TrimSpace(part[start+1 : end]))
+		if err != nil {
+			return ""
+		}
+		return next.String()
+	}
+	return ""
+}
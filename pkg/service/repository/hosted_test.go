@@ -0,0 +1,184 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_dockerHubRepositoryService_LatestTag(t *testing.T) {
+	var server *httptest.Server
+	var requests int
+	// 按 last_updated 倒序分页
+	pages := map[string]string{
+		"/v2/repositories/library/nginx/tags": `{"next": "%s/v2/repositories/library/nginx/tags/page2?ordering=last_updated", "results": [
+			{"name": "1.20.0", "last_updated": "2021-03-03T00:00:00Z"},
+			{"name": "1.19.0", "last_updated": "2021-03-02T00:00:00Z"}]}`,
+		"/v2/repositories/library/nginx/tags/page2": `{"next": null, "results": [
+			{"name": "1.21.0", "last_updated": "2021-03-01T00:00:00Z"}]}`,
+		"/v2/repositories/arugal/laborer/tags": `{"next": null, "results": [
+			{"name": "v2", "last_updated": "2021-03-02T00:00:00Z"},
+			{"name": "v1", "last_updated": "2021-03-01T00:00:00Z"}]}`,
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Query().Get("ordering") != "last_updated" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.URL.Path == "/v2/repositories/limited/image/tags" {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		page, ok := pages[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = fmt.Fprintf(w, page, server.URL)
+	}))
+	defer server.Close()
+
+	semver, _ := NewTagStrategy(SemverOrder, "", false)
+	tests := []struct {
+		name          string
+		host          string
+		project       string
+		repo          string
+		strategy      *TagStrategy
+		wantTag       string
+		wantRequests  int
+		wantErr       bool
+		wantRateLimit bool
+	}{
+		{name: "official image stops at the first page", repo: "nginx", wantTag: "1.20.0", wantRequests: 1},
+		{name: "official image over pages", repo: "nginx", strategy: semver, wantTag: "1.21.0", wantRequests: 2},
+		{name: "docker.io host", host: "docker.io", project: "arugal", repo: "laborer", wantTag: "v2", wantRequests: 1},
+		{name: "other host", host: "ghcr.io", project: "arugal", repo: "laborer", wantErr: true},
+		{name: "not found", project: "arugal", repo: "unknown", wantErr: true, wantRequests: 1},
+		{name: "rate limited", project: "limited", repo: "image", wantErr: true, wantRateLimit: true, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			d := newDockerHubRepositoryService(&RegistryOptions{Type: DockerHubType, Endpoint: server.URL})
+
+			var opts []LookupOption
+			if tt.strategy != nil {
+				opts = append(opts, WithTagStrategy(tt.strategy))
+			}
+			gotTag, err := d.LatestTag(context.Background(), tt.host, tt.project, tt.repo, opts...)
+			if requests != tt.wantRequests {
+				t.Errorf("LatestTag() requests = %d, want %d", requests, tt.wantRequests)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, ok := err.(*RateLimitError); ok != tt.wantRateLimit {
+				t.Errorf("LatestTag() error = %v, wantRateLimit %v", err, tt.wantRateLimit)
+			}
+			if gotTag != tt.wantTag {
+				t.Errorf("LatestTag() gotTag = %v, want %v", gotTag, tt.wantTag)
+			}
+		})
+	}
+}
+
+func Test_ghcrRepositoryService_LatestTag(t *testing.T) {
+	reset := time.Date(2021, 3, 1, 1, 0, 0, 0, time.UTC)
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.EscapedPath() {
+		case "/users/arugal/packages/container/laborer/versions":
+			if req.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", `</users/arugal/packages/container/laborer/versions?per_page=100&page=2>; rel="next", `+
+					`</users/arugal/packages/container/laborer/versions?per_page=100&page=2>; rel="last"`)
+				_, _ = w.Write([]byte(`[
+					{"name": "sha256:2", "updated_at": "2021-03-02T00:00:00Z", "metadata": {"container": {"tags": ["v2"]}}},
+					{"name": "sha256:0", "updated_at": "2021-03-03T00:00:00Z", "metadata": {"container": {"tags": []}}}]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[
+				{"name": "sha256:1", "updated_at": "2021-03-01T00:00:00Z", "metadata": {"container": {"tags": ["v1"]}}}]`))
+		case "/orgs/scultura-org/packages/container/tools%2Fbuilder/versions":
+			_, _ = w.Write([]byte(`[
+				{"name": "sha256:1", "updated_at": "2021-03-01T00:00:00Z", "metadata": {"container": {"tags": ["v1", "stable"]}}}]`))
+		case "/orgs/limited/packages/container/image/versions":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		project       string
+		repo          string
+		wantTag       string
+		wantErr       bool
+		wantRateLimit bool
+	}{
+		{name: "user package over pages", project: "arugal", repo: "laborer", wantTag: "v2"},
+		{name: "org package with slash", project: "scultura-org/tools", repo: "builder", wantTag: "v1"},
+		{name: "not found", project: "arugal", repo: "unknown", wantErr: true},
+		{name: "rate limited", project: "limited", repo: "image", wantErr: true, wantRateLimit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGHCRRepositoryService(&RegistryOptions{Type: GHCRType, Endpoint: server.URL, Token: "token"}).(*ghcrRepositoryService)
+			g.api.now = func() time.Time { return reset.Add(-time.Minute) }
+
+			gotTag, err := g.LatestTag(context.Background(), ghcrHost, tt.project, tt.repo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if _, ok := err.(*RateLimitError); ok != tt.wantRateLimit {
+				t.Errorf("LatestTag() error = %v, wantRateLimit %v", err, tt.wantRateLimit)
+			}
+			if gotTag != tt.wantTag {
+				t.Errorf("LatestTag() gotTag = %v, want %v", gotTag, tt.wantTag)
+			}
+
+			if tt.wantRateLimit {
+				// 限流结束前不再请求
+				before := requests
+				if _, err = g.LatestTag(context.Background(), ghcrHost, tt.project, tt.repo); err == nil || requests != before {
+					t.Errorf("LatestTag() should not request before reset, error = %v, requests %d -> %d", err, before, requests)
+				}
+			}
+		})
+	}
+}
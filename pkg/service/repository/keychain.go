@@ -0,0 +1,75 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const defaultServiceAccountName = "default"
+
+// +kubebuilder:rbac:groups="",resources=secrets;serviceaccounts,verbs=get
+
+// PullSecretsKeychain 与 kubelet 拉取镜像时一致, 合并 pod 的 imagePullSecrets 以及 ServiceAccount
+// 的 imagePullSecrets 中的凭证, pod 中声明的优先
+func PullSecretsKeychain(ctx context.Context, client kubernetes.Interface, namespace string, podSpec *corev1.PodSpec) Keychain {
+	keychain := Keychain{}
+	if client == nil {
+		return keychain
+	}
+
+	secrets := podSpec.ImagePullSecrets
+	serviceAccountName := podSpec.ServiceAccountName
+	if serviceAccountName == "" {
+		serviceAccountName = defaultServiceAccountName
+	}
+	serviceAccount, err := client.CoreV1().ServiceAccounts(namespace).Get(ctx, serviceAccountName, metav1.GetOptions{})
+	if err != nil {
+		klog.V(2).Infof("get serviceaccount %s/%s err: %v", namespace, serviceAccountName, err)
+	} else {
+		secrets = append(secrets, serviceAccount.ImagePullSecrets...)
+	}
+
+	for _, ref := range secrets {
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			klog.V(2).Infof("get image pull secret %s/%s err: %v", namespace, ref.Name, err)
+			continue
+		}
+
+		var credentials Keychain
+		switch secret.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			credentials, err = ParseDockerConfigJSON(secret.Data[corev1.DockerConfigJsonKey])
+		case corev1.SecretTypeDockercfg:
+			credentials, err = ParseDockerConfig(secret.Data[corev1.DockerConfigKey])
+		default:
+			continue
+		}
+		if err != nil {
+			klog.Errorf("parse image pull secret %s/%s err: %v", namespace, ref.Name, err)
+			continue
+		}
+		keychain.Merge(credentials)
+	}
+	return keychain
+}
@@ -0,0 +1,84 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPullSecretsKeychain(t *testing.T) {
+	dockerConfigJSON := func(name, auths string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: name},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(auths)},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		dockerConfigJSON("pod-secret", `{"auths": {"harbor.example.com": {"username": "pod", "password": "pod"}}}`),
+		dockerConfigJSON("sa-secret", `{"auths": {"harbor.example.com": {"username": "sa", "password": "sa"},
+			"ghcr.io": {"username": "sa", "password": "token"}}}`),
+		dockerConfigJSON("deployer-secret", `{"auths": {"quay.io": {"username": "deployer", "password": "deployer"}}}`),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "opaque"}, Data: map[string][]byte{"username": []byte("x")}},
+		&corev1.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Namespace: "dev", Name: "default"},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-secret"}},
+		},
+		&corev1.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Namespace: "dev", Name: "deployer"},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "deployer-secret"}},
+		},
+	)
+
+	tests := []struct {
+		name    string
+		podSpec corev1.PodSpec
+		want    Keychain
+	}{
+		{
+			name: "pod secrets take precedence over the default serviceaccount",
+			podSpec: corev1.PodSpec{
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "pod-secret"}, {Name: "opaque"}, {Name: "missing"}},
+			},
+			want: Keychain{
+				"harbor.example.com": {Username: "pod", Password: "pod"},
+				"ghcr.io":            {Username: "sa", Password: "token"},
+			},
+		},
+		{
+			name:    "serviceaccount of the pod",
+			podSpec: corev1.PodSpec{ServiceAccountName: "deployer"},
+			want: Keychain{
+				"quay.io": {Username: "deployer", Password: "deployer"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PullSecretsKeychain(context.Background(), client, "dev", &tt.podSpec)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PullSecretsKeychain() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -16,13 +16,16 @@
 
 package repository
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 type mockRepositoryService struct {
 	tags map[string]string
 }
 
-func (m mockRepositoryService) LatestTag(host, projectName, repoName string) (tag string, err error) {
+func (m mockRepositoryService) LatestTag(_ context.Context, host, projectName, repoName string, _ ...LookupOption) (tag string, err error) {
 	var image string
 	if host != "" && projectName != "" {
 		image = fmt.Sprintf("%s/%s/%s", host, projectName, repoName)
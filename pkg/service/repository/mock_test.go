@@ -16,7 +16,10 @@
 
 package repository
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func Test_mockRepositoryService_LatestTag(t *testing.T) {
 	type fields struct {
@@ -98,7 +101,7 @@ func Test_mockRepositoryService_LatestTag(t *testing.T) {
 			m := mockRepositoryService{
 				tags: tt.fields.tags,
 			}
-			gotTag, err := m.LatestTag(tt.args.host, tt.args.projectName, tt.args.repoName)
+			gotTag, err := m.LatestTag(context.Background(), tt.args.host, tt.args.projectName, tt.args.repoName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -17,43 +17,265 @@
 package repository
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"time"
 
+	"github.com/arugal/laborer/pkg/simple/client/registry"
 	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// HarborType Harbor API
+	HarborType = "harbor"
+	// RegistryType OCI Distribution API, eg: registry:2, Zot
+	RegistryType = "registry"
+	// DockerHubType Docker Hub tags api
+	DockerHubType = "dockerhub"
+	// GHCRType GitHub Packages api of ghcr.io
+	GHCRType = "ghcr"
 )
 
 type RepositoryServiceOptions struct {
 	Mock     bool              `json:"mock,omitempty" yaml:"mock,omitempty"`
 	MockTags map[string]string `json:"mockTags,omitempty" yaml:"mockTags,omitempty"`
+	// Type repository api type, optional: harbor; registry; dockerhub; ghcr
+	Type string `json:"type" yaml:"type"`
 	// repository address
 	Host               string `json:"host" yaml:"host"`
 	Protocol           string `json:"protocol" yaml:"protocol"`
 	InsecureSkipVerify bool   `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
 	ApiPathPrefix      string `json:"apiPathPrefix" yaml:"apiPathPrefix"`
+	Username           string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password           string `json:"password,omitempty" yaml:"password,omitempty"`
+	// Token bearer token of the hosted api, required by ghcr
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+	// CredentialsSecret <namespace>/<name> of the secret with the username and password keys, harbor only
+	CredentialsSecret string `json:"credentialsSecret,omitempty" yaml:"credentialsSecret,omitempty"`
+	// CacheTTL how long the latest tag is cached, the push events invalidate it earlier. 0 disables the cache
+	CacheTTL time.Duration `json:"cacheTTL" yaml:"cacheTTL"`
+	// LookupTimeout the time budget of the lookups of an admission request, shorter than the timeout of the webhook
+	LookupTimeout time.Duration `json:"lookupTimeout" yaml:"lookupTimeout"`
+	// Registries the lookups are routed by the host of the image, the single registry
+	// above is used when it is empty. Only configurable through the configuration file
+	Registries []RegistryOptions `json:"registries,omitempty" yaml:"registries,omitempty"`
+}
+
+// RegistryOptions a registry of the Registries
+type RegistryOptions struct {
+	// Type repository api type, optional: harbor; registry; dockerhub; ghcr
+	Type string `json:"type" yaml:"type"`
+	// Endpoint scheme and host of the registry, eg: https://harbor.example.com. Optional for dockerhub
+	// and ghcr, where it overrides the address of the hosted api
+	Endpoint      string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	ApiPathPrefix string `json:"apiPathPrefix,omitempty" yaml:"apiPathPrefix,omitempty"`
+	Username      string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password      string `json:"password,omitempty" yaml:"password,omitempty"`
+	Token         string `json:"token,omitempty" yaml:"token,omitempty"`
+	// CredentialsSecret <namespace>/<name> of the secret with the username and password keys, eg: a harbor
+	// robot account. It is read on every lookup and takes precedence over Username and Password, harbor only
+	CredentialsSecret string `json:"credentialsSecret,omitempty" yaml:"credentialsSecret,omitempty"`
+	// InsecureSkipVerify and CAFile the tls settings of https endpoint
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+	CAFile             string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	// Aliases the other hosts of the registry used in the images, eg: a domain of the DMZ or ip:port
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+}
+
+// Host the host of the registry used in the images
+func (r *RegistryOptions) Host() string {
+	switch r.Type {
+	case DockerHubType:
+		return dockerHubHost
+	case GHCRType:
+		return ghcrHost
+	}
+	if u, err := url.Parse(r.Endpoint); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+func (r *RegistryOptions) validate() error {
+	if r.CredentialsSecret != "" {
+		if r.Type != HarborType {
+			return fmt.Errorf("registry credentials secret only support %s", HarborType)
+		}
+		if namespace, name := splitSecretRef(r.CredentialsSecret); namespace == "" || name == "" {
+			return fmt.Errorf("registry credentials secret %q must be <namespace>/<name>", r.CredentialsSecret)
+		}
+	}
+	switch r.Type {
+	case HarborType, RegistryType:
+		u, err := url.Parse(r.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("registry endpoint %q must be http(s)://<host>", r.Endpoint)
+		}
+	case DockerHubType:
+	case GHCRType:
+		if r.Token == "" {
+			return fmt.Errorf("registry token is required by %s", GHCRType)
+		}
+	default:
+		return fmt.Errorf("registry type only support %s, %s, %s, %s", HarborType, RegistryType, DockerHubType, GHCRType)
+	}
+	return nil
+}
+
+// registries the configured registries, or the single registry of the flags
+func (r *RepositoryServiceOptions) registries() []RegistryOptions {
+	if len(r.Registries) > 0 {
+		return r.Registries
+	}
+	if r.Host == "" && r.Type != DockerHubType && r.Type != GHCRType {
+		return nil
+	}
+	registry := RegistryOptions{
+		Type:               r.Type,
+		ApiPathPrefix:      r.ApiPathPrefix,
+		Username:           r.Username,
+		Password:           r.Password,
+		Token:              r.Token,
+		CredentialsSecret:  r.CredentialsSecret,
+		InsecureSkipVerify: r.InsecureSkipVerify,
+	}
+	if r.Host != "" && r.Type != DockerHubType && r.Type != GHCRType {
+		registry.Endpoint = fmt.Sprintf("%s://%s", r.Protocol, r.Host)
+	}
+	return []RegistryOptions{registry}
 }
 
 func (r *RepositoryServiceOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&r.Mock, "repository-mock", r.Mock, "use mock repository service")
-	fs.StringVar(&r.Host, "repository-host", r.Host, "image repository host, eg: demo.goharbor.io (harbor is currently supported only)")
+	fs.StringVar(&r.Type, "repository-type", r.Type, "repository api type, optional: harbor; registry (OCI Distribution API); dockerhub; ghcr")
+	fs.StringVar(&r.Host, "repository-host", r.Host, "image repository host, eg: demo.goharbor.io")
 	fs.StringVar(&r.Protocol, "repository-protocol", r.Protocol, "repository protocol, optional: http; https")
 	fs.BoolVar(&r.InsecureSkipVerify, "repository-insecure-skip-verify", r.InsecureSkipVerify,
 		"if true, server-side certificate authentication is skipped when the protocol is https")
 	fs.StringVar(&r.ApiPathPrefix, "repository-api-path-prefix", r.ApiPathPrefix, "")
+	fs.StringVar(&r.Username, "repository-username", r.Username, "username of the repository, used for basic auth and the token service")
+	fs.StringVar(&r.Password, "repository-password", r.Password, "password of the repository")
+	fs.StringVar(&r.CredentialsSecret, "repository-credentials-secret", r.CredentialsSecret,
+		"<namespace>/<name> of the secret with the username and password keys, eg: a harbor robot account")
+	fs.DurationVar(&r.CacheTTL, "repository-cache-ttl", r.CacheTTL, "how long the latest tag is cached, the push events invalidate it earlier, 0 disables the cache")
+	fs.DurationVar(&r.LookupTimeout, "repository-lookup-timeout", r.LookupTimeout,
+		"time budget of the latest tag lookups of an admission request, must be shorter than the timeout of the webhook")
+	fs.StringVar(&r.Token, "repository-token", r.Token, "bearer token of the hosted api, eg: a GitHub token with read:packages for ghcr")
 }
 
 func (r *RepositoryServiceOptions) Validate() (errs []error) {
 	if r.Protocol != "http" && r.Protocol != "https" {
 		errs = append(errs, fmt.Errorf("repository protocol only support http, https"))
 	}
+	if r.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("repository cache ttl must not be negative"))
+	}
+	if r.LookupTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("repository lookup timeout must be positive"))
+	}
+	hosts := map[string]struct{}{}
+	for _, registry := range r.registries() {
+		if err := registry.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, host := range append([]string{registry.Host()}, registry.Aliases...) {
+			if _, ok := hosts[host]; ok {
+				errs = append(errs, fmt.Errorf("duplicate registry host %s", host))
+			}
+			hosts[host] = struct{}{}
+		}
+	}
 	return errs
 }
 
 func NewRepositoryServiceOptions() *RepositoryServiceOptions {
 	return &RepositoryServiceOptions{
 		Mock:               false,
+		Type:               HarborType,
 		Host:               "",
 		Protocol:           "https",
 		InsecureSkipVerify: true,
-		ApiPathPrefix:      "/api/v2.0",
+		ApiPathPrefix:      harborAPIPathPrefix,
+		CacheTTL:           time.Minute,
+		LookupTimeout:      10 * time.Second,
+	}
+}
+
+// RegistryClientOptions the OCI Distribution API client of the host, the configured registry whose host or
+// alias is the host provides the endpoint and tls settings. The credentials are resolved on every call in the
+// same order as the latest tag lookups: the keychain of the workload, the credentials secret, the username and
+// password of the registry. The other hosts are accessed with the keychain or anonymously
+func (r *RepositoryServiceOptions) RegistryClientOptions(ctx context.Context, client kubernetes.Interface, host string,
+	keychain Keychain) (registry.Options, error) {
+	options := registry.Options{
+		Endpoint: "https://" + host,
+		Timeout:  30 * time.Second,
+	}
+	if host == dockerHubHost {
+		options.Endpoint = dockerHubRegistryEndpoint
+	}
+	credential, ok := keychain.Lookup(host)
+	for _, configured := range r.registries() {
+		if configured.Host() != host && !containsString(configured.Aliases, host) {
+			continue
+		}
+		config, err := tlsConfig(&configured)
+		if err != nil {
+			return options, err
+		}
+		options.TLSConfig = config
+		switch configured.Type {
+		case HarborType, RegistryType:
+			options.Endpoint = configured.Endpoint
+			options.Token = configured.Token
+		}
+
+		// 凭证可能以别名或镜像仓库的 host 保存
+		if !ok {
+			credential, ok = keychain.Lookup(configured.Host())
+		}
+		if !ok {
+			if credential, ok, err = configuredCredential(ctx, client, &configured); err != nil {
+				return options, err
+			}
+		}
+		break
+	}
+	if ok {
+		options.Username, options.Password = credential.Username, credential.Password
+	}
+	return options, nil
+}
+
+// configuredCredential 镜像仓库配置的凭证, 每次读取 secret 以便轮换 robot 账号的密码
+func configuredCredential(ctx context.Context, client kubernetes.Interface, configured *RegistryOptions) (Credential, bool, error) {
+	switch {
+	case configured.CredentialsSecret != "":
+		if client == nil {
+			return Credential{}, false, fmt.Errorf("kubernetes client is required by the credentials secret %s", configured.CredentialsSecret)
+		}
+		username, password, err := secretCredentials(client, configured.CredentialsSecret)(ctx)
+		if err != nil {
+			return Credential{}, false, err
+		}
+		return Credential{Username: username, Password: password}, true, nil
+	case configured.Username != "":
+		return Credential{Username: configured.Username, Password: configured.Password}, true, nil
+	case configured.Type == GHCRType && configured.Token != "":
+		// the token service of ghcr.io accepts the GitHub token as the password
+		return Credential{Username: "laborer", Password: configured.Token}, true, nil
+	}
+	return Credential{}, false, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,241 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arugal/laborer/pkg/simple/client/registry"
+	"k8s.io/klog"
+)
+
+const (
+	// imageCreatedAnnotation OCI 镜像创建时间的 annotation
+	imageCreatedAnnotation = "org.opencontainers.image.created"
+
+	// createdTTL tag 创建时间的缓存时间, tag 可能被重新 push
+	createdTTL = 10 * time.Minute
+	// createdCacheSize 缓存的 tag 数量上限, 超过时淘汰最早缓存的 tag
+	createdCacheSize = 10000
+)
+
+// registryRepositoryService 基于 OCI Distribution API 的镜像服务, 适用于 registry:2, Zot 等
+type registryRepositoryService struct {
+	host string
+
+	client *registry.Client
+	// options 和 clients 用于工作负载凭证的客户端, 每个凭证一个客户端以免混用 token
+	options registry.Options
+	clients map[Credential]*registry.Client
+
+	// created tag 对应的创建时间, 避免每次查询都读取所有 tag 的 manifest
+	created *createdCache
+	mu      sync.Mutex
+}
+
+func newRegistryRepositoryService(options *RegistryOptions) (RepositoryService, error) {
+	config, err := tlsConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions := registry.Options{
+		Endpoint:  options.Endpoint,
+		Username:  options.Username,
+		Password:  options.Password,
+		Token:     options.Token,
+		TLSConfig: config,
+		Timeout:   30 * time.Second,
+	}
+	client, err := registry.NewClient(clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &registryRepositoryService{
+		host:    options.Host(),
+		client:  client,
+		options: clientOptions,
+		clients: map[Credential]*registry.Client{},
+		created: newCreatedCache(createdCacheSize, createdTTL),
+	}, nil
+}
+
+func (r *registryRepositoryService) LatestTag(ctx context.Context, host, projectName, repoName string, opts ...LookupOption) (tag string, err error) {
+	if host != r.host {
+		return tag, &NotSupportRegisterError{r.host}
+	}
+	client, err := r.clientOf(lookupCredential(r.host, opts))
+	if err != nil {
+		return
+	}
+
+	name := repoName
+	if projectName != "" {
+		name = fmt.Sprintf("%s/%s", projectName, repoName)
+	}
+	tags, err := client.Tags(ctx, name)
+	if err != nil {
+		if statusErr, ok := err.(*registry.StatusError); ok && statusErr.StatusCode == http.StatusNotFound {
+			return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s not found.", name)}
+		}
+		return
+	}
+	if len(tags) == 0 {
+		return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s not found.", name)}
+	}
+
+	// 先按策略和全局规则过滤, 只查询匹配的 tag 的创建时间, 不按 push 时间选择时无需查询
+	strategy := lookupStrategy(opts)
+	var pushed PushedTagSlice
+	for _, t := range tags {
+		if !strategy.Match(t) {
+			continue
+		}
+		if !strategy.UsePushTime() {
+			pushed = append(pushed, PushedTag{Name: t})
+			continue
+		}
+		created, err := r.createdTime(ctx, client, name, t)
+		if ctx.Err() != nil {
+			return tag, ctx.Err()
+		}
+		if err != nil {
+			klog.V(4).Infof("registry %s get created time of %s:%s err: %v", r.host, name, t, err)
+			continue
+		}
+		pushed = append(pushed, PushedTag{Name: t, PushTime: created})
+	}
+	if tag, ok := strategy.Select(pushed); ok {
+		return tag, nil
+	}
+	return tag, &NotFoundRepoError{message: fmt.Sprintf("repo %s has no readable image matching %s.", name, strategy)}
+}
+
+// createdTime 镜像的创建时间, 优先使用 config 中的 created, 其次是 OCI annotation
+func (r *registryRepositoryService) createdTime(ctx context.Context, client *registry.Client, name, tag string) (time.Time, error) {
+	key := name + ":" + tag
+	if created, ok := r.created.get(key); ok {
+		return created, nil
+	}
+
+	manifest, err := client.Manifest(ctx, name, tag)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var created time.Time
+	if value, ok := manifest.Annotations[imageCreatedAnnotation]; ok {
+		created, err = time.Parse(time.RFC3339, value)
+	}
+	if created.IsZero() {
+		var config *registry.ImageConfig
+		if config, err = client.ConfigOf(ctx, name, manifest); err != nil {
+			return time.Time{}, err
+		}
+		created = config.Created
+	}
+
+	r.created.set(key, created)
+	return created, nil
+}
+
+// clientOf 凭证对应的客户端, 没有凭证时使用配置的客户端
+func (r *registryRepositoryService) clientOf(credential *Credential) (*registry.Client, error) {
+	if credential == nil {
+		return r.client, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, ok := r.clients[*credential]; ok {
+		return client, nil
+	}
+	options := r.options
+	options.Username, options.Password, options.Token = credential.Username, credential.Password, ""
+	client, err := registry.NewClient(options)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[*credential] = client
+	return client, nil
+}
+
+// createdCache 有容量上限和过期时间的 tag 创建时间缓存, 超过容量时淘汰最早缓存的 tag
+type createdCache struct {
+	size int
+	ttl  time.Duration
+
+	// entries tag -> order 中的元素
+	entries map[string]*list.Element
+	// order 由早到晚缓存的 createdEntry
+	order *list.List
+	mu    sync.Mutex
+
+	now func() time.Time
+}
+
+type createdEntry struct {
+	key     string
+	created time.Time
+	expires time.Time
+}
+
+func newCreatedCache(size int, ttl time.Duration) *createdCache {
+	return &createdCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *createdCache) get(key string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	entry := element.Value.(*createdEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return time.Time{}, false
+	}
+	return entry.created, true
+}
+
+func (c *createdCache) set(key string, created time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+	}
+	c.entries[key] = c.order.PushBack(&createdEntry{key: key, created: created, expires: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*createdEntry).key)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arugal/laborer/pkg/simple/client/registry"
+	"github.com/arugal/laborer/pkg/simple/client/registry/registrytest"
+)
+
+func Test_registryRepositoryService_LatestTag(t *testing.T) {
+	base := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		setup    func(r *registrytest.Registry)
+		project  string
+		repo     string
+		wantTag  string
+		wantErr  bool
+	}{
+		{
+			name: "latest created",
+			setup: func(r *registrytest.Registry) {
+				r.PushImage("project/image", "v1", base)
+				r.PushImage("project/image", "v3", base.Add(2*time.Hour))
+				r.PushImage("project/image", "v2", base.Add(time.Hour))
+			},
+			project: "project",
+			repo:    "image",
+			wantTag: "v3",
+		},
+		{
+			name: "paginated tags",
+			setup: func(r *registrytest.Registry) {
+				for i := 0; i < 250; i++ {
+					r.PushImage("image", fmt.Sprintf("build-%03d", i), base.Add(time.Duration(i%200)*time.Minute))
+				}
+			},
+			repo:    "image",
+			wantTag: "build-199",
+		},
+		{
+			name:     "bearer token auth",
+			username: "admin",
+			password: "secret",
+			setup: func(r *registrytest.Registry) {
+				r.PushImage("project/image", "v1", base)
+				r.PushImage("project/image", "v2", base.Add(time.Hour))
+			},
+			project: "project",
+			repo:    "image",
+			wantTag: "v2",
+		},
+		{
+			name:     "bearer token auth with wrong password",
+			username: "admin",
+			password: "wrong",
+			setup: func(r *registrytest.Registry) {
+				r.PushImage("project/image", "v1", base)
+			},
+			project: "project",
+			repo:    "image",
+			wantErr: true,
+		},
+		{
+			name: "image index",
+			setup: func(r *registrytest.Registry) {
+				r.PushImage("image", "v1", base.Add(time.Hour))
+				amd64 := r.PushImage("image", "", base.Add(2*time.Hour))
+				r.PushManifest("image", "v2", &registry.Manifest{
+					SchemaVersion: 2,
+					MediaType:     registry.MediaTypeOCIIndex,
+					Manifests: []registry.Descriptor{
+						{
+							MediaType: registry.MediaTypeOCIManifest,
+							Digest:    amd64,
+							Platform:  &registry.Platform{OS: "linux", Architecture: "amd64"},
+						},
+					},
+				})
+			},
+			repo:    "image",
+			wantTag: "v2",
+		},
+		{
+			name:    "not found",
+			setup:   func(r *registrytest.Registry) {},
+			project: "project",
+			repo:    "image",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := registrytest.NewRegistry()
+			defer r.Close()
+			r.Username, r.Password = "admin", "secret"
+			if tt.username == "" {
+				r.Username, r.Password = "", ""
+			}
+			tt.setup(r)
+
+			options := NewRepositoryServiceOptions()
+			options.Type = RegistryType
+			options.Protocol = "http"
+			options.Host = r.Host()
+			options.Username = tt.username
+			options.Password = tt.password
+			service, err := NewRepositoryService(options, nil)
+			if err != nil {
+				t.Fatalf("NewRepositoryService() error = %v", err)
+			}
+
+			gotTag, err := service.LatestTag(context.Background(), r.Host(), tt.project, tt.repo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotTag != tt.wantTag {
+				t.Errorf("LatestTag() gotTag = %v, want %v", gotTag, tt.wantTag)
+			}
+		})
+	}
+}
+
+func Test_registryRepositoryService_LatestTag_manifestRequests(t *testing.T) {
+	base := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	r := registrytest.NewRegistry()
+	defer r.Close()
+	r.PushImage("image", "v1", base)
+	r.PushImage("image", "v2", base.Add(time.Hour))
+	r.PushImage("image", "buildcache-1", base.Add(2*time.Hour))
+	r.PushImage("image", "buildcache-2", base.Add(3*time.Hour))
+
+	service, err := newRegistryRepositoryService(&RegistryOptions{Type: RegistryType, Endpoint: r.URL})
+	if err != nil {
+		t.Fatalf("newRegistryRepositoryService() error = %v", err)
+	}
+	strategy, _ := NewTagStrategy(PushTimeOrder, `^v\d+$`, false)
+
+	// 过滤掉的 tag 不读取 manifest, 第二次查询使用缓存的创建时间
+	for i := 0; i < 2; i++ {
+		tag, err := service.LatestTag(context.Background(), r.Host(), "", "image", WithTagStrategy(strategy))
+		if err != nil || tag != "v2" {
+			t.Fatalf("LatestTag() = %v, %v, want v2", tag, err)
+		}
+		if requests := r.ManifestRequests(); requests != 2 {
+			t.Errorf("LatestTag() manifest requests = %d, want 2", requests)
+		}
+	}
+}
+
+func Test_createdCache(t *testing.T) {
+	base := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	c := newCreatedCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.set("image:v1", base)
+	c.set("image:v2", base)
+	c.set("image:v3", base)
+	if _, ok := c.get("image:v1"); ok {
+		t.Errorf("get() the oldest tag should be evicted")
+	}
+	if _, ok := c.get("image:v3"); !ok {
+		t.Errorf("get() the newest tag should be cached")
+	}
+	if len(c.entries) != 2 || c.order.Len() != 2 {
+		t.Errorf("cache size = %d, %d, want 2", len(c.entries), c.order.Len())
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.get("image:v3"); ok {
+		t.Errorf("get() the expired tag should not be cached")
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("cache size = %d, want 1 after the expired tag is removed", len(c.entries))
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	// PushTimeOrder 最近 push 的 tag, 默认的策略
+	PushTimeOrder = "push-time"
+	// SemverOrder 最高的语义化版本, 忽略不是语义化版本的 tag
+	SemverOrder = "semver"
+	// AlphabeticalOrder 字典序最大的 tag
+	AlphabeticalOrder = "alphabetical"
+)
+
+// TagStrategy 从镜像仓库的 tag 中选择最新 tag 的策略
+type TagStrategy struct {
+	// Order tag 的排序方式, 为空时按 push 时间排序
+	Order string
+	// Prerelease semver 排序时是否包含预发布版本, 例如: 1.0.0-rc.1
+	Prerelease bool
+	// Filter 只选择匹配的 tag, 为 nil 时不过滤
+	Filter *regexp.Regexp
+	// Allow 全局的过滤规则, 为 nil 时不过滤, 不参与缓存的 key
+	Allow func(tag string) bool
+}
+
+// defaultTagStrategy 最近 push 的 tag
+var defaultTagStrategy = &TagStrategy{Order: PushTimeOrder}
+
+// NewTagStrategy 解析策略, filter 为空时不过滤
+func NewTagStrategy(order, filter string, prerelease bool) (*TagStrategy, error) {
+	strategy := &TagStrategy{Order: order, Prerelease: prerelease}
+	switch order {
+	case "":
+		strategy.Order = PushTimeOrder
+	case PushTimeOrder, SemverOrder, AlphabeticalOrder:
+	default:
+		return nil, fmt.Errorf("unknown tag order %q, must be one of %s, %s, %s", order, PushTimeOrder, SemverOrder, AlphabeticalOrder)
+	}
+	if filter != "" {
+		re, err := regexp.Compile(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag filter %q: %v", filter, err)
+		}
+		strategy.Filter = re
+	}
+	return strategy, nil
+}
+
+// String 策略的唯一标识, 用作缓存的 key
+func (s *TagStrategy) String() string {
+	key := s.Order
+	if s.Order == SemverOrder && s.Prerelease {
+		key += "+prerelease"
+	}
+	if s.Filter != nil {
+		key += "~" + s.Filter.String()
+	}
+	return key
+}
+
+// UsePushTime 是否需要 tag 的 push 时间, 不需要时镜像服务可以只查询 tag 的名称
+func (s *TagStrategy) UsePushTime() bool {
+	return s.Order == PushTimeOrder
+}
+
+// Match tag 是否参与选择, 签名的 tag 和被过滤的 tag 不参与选择
+func (s *TagStrategy) Match(tag string) bool {
+	if eventservice.ArtifactTypeOf(tag) != eventservice.ImageArtifact {
+		return false
+	}
+	if s.Allow != nil && !s.Allow(tag) {
+		return false
+	}
+	if s.Filter != nil && !s.Filter.MatchString(tag) {
+		return false
+	}
+	if s.Order == SemverOrder {
+		v, err := version.ParseSemantic(tag)
+		if err != nil || (!s.Prerelease && v.PreRelease() != "") {
+			return false
+		}
+	}
+	return true
+}
+
+// Select 按策略选择 tag, 没有匹配的 tag 时返回 false
+func (s *TagStrategy) Select(tags PushedTagSlice) (string, bool) {
+	var matched PushedTagSlice
+	for _, tag := range tags {
+		if s.Match(tag.Name) {
+			matched = append(matched, tag)
+		}
+	}
+	if len(matched) == 0 {
+		return "", false
+	}
+
+	switch s.Order {
+	case SemverOrder:
+		sort.SliceStable(matched, func(i, j int) bool {
+			return version.MustParseSemantic(matched[i].Name).LessThan(version.MustParseSemantic(matched[j].Name))
+		})
+		return matched[len(matched)-1].Name, true
+	case AlphabeticalOrder:
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+		return matched[len(matched)-1].Name, true
+	default:
+		return matched.Sort().Latest().Name, true
+	}
+}
+
+// WithTagStrategy 使用 strategy 选择 tag, 默认选择最近 push 的 tag
+func WithTagStrategy(strategy *TagStrategy) LookupOption {
+	return func(options *LookupOptions) {
+		options.Strategy = strategy
+	}
+}
+
+// lookupStrategy 本次查询的策略
+func lookupStrategy(opts []LookupOption) *TagStrategy {
+	options := &LookupOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	strategy := options.Strategy
+	if strategy == nil {
+		strategy = defaultTagStrategy
+	}
+	if options.TagFilter != nil {
+		filtered := *strategy
+		filtered.Allow = options.TagFilter
+		return &filtered
+	}
+	return strategy
+}
+
+// WithTagFilter 只选择 filter 允许的 tag, 例如全局的过滤规则
+func WithTagFilter(filter func(tag string) bool) LookupOption {
+	return func(options *LookupOptions) {
+		options.TagFilter = filter
+	}
+}
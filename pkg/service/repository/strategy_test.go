@@ -0,0 +1,69 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTagStrategy_Select(t *testing.T) {
+	now := time.Now()
+	tags := PushedTagSlice{
+		{Name: "v1.10.0", PushTime: now.Add(-4 * time.Hour)},
+		{Name: "v1.9.0", PushTime: now.Add(-3 * time.Hour)},
+		{Name: "v2.0.0-rc.1", PushTime: now.Add(-2 * time.Hour)},
+		{Name: "cache-main", PushTime: now.Add(-1 * time.Hour)},
+		{Name: "sha256-abc.sig", PushTime: now},
+	}
+
+	tests := []struct {
+		name       string
+		order      string
+		filter     string
+		prerelease bool
+		wantTag    string
+		wantOK     bool
+		wantErr    bool
+	}{
+		{name: "push time by default", wantTag: "cache-main", wantOK: true},
+		{name: "push time with filter", order: PushTimeOrder, filter: `^v\d+\.\d+\.\d+$`, wantTag: "v1.9.0", wantOK: true},
+		{name: "semver", order: SemverOrder, wantTag: "v1.10.0", wantOK: true},
+		{name: "semver with prerelease", order: SemverOrder, prerelease: true, wantTag: "v2.0.0-rc.1", wantOK: true},
+		{name: "alphabetical", order: AlphabeticalOrder, wantTag: "v2.0.0-rc.1", wantOK: true},
+		{name: "alphabetical with filter", order: AlphabeticalOrder, filter: `^v1\.`, wantTag: "v1.9.0", wantOK: true},
+		{name: "no tag matched", order: SemverOrder, filter: `^release-`},
+		{name: "unknown order", order: "newest", wantErr: true},
+		{name: "invalid filter", filter: `^v(`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := NewTagStrategy(tt.order, tt.filter, tt.prerelease)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewTagStrategy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			gotTag, gotOK := strategy.Select(tags)
+			if gotTag != tt.wantTag || gotOK != tt.wantOK {
+				t.Errorf("Select() = %v, %v, want %v, %v", gotTag, gotOK, tt.wantTag, tt.wantOK)
+			}
+		})
+	}
+}
@@ -18,38 +18,32 @@ package repository
 
 import (
 	"sort"
-
-	"github.com/scultura-org/harborapi"
+	"time"
 )
 
-// 根据 PushTime 对 Artifact 排序
-type ArtifactSlice []harborapi.Artifact
-
-func (t ArtifactSlice) Len() int           { return len(t) }
-func (t ArtifactSlice) Less(i, j int) bool { return t[i].PushTime.Before(t[j].PushTime) }
-func (t ArtifactSlice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
-
-func (t ArtifactSlice) Sort() ArtifactSlice {
-	sort.Sort(t)
-	return t
+// PushedTag 镜像仓库中的 tag 及其 push 时间
+type PushedTag struct {
+	Name     string
+	PushTime time.Time
 }
 
-func (t ArtifactSlice) Latest() harborapi.Artifact {
-	return t[len(t)-1]
-}
+// 根据 PushTime 对 PushedTag 排序, PushTime 相同时按名称排序
+type PushedTagSlice []PushedTag
 
-// 根据 PushTime 对 Tag 排序
-type TagSlice []harborapi.Tag
-
-func (t TagSlice) Len() int           { return len(t) }
-func (t TagSlice) Less(i, j int) bool { return t[i].PushTime.Before(t[j].PushTime) }
-func (t TagSlice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t PushedTagSlice) Len() int { return len(t) }
+func (t PushedTagSlice) Less(i, j int) bool {
+	if t[i].PushTime.Equal(t[j].PushTime) {
+		return t[i].Name < t[j].Name
+	}
+	return t[i].PushTime.Before(t[j].PushTime)
+}
+func (t PushedTagSlice) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
 
-func (t TagSlice) Sort() TagSlice {
+func (t PushedTagSlice) Sort() PushedTagSlice {
 	sort.Sort(t)
 	return t
 }
 
-func (t TagSlice) Latest() harborapi.Tag {
+func (t PushedTagSlice) Latest() PushedTag {
 	return t[len(t)-1]
 }
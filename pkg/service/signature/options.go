@@ -0,0 +1,50 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package signature
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type SignatureOptions struct {
+	// Enabled verify the cosign signatures of the images in the namespaces annotated with the public keys
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// LookupTimeout timeout of fetching the signatures of an image from the registry
+	LookupTimeout time.Duration `json:"lookupTimeout,omitempty" yaml:"lookupTimeout,omitempty"`
+}
+
+func (s *SignatureOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&s.Enabled, "signature-verification", s.Enabled, "verify the cosign signatures of the images before updating the workloads "+
+		"and resolving the latest tags, in the namespaces annotated with "+PublicKeysAnnotation)
+	fs.DurationVar(&s.LookupTimeout, "signature-lookup-timeout", s.LookupTimeout, "timeout of fetching the signatures of an image from the registry")
+}
+
+func (s *SignatureOptions) Validate() (errs []error) {
+	if s.LookupTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("signature lookup timeout must be positive"))
+	}
+	return errs
+}
+
+func NewSignatureOptions() *SignatureOptions {
+	return &SignatureOptions{
+		LookupTimeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,267 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/simple/client/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// PublicKeysAnnotation namespace 的 annotation, 值为同一 namespace 中保存 cosign 公钥 (PEM) 的 configmap 名称
+	PublicKeysAnnotation = "laborer.signature.public-keys"
+
+	// signatureTagSuffix cosign 签名的 tag 为 sha256-<hex>.sig
+	signatureTagSuffix = ".sig"
+	// signatureAnnotation 签名 manifest 中 layer 的 annotation, 值为 base64 编码的签名
+	signatureAnnotation = "dev.cosignproject.cosign/signature"
+)
+
+// UnsignedError 镜像没有 cosign 签名
+type UnsignedError struct {
+	image string
+}
+
+func (e UnsignedError) Error() string {
+	return fmt.Sprintf("image %s is not signed", e.image)
+}
+
+// InvalidSignatureError 镜像的签名都无法通过公钥的校验
+type InvalidSignatureError struct {
+	image  string
+	reason string
+}
+
+func (e InvalidSignatureError) Error() string {
+	return fmt.Sprintf("image %s has no valid signature: %s", e.image, e.reason)
+}
+
+// Verifier 校验镜像的签名
+type Verifier interface {
+	// Verify 使用 namespace 配置的公钥校验 image 的 cosign 签名并返回通过校验的 digest, 调用方应使用该 digest 固定镜像,
+	// 以免校验之后 tag 被重新 push. image 带有 digest (repo:tag@sha256:...) 时校验该 digest, 否则校验 tag 当前的 digest.
+	// namespace 未配置公钥时不校验并返回空的 digest, keychain 为工作负载的镜像仓库凭证, 例如 imagePullSecrets
+	Verify(ctx context.Context, namespace, image string, keychain repositoryservice.Keychain) (string, error)
+}
+
+// ClientOptionsFunc 镜像仓库 host 对应的 registry 客户端配置, keychain 中的凭证优先
+type ClientOptionsFunc func(ctx context.Context, host string, keychain repositoryservice.Keychain) (registry.Options, error)
+
+type cosignVerifier struct {
+	client        kubernetes.Interface
+	clientOptions ClientOptionsFunc
+	timeout       time.Duration
+}
+
+// NewVerifier 未开启签名校验时返回 nil
+func NewVerifier(options *SignatureOptions, client kubernetes.Interface, clientOptions ClientOptionsFunc) Verifier {
+	if !options.Enabled {
+		return nil
+	}
+	return &cosignVerifier{
+		client:        client,
+		clientOptions: clientOptions,
+		timeout:       options.LookupTimeout,
+	}
+}
+
+func (c *cosignVerifier) Verify(ctx context.Context, namespace, image string, keychain repositoryservice.Keychain) (string, error) {
+	keys, err := c.publicKeys(ctx, namespace)
+	if err != nil || len(keys) == 0 {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	host, repository, reference := splitReference(image)
+	// 每次校验时读取凭证, 不同工作负载的凭证不同, secret 中的凭证也可能被轮换
+	options, err := c.clientOptions(ctx, host, keychain)
+	if err != nil {
+		return "", err
+	}
+	client, err := registry.NewClient(options)
+	if err != nil {
+		return "", err
+	}
+
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		manifest, err := client.Manifest(ctx, repository, reference)
+		if err != nil {
+			return "", fmt.Errorf("get manifest of %s err: %v", image, err)
+		}
+		digest = manifest.Digest
+	}
+
+	signatures, err := client.Manifest(ctx, repository, strings.Replace(digest, ":", "-", 1)+signatureTagSuffix)
+	if err != nil {
+		if statusErr, ok := err.(*registry.StatusError); ok && statusErr.StatusCode == http.StatusNotFound {
+			return "", &UnsignedError{image: image}
+		}
+		return "", fmt.Errorf("get signatures of %s err: %v", image, err)
+	}
+
+	reason := "no signature layer"
+	for _, layer := range signatures.Layers {
+		signature, ok := layer.Annotations[signatureAnnotation]
+		if !ok {
+			continue
+		}
+		payload, err := client.Blob(ctx, repository, layer.Digest)
+		if err != nil {
+			return "", fmt.Errorf("get signature payload of %s err: %v", image, err)
+		}
+		if reason = verifyPayload(payload, layer.Digest, signature, digest, keys); reason == "" {
+			return digest, nil
+		}
+	}
+	return "", &InvalidSignatureError{image: image, reason: reason}
+}
+
+// simpleSigning cosign 签名的内容
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifyPayload 校验签名的内容指向 digest 并且由其中一个公钥签名, 返回未通过的原因
+func verifyPayload(payload []byte, payloadDigest, signature, digest string, keys []crypto.PublicKey) string {
+	sum := sha256.Sum256(payload)
+	if payloadDigest != fmt.Sprintf("sha256:%x", sum) {
+		return "payload digest mismatch"
+	}
+	var signing simpleSigning
+	if err := json.Unmarshal(payload, &signing); err != nil {
+		return fmt.Sprintf("invalid payload: %v", err)
+	}
+	if signing.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Sprintf("payload is signed for %s", signing.Critical.Image.DockerManifestDigest)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Sprintf("invalid signature encoding: %v", err)
+	}
+
+	for _, key := range keys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, sum[:], sig) {
+				return ""
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, payload, sig) {
+				return ""
+			}
+		}
+	}
+	return "signature does not match any public key"
+}
+
+// publicKeys 读取 namespace 配置的公钥, 未配置时返回空
+func (c *cosignVerifier) publicKeys(ctx context.Context, namespace string) ([]crypto.PublicKey, error) {
+	ns, err := c.client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get namespace %s err: %v", namespace, err)
+	}
+	name := ns.Annotations[PublicKeysAnnotation]
+	if name == "" {
+		return nil, nil
+	}
+
+	configMap, err := c.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get public keys configmap %s/%s err: %v", namespace, name, err)
+	}
+	names := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	var keys []crypto.PublicKey
+	for _, key := range names {
+		parsed, err := ParsePublicKeys([]byte(configMap.Data[key]))
+		if err != nil {
+			return nil, fmt.Errorf("public keys configmap %s/%s key %s err: %v", namespace, name, key, err)
+		}
+		keys = append(keys, parsed...)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("public keys configmap %s/%s has no public key", namespace, name)
+	}
+	return keys, nil
+}
+
+// ParsePublicKeys 解析 PEM 编码的 ECDSA 和 Ed25519 公钥, 例如 cosign generate-key-pair 生成的 cosign.pub
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *ecdsa.PublicKey, ed25519.PublicKey:
+			keys = append(keys, key)
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+	return keys, nil
+}
+
+// splitReference 将镜像拆分为 host, repository 以及 digest 或 tag, 未指定 host 的镜像来自 docker.io
+func splitReference(image string) (host, repository, reference string) {
+	event := eventservice.OfImageEvent(image)
+	reference = event.Digest
+	if reference == "" {
+		reference = event.Tag
+	}
+	name := eventservice.NormalizeImage(event.Image)
+	index := strings.Index(name, "/")
+	return name[:index], name[index+1:], reference
+}
@@ -0,0 +1,160 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/simple/client/registry"
+	"github.com/arugal/laborer/pkg/simple/client/registry/registrytest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// pushSignature push the cosign signature of the digest signed by the signer
+func pushSignature(r *registrytest.Registry, repository, digest, signedDigest string, sign func(payload []byte) []byte) {
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s/%s"},"image":{"docker-manifest-digest":"%s"},`+
+		`"type":"cosign container image signature"},"optional":null}`, r.Host(), repository, signedDigest))
+	r.PushManifest(repository, "sha256-"+digest[len("sha256:"):]+signatureTagSuffix, &registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config:        registry.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: r.PushBlob(repository, []byte("{}"))},
+		Layers: []registry.Descriptor{{
+			MediaType:   "application/vnd.dev.cosign.simplesigning.v1+json",
+			Digest:      r.PushBlob(repository, payload),
+			Size:        int64(len(payload)),
+			Annotations: map[string]string{signatureAnnotation: base64.StdEncoding.EncodeToString(sign(payload))},
+		}},
+	})
+}
+
+func encodePublicKey(t *testing.T, key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func Test_cosignVerifier_Verify(t *testing.T) {
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ed25519Public, ed25519Private, _ := ed25519.GenerateKey(rand.Reader)
+	signECDSA := func(key *ecdsa.PrivateKey) func(payload []byte) []byte {
+		return func(payload []byte) []byte {
+			sum := sha256.Sum256(payload)
+			sig, _ := ecdsa.SignASN1(rand.Reader, key, sum[:])
+			return sig
+		}
+	}
+
+	// 私有的镜像仓库, 凭证来自工作负载的 keychain
+	r := registrytest.NewRegistry()
+	r.Username, r.Password = "robot", "secret"
+	defer r.Close()
+	signed := r.PushImage("project/signed", "v1", time.Now())
+	pushSignature(r, "project/signed", signed, signed, signECDSA(ecdsaKey))
+	ed25519Signed := r.PushImage("project/ed25519", "v1", time.Now())
+	pushSignature(r, "project/ed25519", ed25519Signed, ed25519Signed, func(payload []byte) []byte {
+		return ed25519.Sign(ed25519Private, payload)
+	})
+	unsigned := r.PushImage("project/unsigned", "v1", time.Now())
+	// v2 在校验之后被重新 push 为未签名的镜像
+	r.PushImage("project/signed", "v2", time.Now().Add(time.Second))
+	otherSigned := r.PushImage("project/other", "v1", time.Now())
+	pushSignature(r, "project/other", otherSigned, otherSigned, signECDSA(otherKey))
+	// 签名被复制到另一个镜像上
+	copied := r.PushImage("project/copied", "v1", time.Now())
+	pushSignature(r, "project/copied", copied, signed, signECDSA(ecdsaKey))
+
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "release", Annotations: map[string]string{PublicKeysAnnotation: "cosign"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "missing", Annotations: map[string]string{PublicKeysAnnotation: "cosign"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cosign", Namespace: "release"}, Data: map[string]string{
+			"cosign.pub":  encodePublicKey(t, ecdsaKey.Public()),
+			"ed25519.pub": encodePublicKey(t, ed25519Public),
+		}},
+	)
+	v := NewVerifier(&SignatureOptions{Enabled: true, LookupTimeout: time.Second}, client,
+		func(ctx context.Context, host string, keychain repositoryservice.Keychain) (registry.Options, error) {
+			credential, _ := keychain.Lookup(host)
+			return registry.Options{Endpoint: r.URL, Username: credential.Username, Password: credential.Password}, nil
+		})
+	keychain := repositoryservice.Keychain{r.Host(): {Username: "robot", Password: "secret"}}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		image      string
+		keychain   repositoryservice.Keychain
+		wantDigest string
+		wantErr    error
+	}{
+		{name: "namespace without public keys", namespace: "dev", image: r.Host() + "/project/unsigned:v1"},
+		{name: "ecdsa", namespace: "release", image: r.Host() + "/project/signed:v1", wantDigest: signed},
+		{name: "ed25519", namespace: "release", image: r.Host() + "/project/ed25519:v1", wantDigest: ed25519Signed},
+		{name: "digest", namespace: "release", image: r.Host() + "/project/signed@" + signed, wantDigest: signed},
+		{name: "digest of the pushed tag", namespace: "release", image: r.Host() + "/project/signed:v2@" + signed, wantDigest: signed},
+		{name: "unsigned digest of a signed tag", namespace: "release", image: r.Host() + "/project/signed:v1@" + unsigned,
+			wantErr: &UnsignedError{}},
+		{name: "re-pushed tag", namespace: "release", image: r.Host() + "/project/signed:v2", wantErr: &UnsignedError{}},
+		{name: "unsigned", namespace: "release", image: r.Host() + "/project/unsigned:v1", wantErr: &UnsignedError{}},
+		{name: "signed by other key", namespace: "release", image: r.Host() + "/project/other:v1", wantErr: &InvalidSignatureError{}},
+		{name: "signature of other image", namespace: "release", image: r.Host() + "/project/copied:v1", wantErr: &InvalidSignatureError{}},
+		{name: "missing configmap", namespace: "missing", image: r.Host() + "/project/signed:v1", wantErr: fmt.Errorf("")},
+		{name: "without credentials", namespace: "release", image: r.Host() + "/project/signed:v1", keychain: repositoryservice.Keychain{},
+			wantErr: fmt.Errorf("")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.keychain == nil {
+				tt.keychain = keychain
+			}
+			digest, err := v.Verify(context.Background(), tt.namespace, tt.image, tt.keychain)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if digest != tt.wantDigest {
+				t.Errorf("Verify() digest = %v, want %v", digest, tt.wantDigest)
+			}
+			if err != nil && fmt.Sprintf("%T", err) != fmt.Sprintf("%T", tt.wantErr) {
+				t.Errorf("Verify() error = %T %v, want %T", err, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	if v := NewVerifier(NewSignatureOptions(), fake.NewSimpleClientset(), nil); v != nil {
+		t.Errorf("NewVerifier() = %v, want nil when disabled", v)
+	}
+}
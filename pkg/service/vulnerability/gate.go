@@ -0,0 +1,220 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vulnerability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"k8s.io/klog"
+)
+
+// severities 漏洞等级由低到高, 与 harbor 一致
+var severities = []string{"None", "Unknown", "Negligible", "Low", "Medium", "High", "Critical"}
+
+func severityLevel(severity string) (int, bool) {
+	for i, s := range severities {
+		if strings.EqualFold(s, severity) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// highestLevel 扫描结果中最高的漏洞等级, 没有 severity 时由各等级的数量得出
+func highestLevel(summary *eventservice.ScanSummary) int {
+	highest, _ := severityLevel(summary.Severity)
+	for severity, count := range summary.Summary {
+		if level, ok := severityLevel(severity); ok && count > 0 && level > highest {
+			highest = level
+		}
+	}
+	return highest
+}
+
+// gatedImageEventCollect 分发 push 事件之前检查镜像的漏洞扫描结果, 扫描失败或者漏洞等级达到阈值的更新被暂缓或拒绝,
+// 未扫描的更新总是暂缓到扫描结果到达, 例如 harbor 的 scan on push 在 push 事件之后才结束
+type gatedImageEventCollect struct {
+	eventservice.ImageEventCollect
+
+	options   *VulnerabilityGateOptions
+	threshold int
+	scanner   repositoryservice.VulnerabilityScanner
+	recorder  activity.Recorder
+
+	// held 暂缓的事件, 补全之后的镜像 -> 事件, 同一镜像只保留最新的事件
+	held map[string]eventservice.ImageEvent
+	mu   sync.Mutex
+}
+
+// NewGatedImageEventCollect 没有配置 Severity 时直接返回 collect, scanner 为 nil 时只使用事件中的扫描结果
+func NewGatedImageEventCollect(collect eventservice.ImageEventCollect, options *VulnerabilityGateOptions,
+	scanner repositoryservice.VulnerabilityScanner, recorder activity.Recorder) eventservice.ImageEventCollect {
+	if options.Severity == "" {
+		return collect
+	}
+	threshold, _ := severityLevel(options.Severity)
+	return &gatedImageEventCollect{
+		ImageEventCollect: collect,
+		options:           options,
+		threshold:         threshold,
+		scanner:           scanner,
+		recorder:          recorder,
+		held:              map[string]eventservice.ImageEvent{},
+	}
+}
+
+func (g *gatedImageEventCollect) Collect(event eventservice.ImageEvent) {
+	if !event.IsPush() {
+		if event.Scan != nil {
+			g.release(event)
+		}
+		g.ImageEventCollect.Collect(event)
+		return
+	}
+
+	image := eventservice.NormalizeImage(event.Image)
+	summary, ok := g.scanSummary(event)
+	if !ok {
+		// 镜像仓库不提供扫描结果, 无法检查
+		g.ImageEventCollect.Collect(event)
+		return
+	}
+	event.Scan = summary
+
+	g.mu.Lock()
+	// 新的 push 事件代替暂缓的事件
+	delete(g.held, image)
+	reason, pass := g.verdict(summary)
+	held := !pass && (summary == nil || g.options.Action == HoldAction)
+	if held {
+		g.held[image] = event
+	}
+	g.mu.Unlock()
+
+	if pass {
+		g.ImageEventCollect.Collect(event)
+		return
+	}
+	g.record(event, reason, held)
+}
+
+// release 同一 tag 的扫描结果通过时分发暂缓的事件, refuse 时扫描失败或者达到阈值的事件被拒绝
+func (g *gatedImageEventCollect) release(scan eventservice.ImageEvent) {
+	image := eventservice.NormalizeImage(scan.Image)
+
+	g.mu.Lock()
+	event, ok := g.held[image]
+	if !ok || event.Tag != scan.Tag {
+		g.mu.Unlock()
+		return
+	}
+	reason, pass := g.verdict(scan.Scan)
+	refused := !pass && g.options.Action == RefuseAction
+	if pass || refused {
+		delete(g.held, image)
+	}
+	g.mu.Unlock()
+
+	event.Scan = scan.Scan
+	if refused {
+		g.record(event, reason, false)
+		return
+	}
+	if !pass {
+		klog.V(4).Infof("image %s is still held: %s", event, reason)
+		return
+	}
+	klog.Infof("image %s is released by the vulnerability scan: %s", event, scan.Scan)
+	g.ImageEventCollect.Collect(event)
+}
+
+// verdict 未扫描, 扫描失败以及达到阈值的镜像不通过
+func (g *gatedImageEventCollect) verdict(summary *eventservice.ScanSummary) (reason string, pass bool) {
+	switch {
+	case summary == nil:
+		return "the image has not been scanned", false
+	case summary.Status != eventservice.ScanSuccess:
+		return "the vulnerability scan failed", false
+	case highestLevel(summary) >= g.threshold:
+		return fmt.Sprintf("%s, reached the %s threshold", summary, severities[g.threshold]), false
+	}
+	return "", true
+}
+
+// scanSummary 事件中的扫描结果, 没有时查询镜像仓库, 镜像仓库不支持时返回 false
+func (g *gatedImageEventCollect) scanSummary(event eventservice.ImageEvent) (*eventservice.ScanSummary, bool) {
+	if event.Scan != nil {
+		return event.Scan, true
+	}
+	if g.scanner == nil {
+		return nil, false
+	}
+
+	host, project, repo := splitImage(eventservice.NormalizeImage(event.Image))
+	reference := event.Tag
+	if event.Digest != "" {
+		reference = event.Digest
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.options.LookupTimeout)
+	defer cancel()
+	summary, err := g.scanner.ScanSummary(ctx, host, project, repo, reference)
+	if err != nil {
+		var notSupport *repositoryservice.NotSupportRegisterError
+		if errors.As(err, &notSupport) {
+			klog.V(4).Infof("image %s is not gated: %v", event, err)
+			return nil, false
+		}
+		klog.Warningf("query the vulnerability scan of %s err: %v", event, err)
+		return nil, true
+	}
+	return summary, true
+}
+
+// record 记录暂缓或拒绝的更新
+func (g *gatedImageEventCollect) record(event eventservice.ImageEvent, reason string, held bool) {
+	action := activity.Refused
+	if held {
+		action = activity.Held
+	}
+	klog.Infof("image %s is %s: %s", event, strings.ToLower(string(action)), reason)
+	activity.Record(g.recorder, activity.Activity{
+		EventID:   event.ID,
+		Action:    action,
+		Source:    event.Source,
+		Namespace: event.Namespace,
+		Image:     event.String(),
+		Message:   reason,
+	})
+}
+
+// splitImage 将补全之后的镜像拆分为 host, project 和 repo, 多级路径的中间部分作为 project
+func splitImage(image string) (host, project, repo string) {
+	parts := strings.Split(image, "/")
+	host, repo = parts[0], parts[len(parts)-1]
+	if len(parts) > 2 {
+		project = strings.Join(parts[1:len(parts)-1], "/")
+	}
+	return host, project, repo
+}
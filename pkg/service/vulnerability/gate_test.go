@@ -0,0 +1,227 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vulnerability
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arugal/laborer/pkg/service/activity"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+)
+
+type collected struct {
+	eventservice.ImageEventCollect
+
+	events []eventservice.ImageEvent
+}
+
+func (c *collected) Collect(event eventservice.ImageEvent) {
+	c.events = append(c.events, event)
+}
+
+type recorded []activity.Activity
+
+func (r *recorded) Record(a activity.Activity) {
+	*r = append(*r, a)
+}
+
+// fixedScanner 按 <host>/<project>/<repo>@<reference> 返回扫描结果, 其他 host 不支持
+type fixedScanner map[string]*eventservice.ScanSummary
+
+func (f fixedScanner) ScanSummary(_ context.Context, host, projectName, repoName, reference string) (*eventservice.ScanSummary, error) {
+	if host != "harbor.example.com" {
+		return nil, &repositoryservice.NotSupportRegisterError{}
+	}
+	key := fmt.Sprintf("%s/%s/%s@%s", host, projectName, repoName, reference)
+	if key == "harbor.example.com/library/broken@v1" {
+		return nil, fmt.Errorf("unexpected status 500")
+	}
+	return f[key], nil
+}
+
+func Test_gatedImageEventCollect_Collect(t *testing.T) {
+	clean := &eventservice.ScanSummary{Status: eventservice.ScanSuccess, Severity: "Low", Total: 1, Summary: map[string]int{"Low": 1}}
+	critical := &eventservice.ScanSummary{Status: eventservice.ScanSuccess, Severity: "Critical", Total: 1, Summary: map[string]int{"Critical": 1}}
+	scanner := fixedScanner{
+		"harbor.example.com/library/web@v1":       clean,
+		"harbor.example.com/library/web@v2":       critical,
+		"harbor.example.com/library/web@sha256:a": critical,
+	}
+	push := func(image, tag string) eventservice.ImageEvent {
+		return eventservice.ImageEvent{ID: image + ":" + tag, Image: image, Tag: tag}
+	}
+	scanned := func(event eventservice.ImageEvent, typ eventservice.EventType, summary *eventservice.ScanSummary) eventservice.ImageEvent {
+		event.Type = typ
+		event.Scan = summary
+		return event
+	}
+	digest := push("harbor.example.com/library/web", "v1")
+	digest.Digest = "sha256:a"
+
+	tests := []struct {
+		name        string
+		action      string
+		events      []eventservice.ImageEvent
+		want        []eventservice.ImageEvent
+		wantActions []activity.Action
+	}{
+		{
+			name:   "below the threshold",
+			action: HoldAction,
+			events: []eventservice.ImageEvent{push("harbor.example.com/library/web", "v1")},
+			want:   []eventservice.ImageEvent{scanned(push("harbor.example.com/library/web", "v1"), "", clean)},
+		},
+		{
+			name:        "refuse critical",
+			action:      RefuseAction,
+			events:      []eventservice.ImageEvent{push("harbor.example.com/library/web", "v2")},
+			wantActions: []activity.Action{activity.Refused},
+		},
+		{
+			name:        "digest is preferred",
+			action:      RefuseAction,
+			events:      []eventservice.ImageEvent{digest},
+			wantActions: []activity.Action{activity.Refused},
+		},
+		{
+			name:   "hold until the scan passes",
+			action: HoldAction,
+			events: []eventservice.ImageEvent{
+				push("harbor.example.com/library/web", "v3"),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, critical),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			want: []eventservice.ImageEvent{
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, critical),
+				scanned(push("harbor.example.com/library/web", "v3"), "", clean),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			wantActions: []activity.Action{activity.Held},
+		},
+		{
+			name:   "held event is replaced by a newer push",
+			action: HoldAction,
+			events: []eventservice.ImageEvent{
+				push("harbor.example.com/library/web", "v3"),
+				push("harbor.example.com/library/web", "v1"),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			want: []eventservice.ImageEvent{
+				scanned(push("harbor.example.com/library/web", "v1"), "", clean),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			wantActions: []activity.Action{activity.Held},
+		},
+		{
+			name:        "scan result in the event",
+			action:      RefuseAction,
+			events:      []eventservice.ImageEvent{scanned(push("harbor.example.com/library/web", "v1"), eventservice.PushEvent, &eventservice.ScanSummary{Status: eventservice.ScanFailed})},
+			wantActions: []activity.Action{activity.Refused},
+		},
+		{
+			name:        "query error is unscanned",
+			action:      RefuseAction,
+			events:      []eventservice.ImageEvent{push("harbor.example.com/library/broken", "v1")},
+			wantActions: []activity.Action{activity.Held},
+		},
+		{
+			name:   "refuse holds until the scan passes",
+			action: RefuseAction,
+			events: []eventservice.ImageEvent{
+				push("harbor.example.com/library/web", "v3"),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			want: []eventservice.ImageEvent{
+				scanned(push("harbor.example.com/library/web", "v3"), "", clean),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			wantActions: []activity.Action{activity.Held},
+		},
+		{
+			name:   "refuse once the scan reaches the threshold",
+			action: RefuseAction,
+			events: []eventservice.ImageEvent{
+				push("harbor.example.com/library/web", "v3"),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, critical),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			want: []eventservice.ImageEvent{
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, critical),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, clean),
+			},
+			wantActions: []activity.Action{activity.Held, activity.Refused},
+		},
+		{
+			name:   "refuse once the scan fails",
+			action: RefuseAction,
+			events: []eventservice.ImageEvent{
+				push("harbor.example.com/library/web", "v3"),
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, &eventservice.ScanSummary{Status: eventservice.ScanFailed}),
+			},
+			want: []eventservice.ImageEvent{
+				scanned(push("harbor.example.com/library/web", "v3"), eventservice.ScanEvent, &eventservice.ScanSummary{Status: eventservice.ScanFailed}),
+			},
+			wantActions: []activity.Action{activity.Held, activity.Refused},
+		},
+		{
+			name:   "unsupported repository is not gated",
+			action: RefuseAction,
+			events: []eventservice.ImageEvent{push("nginx", "1.19")},
+			want:   []eventservice.ImageEvent{push("nginx", "1.19")},
+		},
+		{
+			name:   "delete event is not gated",
+			action: RefuseAction,
+			events: []eventservice.ImageEvent{scanned(push("harbor.example.com/library/web", "v2"), eventservice.DeleteEvent, nil)},
+			want:   []eventservice.ImageEvent{scanned(push("harbor.example.com/library/web", "v2"), eventservice.DeleteEvent, nil)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &collected{}
+			recorder := &recorded{}
+			collect := NewGatedImageEventCollect(inner, &VulnerabilityGateOptions{Severity: "high", Action: tt.action, LookupTimeout: time.Second},
+				scanner, recorder)
+			for _, event := range tt.events {
+				collect.Collect(event)
+			}
+
+			if !reflect.DeepEqual(inner.events, tt.want) {
+				t.Errorf("Collect() collected = %+v, want %+v", inner.events, tt.want)
+			}
+			var actions []activity.Action
+			for _, a := range *recorder {
+				actions = append(actions, a.Action)
+			}
+			if !reflect.DeepEqual(actions, tt.wantActions) {
+				t.Errorf("Collect() recorded = %v, want %v", actions, tt.wantActions)
+			}
+		})
+	}
+}
+
+func TestNewGatedImageEventCollect(t *testing.T) {
+	inner := &collected{}
+	if got := NewGatedImageEventCollect(inner, NewVulnerabilityGateOptions(), nil, nil); got != inner {
+		t.Errorf("NewGatedImageEventCollect() = %v, want the collect itself when the gate is disabled", got)
+	}
+}
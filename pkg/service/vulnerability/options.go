@@ -0,0 +1,73 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package vulnerability
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// HoldAction the gated update is applied once a later scan of the same tag passes
+	HoldAction = "hold"
+	// RefuseAction the gated update is dropped, the unscanned update is still held until its scan arrives
+	RefuseAction = "refuse"
+)
+
+type VulnerabilityGateOptions struct {
+	// Severity the updates to the images with vulnerabilities of the severity or higher are gated,
+	// optional: Unknown; Negligible; Low; Medium; High; Critical. Empty disables the gate
+	Severity string `json:"severity,omitempty" yaml:"severity,omitempty"`
+	// Action what happens to the gated update, optional: hold; refuse
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+	// LookupTimeout timeout of the scan overview query to the image repository
+	LookupTimeout time.Duration `json:"lookupTimeout,omitempty" yaml:"lookupTimeout,omitempty"`
+}
+
+func (v *VulnerabilityGateOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&v.Severity, "vulnerability-severity", v.Severity, "gate the image updates whose vulnerability scan reports the severity or higher, "+
+		"optional: Unknown, Negligible, Low, Medium, High, Critical. The unscanned images are gated as well, empty disables the gate")
+	fs.StringVar(&v.Action, "vulnerability-action", v.Action, "what happens to the gated image update, optional: "+
+		"hold (applied once a later scan of the tag passes), refuse (dropped once the scan fails or reaches the severity, "+
+		"the unscanned images are held until the scan arrives)")
+	fs.DurationVar(&v.LookupTimeout, "vulnerability-lookup-timeout", v.LookupTimeout, "timeout of the scan overview query to the image repository")
+}
+
+func (v *VulnerabilityGateOptions) Validate() (errs []error) {
+	if v.Severity != "" {
+		// None 不能作为阈值
+		if level, ok := severityLevel(v.Severity); !ok || level == 0 {
+			errs = append(errs, fmt.Errorf("vulnerability severity only support Unknown, Negligible, Low, Medium, High, Critical"))
+		}
+	}
+	if v.Action != HoldAction && v.Action != RefuseAction {
+		errs = append(errs, fmt.Errorf("vulnerability action only support %s, %s", HoldAction, RefuseAction))
+	}
+	if v.LookupTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("vulnerability lookup timeout must be positive"))
+	}
+	return errs
+}
+
+func NewVulnerabilityGateOptions() *VulnerabilityGateOptions {
+	return &VulnerabilityGateOptions{
+		Action:        HoldAction,
+		LookupTimeout: 5 * time.Second,
+	}
+}
@@ -0,0 +1,476 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+
+	// maxBodySize limit the size of the manifests and the config blobs
+	maxBodySize = 16 << 20
+
+	pageSize = 100
+)
+
+var (
+	manifestAccept = strings.Join([]string{MediaTypeOCIIndex, MediaTypeDockerManifestList, MediaTypeOCIManifest, MediaTypeDockerManifest}, ", ")
+)
+
+// StatusError the registry answered an unexpected status
+type StatusError struct {
+	StatusCode int
+	message    string
+}
+
+func (e StatusError) Error() string {
+	return e.message
+}
+
+// Options of the registry client
+type Options struct {
+	// Endpoint scheme and host of the registry, eg: https://registry.example.com
+	Endpoint string
+	Username string
+	Password string
+	// Token a static bearer token, used instead of the token service when not empty
+	Token string
+	// TLSConfig of the https endpoint, nil means the default
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// Descriptor describe a manifest or a blob
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *Platform         `json:"platform,omitempty"`
+}
+
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// Manifest an image manifest or an image index
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers,omitempty"`
+	Manifests     []Descriptor      `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+
+	// Digest of the manifest, from the Docker-Content-Digest header or the sha256 of the content
+	Digest string `json:"-"`
+}
+
+// IsIndex return true if the manifest is a manifest list or an image index
+func (m *Manifest) IsIndex() bool {
+	return m.MediaType == MediaTypeDockerManifestList || m.MediaType == MediaTypeOCIIndex || len(m.Manifests) > 0
+}
+
+// ImageConfig the part of the image config used by laborer
+type ImageConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+}
+
+// Client a client of the OCI Distribution API
+type Client struct {
+	endpoint   string
+	username   string
+	password   string
+	token      string
+	httpClient *http.Client
+
+	// tokens bearer tokens of the token service by scope
+	tokens map[string]bearerToken
+	mu     sync.Mutex
+}
+
+type bearerToken struct {
+	token   string
+	expires time.Time
+}
+
+func NewClient(options Options) (*Client, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("registry endpoint %s must start with http:// or https://", options.Endpoint)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.TLSConfig != nil {
+		transport.TLSClientConfig = options.TLSConfig
+	}
+
+	return &Client{
+		endpoint: strings.TrimSuffix(options.Endpoint, "/"),
+		username: options.Username,
+		password: options.Password,
+		token:    options.Token,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   options.Timeout,
+		},
+		tokens: map[string]bearerToken{},
+	}, nil
+}
+
+// Tags list all tags of the repository, following the pagination of the registry
+func (c *Client) Tags(ctx context.Context, repository string) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("%s/v2/%s/tags/list?n=%d", c.endpoint, repository, pageSize)
+	for next != "" {
+		resp, err := c.get(ctx, next, "application/json")
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&page)
+		link := resp.Header.Get("Link")
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+
+		if next, err = c.nextPage(next, link); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// Manifest get the manifest or image index of the reference, the reference is a tag or a digest
+func (c *Client) Manifest(ctx context.Context, repository, reference string) (*Manifest, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("%s/v2/%s/manifests/%s", c.endpoint, repository, reference), manifestAccept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err = json.Unmarshal(body, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	}
+	manifest.Digest = resp.Header.Get("Docker-Content-Digest")
+	if manifest.Digest == "" {
+		manifest.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	return &manifest, nil
+}
+
+// Blob get the content of the blob
+func (c *Client) Blob(ctx context.Context, repository, digest string) ([]byte, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("%s/v2/%s/blobs/%s", c.endpoint, repository, digest), "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+}
+
+// ImageConfig get the config of the image, for an image index the linux/amd64 image or the first image is used
+func (c *Client) ImageConfig(ctx context.Context, repository, reference string) (*ImageConfig, error) {
+	manifest, err := c.Manifest(ctx, repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	return c.ConfigOf(ctx, repository, manifest)
+}
+
+// ConfigOf get the config of the manifest which has been read, for an image index the linux/amd64 image or the first image is used
+func (c *Client) ConfigOf(ctx context.Context, repository string, manifest *Manifest) (*ImageConfig, error) {
+	var err error
+	if manifest.IsIndex() {
+		if len(manifest.Manifests) == 0 {
+			return nil, fmt.Errorf("image index %s@%s is empty", repository, manifest.Digest)
+		}
+		image := manifest.Manifests[0]
+		for _, m := range manifest.Manifests {
+			if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				image = m
+				break
+			}
+		}
+		if manifest, err = c.Manifest(ctx, repository, image.Digest); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := c.Blob(ctx, repository, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var config ImageConfig
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// get send the request, authorizing with the challenge of the registry when needed
+func (c *Client) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	resp, err := c.do(ctx, rawURL, accept, c.cachedAuthorization(rawURL))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		_ = resp.Body.Close()
+
+		authorization, err := c.authorize(ctx, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(ctx, rawURL, accept, authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			message:    fmt.Sprintf("GET %s: unexpected status %d: %s", rawURL, resp.StatusCode, strings.TrimSpace(string(body))),
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) do(ctx context.Context, rawURL, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.httpClient.Do(req)
+}
+
+// cachedAuthorization return the authorization used before the registry asks for it
+func (c *Client) cachedAuthorization(rawURL string) string {
+	if c.token != "" {
+		return "Bearer " + c.token
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for scope, t := range c.tokens {
+		if strings.Contains(rawURL, "/v2/"+scopeRepository(scope)+"/") && time.Now().Before(t.expires) {
+			return "Bearer " + t.token
+		}
+	}
+	return ""
+}
+
+// authorize answer the challenge of the registry with basic auth or a bearer token of the token service
+func (c *Client) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.username == "" {
+			return "", &StatusError{StatusCode: http.StatusUnauthorized, message: "registry requires basic auth but no credentials configured"}
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(c.username, c.password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		if c.token != "" {
+			return "", &StatusError{StatusCode: http.StatusUnauthorized, message: "registry rejected the bearer token"}
+		}
+		token, err := c.fetchToken(ctx, params)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", &StatusError{StatusCode: http.StatusUnauthorized, message: fmt.Sprintf("unsupported challenge %q", challenge)}
+	}
+}
+
+// fetchToken get a bearer token from the token service of the registry
+func (c *Client) fetchToken(ctx context.Context, params map[string]string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("bearer challenge without realm")
+	}
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope := params["scope"]; scope != "" {
+		query.Set("scope", scope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{StatusCode: resp.StatusCode, message: fmt.Sprintf("token service %s: unexpected status %d", realm, resp.StatusCode)}
+	}
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&result); err != nil {
+		return "", err
+	}
+	token := result.Token
+	if token == "" {
+		token = result.AccessToken
+	}
+	if token == "" {
+		return "", fmt.Errorf("token service %s returned an empty token", realm)
+	}
+
+	if scope := params["scope"]; scope != "" {
+		expiresIn := result.ExpiresIn
+		if expiresIn <= 0 {
+			expiresIn = 60
+		}
+		c.mu.Lock()
+		c.tokens[scope] = bearerToken{
+			token: token,
+			// refresh a little earlier than the expiration
+			expires: time.Now().Add(time.Duration(expiresIn)*time.Second - 5*time.Second),
+		}
+		c.mu.Unlock()
+	}
+	return token, nil
+}
+
+// nextPage resolve the next page of the Link header, eg: </v2/repo/tags/list?n=100&last=b>; rel="next"
+func (c *Client) nextPage(current, link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return "", nil
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := base.Parse(link[start+1 : end])
+	if err != nil {
+		return "", err
+	}
+	return next.String(), nil
+}
+
+// parseChallenge parse the WWW-Authenticate header, eg: Bearer realm="https://auth",service="registry",scope="repository:a/b:pull"
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	index := strings.Index(challenge, " ")
+	if index < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:index], challenge[index+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+// scopeRepository return the repository of the scope, eg: repository:a/b:pull -> a/b
+func scopeRepository(scope string) string {
+	parts := strings.Split(scope, ":")
+	if len(parts) < 3 {
+		return scope
+	}
+	return strings.Join(parts[1:len(parts)-1], ":")
+}
@@ -0,0 +1,228 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package registrytest provides an in-process OCI Distribution registry for tests.
+package registrytest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arugal/laborer/pkg/simple/client/registry"
+)
+
+const token = "registrytest-token"
+
+// Registry an in-memory registry served by httptest, it only implements the read api
+type Registry struct {
+	*httptest.Server
+
+	// Username and Password enable the bearer token auth when not empty
+	Username string
+	Password string
+
+	mu        sync.Mutex
+	tags      map[string]map[string]string
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	// manifestRequests the number of the manifest requests
+	manifestRequests int
+}
+
+// NewRegistry start a registry, Close it when the test is done
+func NewRegistry() *Registry {
+	r := &Registry{
+		tags:      map[string]map[string]string{},
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+	r.Server = httptest.NewServer(r)
+	return r
+}
+
+// Host the host of the registry, eg: 127.0.0.1:5000
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// ManifestRequests the number of the manifest requests served
+func (r *Registry) ManifestRequests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.manifestRequests
+}
+
+// PushImage push an image manifest whose config has the created time, return the digest of the manifest
+func (r *Registry) PushImage(repository, tag string, created time.Time) string {
+	config, _ := json.Marshal(registry.ImageConfig{Created: created, Architecture: "amd64", OS: "linux"})
+	return r.PushManifest(repository, tag, &registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeOCIManifest,
+		Config: registry.Descriptor{
+			MediaType: "application/vnd.oci.image.config.v1+json",
+			Digest:    r.PushBlob(repository, config),
+			Size:      int64(len(config)),
+		},
+	})
+}
+
+// PushManifest push a manifest, an empty tag push it by digest only, return the digest of the manifest
+func (r *Registry) PushManifest(repository, tag string, manifest *registry.Manifest) string {
+	data, _ := json.Marshal(manifest)
+	digest := digestOf(data)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manifests[repository+"@"+digest] = data
+	if _, ok := r.tags[repository]; !ok {
+		r.tags[repository] = map[string]string{}
+	}
+	if tag != "" {
+		r.tags[repository][tag] = digest
+	}
+	return digest
+}
+
+// PushBlob push a blob, return the digest of the blob
+func (r *Registry) PushBlob(repository string, data []byte) string {
+	digest := digestOf(data)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blobs[repository+"@"+digest] = data
+	return digest
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.token(w, req)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		http.NotFound(w, req)
+		return
+	}
+	if r.Username != "" && req.Header.Get("Authorization") != "Bearer "+token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registrytest",scope="repository:%s:pull"`,
+			r.URL, repositoryOf(req.URL.Path)))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.HasSuffix(path, "/tags/list"):
+		r.tagsList(w, req, strings.TrimSuffix(path, "/tags/list"))
+	case strings.Contains(path, "/manifests/"):
+		index := strings.LastIndex(path, "/manifests/")
+		r.manifest(w, path[:index], path[index+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/"):
+		index := strings.LastIndex(path, "/blobs/")
+		r.mu.Lock()
+		data, ok := r.blobs[path[:index]+"@"+path[index+len("/blobs/"):]]
+		r.mu.Unlock()
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// tagsList answer the sorted tags, paginated with n and last like the distribution registry
+func (r *Registry) tagsList(w http.ResponseWriter, req *http.Request, repository string) {
+	r.mu.Lock()
+	tagMap, ok := r.tags[repository]
+	tags := make([]string, 0, len(tagMap))
+	for tag := range tagMap {
+		tags = append(tags, tag)
+	}
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	sort.Strings(tags)
+
+	last := req.URL.Query().Get("last")
+	start := sort.SearchStrings(tags, last)
+	if last != "" && start < len(tags) && tags[start] == last {
+		start++
+	}
+	tags = tags[start:]
+	if n, err := strconv.Atoi(req.URL.Query().Get("n")); err == nil && n > 0 && n < len(tags) {
+		tags = tags[:n]
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%s>; rel="next"`, repository, n, tags[n-1]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": tags})
+}
+
+func (r *Registry) manifest(w http.ResponseWriter, repository, reference string) {
+	r.mu.Lock()
+	r.manifestRequests++
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		digest = r.tags[repository][reference]
+	}
+	data, ok := r.manifests[repository+"@"+digest]
+	r.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var manifest registry.Manifest
+	_ = json.Unmarshal(data, &manifest)
+	w.Header().Set("Content-Type", manifest.MediaType)
+	w.Header().Set("Docker-Content-Digest", digest)
+	_, _ = w.Write(data)
+}
+
+func (r *Registry) token(w http.ResponseWriter, req *http.Request) {
+	username, password, ok := req.BasicAuth()
+	if !ok || username != r.Username || password != r.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "expires_in": 300})
+}
+
+func repositoryOf(path string) string {
+	path = strings.TrimPrefix(path, "/v2/")
+	for _, sep := range []string{"/tags/", "/manifests/", "/blobs/"} {
+		if index := strings.LastIndex(path, sep); index >= 0 {
+			return path[:index]
+		}
+	}
+	return path
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
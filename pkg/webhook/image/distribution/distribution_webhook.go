@@ -0,0 +1,115 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/simple/client/registry"
+	"k8s.io/klog"
+)
+
+const (
+	source = "distribution"
+
+	// helm chart 的 content 和 config 类型, 部分 registry 在 target 中报告 chart 的类型而不是 OCI manifest
+	helmChartMediaType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	helmConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+)
+
+// mediaTypeArtifacts 带有 tag 的 target 类型对应的制品类型, 其他类型 (如 layer) 的 push 事件只是上传 blob
+var mediaTypeArtifacts = map[string]string{
+	registry.MediaTypeDockerManifest:     eventservice.ImageArtifact,
+	registry.MediaTypeDockerManifestList: eventservice.ImageArtifact,
+	registry.MediaTypeOCIManifest:        eventservice.ImageArtifact,
+	registry.MediaTypeOCIIndex:           eventservice.ImageArtifact,
+	helmChartMediaType:                   eventservice.ChartArtifact,
+	helmConfigMediaType:                  eventservice.ChartArtifact,
+}
+
+// imageEventWebHook docker distribution (registry:2) notification
+type imageEventWebHook struct {
+	collect eventservice.ImageEventCollect
+}
+
+func NewImageEventWebHook(collect eventservice.ImageEventCollect) http.Handler {
+	return &imageEventWebHook{
+		collect: collect,
+	}
+}
+
+func (i *imageEventWebHook) ServeHTTP(_ http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		klog.Warningf("Read distribution notification body error: %v", err)
+		return
+	}
+	if len(body) == 0 {
+		klog.Warningf("Distribution notification body is empty")
+		return
+	}
+
+	if klog.V(4) {
+		klog.Infof("Distribution notification data: %s", string(body))
+	}
+
+	events, err := ParseEvents(body, "")
+	if err != nil {
+		klog.Warningf("Unmarshal distribution notification body [%s] error: %v", string(body), err)
+		return
+	}
+	for _, event := range events {
+		event.Source = source
+		i.collect.Collect(event)
+	}
+}
+
+// ParseEvents 解析 notification 中带 tag 的 manifest push 事件, 忽略 pull 事件, blob 的 push 事件以及只有 digest 的 push 事件,
+// image 为 request.host/target.repository, host 不为空时代替 request.host, 用于镜像仓库在集群内外地址不同的情况
+func ParseEvents(body []byte, host string) ([]eventservice.ImageEvent, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+
+	var events []eventservice.ImageEvent
+	for _, event := range envelope.Events {
+		if event.Action != Push || event.Target.Tag == "" {
+			continue
+		}
+		artifactType, ok := mediaTypeArtifacts[event.Target.MediaType]
+		if event.Target.MediaType != "" && !ok {
+			klog.V(4).Infof("Unsupported media type %s of %s, ignored", event.Target.MediaType, event.Target.Repository)
+			continue
+		}
+		registryHost := host
+		if registryHost == "" {
+			registryHost = event.Request.Host
+		}
+		image := event.Target.Repository
+		if registryHost != "" {
+			image = fmt.Sprintf("%s/%s", registryHost, event.Target.Repository)
+		}
+		events = append(events, eventservice.ImageEvent{Image: image, Tag: event.Target.Tag, Digest: event.Target.Digest,
+			ArtifactType: artifactType})
+	}
+	return events, nil
+}
@@ -0,0 +1,88 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package distribution
+
+import (
+	"reflect"
+	"testing"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+func TestParseEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		host    string
+		want    []eventservice.ImageEvent
+		wantErr bool
+	}{
+		{
+			name: "push manifest",
+			body: `{"events": [{
+				"action": "push",
+				"target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "digest": "sha256:fea8", "repository": "project/web", "tag": "v1.0.0"},
+				"request": {"host": "registry.example.com:5000", "method": "PUT"}}]}`,
+			want: []eventservice.ImageEvent{{Image: "registry.example.com:5000/project/web", Tag: "v1.0.0", Digest: "sha256:fea8", ArtifactType: eventservice.ImageArtifact}},
+		},
+		{
+			name: "ignore blob, pull and digest only",
+			body: `{"events": [
+				{"action": "push", "target": {"mediaType": "application/octet-stream", "digest": "sha256:a1", "repository": "web"}, "request": {"host": "registry.example.com"}},
+				{"action": "push", "target": {"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip", "digest": "sha256:a2", "repository": "web", "tag": "v1"}, "request": {"host": "registry.example.com"}},
+				{"action": "pull", "target": {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:a3", "repository": "web", "tag": "v1"}, "request": {"host": "registry.example.com"}},
+				{"action": "push", "target": {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:a4", "repository": "web"}, "request": {"host": "registry.example.com"}},
+				{"action": "push", "target": {"mediaType": "application/vnd.oci.image.index.v1+json", "digest": "sha256:a5", "repository": "web", "tag": "v2"}, "request": {"host": "registry.example.com"}}]}`,
+			want: []eventservice.ImageEvent{{Image: "registry.example.com/web", Tag: "v2", Digest: "sha256:a5", ArtifactType: eventservice.ImageArtifact}},
+		},
+		{
+			name: "host from configuration",
+			body: `{"events": [{
+				"action": "push",
+				"target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "digest": "sha256:fea8", "repository": "group/web", "tag": "v1"},
+				"request": {"host": "gitlab-registry.gitlab.svc:5000"}}]}`,
+			host: "registry.gitlab.example.com",
+			want: []eventservice.ImageEvent{{Image: "registry.gitlab.example.com/group/web", Tag: "v1", Digest: "sha256:fea8", ArtifactType: eventservice.ImageArtifact}},
+		},
+		{
+			name: "helm chart",
+			body: `{"events": [{
+				"action": "push",
+				"target": {"mediaType": "application/vnd.cncf.helm.config.v1+json", "digest": "sha256:c4a2", "repository": "charts/web", "tag": "0.1.0"},
+				"request": {"host": "registry.example.com"}}]}`,
+			want: []eventservice.ImageEvent{{Image: "registry.example.com/charts/web", Tag: "0.1.0", Digest: "sha256:c4a2",
+				ArtifactType: eventservice.ChartArtifact}},
+		},
+		{
+			name:    "invalid json",
+			body:    `{"events": [`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEvents([]byte(tt.body), tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEvents() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEvents() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package distribution
+
+const (
+	Push = "push"
+)
+
+//{
+//	"events": [
+//		{
+//			"id": "320678d8-ca14-430f-8bb6-4ca139cd83f7",
+//			"timestamp": "2021-03-01T08:00:00.000000000Z",
+//			"action": "push",
+//			"target": {
+//				"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+//				"size": 708,
+//				"digest": "sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+//				"length": 708,
+//				"repository": "project/web",
+//				"url": "https://registry.example.com/v2/project/web/manifests/sha256:fea8895f450959fa676bcc1df0611ea93823a735a01205fd8622846041d0c7cf",
+//				"tag": "v1.0.0"
+//			},
+//			"request": {
+//				"id": "6df24a34-0959-4923-81ca-14f09767db19",
+//				"addr": "192.168.64.11:42961",
+//				"host": "registry.example.com",
+//				"method": "PUT",
+//				"useragent": "docker/20.10.2"
+//			}
+//		}
+//	]
+//}
+
+type Envelope struct {
+	Events []Event `json:"events"`
+}
+
+type Event struct {
+	ID      string  `json:"id"`
+	Action  string  `json:"action"`
+	Target  Target  `json:"target"`
+	Request Request `json:"request"`
+}
+
+type Target struct {
+	MediaType  string `json:"mediaType"`
+	Digest     string `json:"digest"`
+	Repository string `json:"repository"`
+	URL        string `json:"url,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+type Request struct {
+	ID     string `json:"id,omitempty"`
+	Addr   string `json:"addr,omitempty"`
+	Host   string `json:"host"`
+	Method string `json:"method,omitempty"`
+}
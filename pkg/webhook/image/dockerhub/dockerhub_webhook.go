@@ -0,0 +1,84 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package dockerhub
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"k8s.io/klog"
+)
+
+const (
+	source = "dockerhub"
+)
+
+// imageEventWebHook docker hub 的 push webhook
+type imageEventWebHook struct {
+	collect eventservice.ImageEventCollect
+}
+
+func NewImageEventWebHook(collect eventservice.ImageEventCollect) http.Handler {
+	return &imageEventWebHook{
+		collect: collect,
+	}
+}
+
+func (i *imageEventWebHook) ServeHTTP(_ http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		klog.Warningf("Read docker hub webhook body error: %v", err)
+		return
+	}
+	if len(body) == 0 {
+		klog.Warningf("Docker hub webhook body is empty")
+		return
+	}
+
+	if klog.V(4) {
+		klog.Infof("Docker hub event data: %s", string(body))
+	}
+
+	event, ok, err := ParseEvent(body)
+	if err != nil {
+		klog.Warningf("Unmarshal docker hub webhook body [%s] error: %v", string(body), err)
+		return
+	}
+	if !ok {
+		klog.Warningf("Docker hub webhook without repository or tag, ignored")
+		return
+	}
+	event.Source = source
+	i.collect.Collect(event)
+}
+
+// ParseEvent 解析 push 事件, image 为 docker.io/<repo_name>
+func ParseEvent(body []byte) (eventservice.ImageEvent, bool, error) {
+	var push PushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		return eventservice.ImageEvent{}, false, err
+	}
+	if push.Repository.RepoName == "" || push.PushData.Tag == "" {
+		return eventservice.ImageEvent{}, false, nil
+	}
+	return eventservice.ImageEvent{
+		Image: eventservice.NormalizeImage(push.Repository.RepoName),
+		Tag:   push.PushData.Tag,
+	}, true, nil
+}
@@ -0,0 +1,78 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package dockerhub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+type collected struct {
+	eventservice.ImageEventCollect
+
+	events []eventservice.ImageEvent
+}
+
+func (c *collected) Collect(event eventservice.ImageEvent) {
+	c.events = append(c.events, event)
+}
+
+func Test_imageEventWebHook_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []eventservice.ImageEvent
+	}{
+		{
+			name: "organization repository",
+			body: `{"push_data": {"pushed_at": 1417566161, "pusher": "trustedbuilder", "tag": "v1.0.0"},
+				"repository": {"name": "app", "namespace": "org", "repo_name": "org/app", "status": "Active"}}`,
+			want: []eventservice.ImageEvent{{Image: "docker.io/org/app", Tag: "v1.0.0", Source: source}},
+		},
+		{
+			name: "official repository",
+			body: `{"push_data": {"tag": "1.19"}, "repository": {"name": "nginx", "namespace": "library", "repo_name": "nginx"}}`,
+			want: []eventservice.ImageEvent{{Image: "docker.io/library/nginx", Tag: "1.19", Source: source}},
+		},
+		{
+			name: "without tag",
+			body: `{"push_data": {"pusher": "trustedbuilder"}, "repository": {"repo_name": "org/app"}}`,
+		},
+		{
+			name: "invalid json",
+			body: `{"push_data": `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collect := &collected{}
+			handler := NewImageEventWebHook(collect)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook-v1alpha1-dockerhub-image", strings.NewReader(tt.body))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !reflect.DeepEqual(collect.events, tt.want) {
+				t.Errorf("ServeHTTP() collected = %v, want %v", collect.events, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package dockerhub
+
+//{
+//	"callback_url": "https://registry.hub.docker.com/u/org/app/hook/2141b5bi5i5b02bec211i4eeih0242eg11000a/",
+//	"push_data": {
+//		"pushed_at": 1417566161,
+//		"pusher": "trustedbuilder",
+//		"tag": "v1.0.0"
+//	},
+//	"repository": {
+//		"date_created": 1417494799,
+//		"is_official": false,
+//		"is_private": true,
+//		"name": "app",
+//		"namespace": "org",
+//		"owner": "org",
+//		"repo_name": "org/app",
+//		"repo_url": "https://registry.hub.docker.com/u/org/app/",
+//		"status": "Active"
+//	}
+//}
+
+type PushEvent struct {
+	CallbackURL string     `json:"callback_url"`
+	PushData    PushData   `json:"push_data"`
+	Repository  Repository `json:"repository"`
+}
+
+type PushData struct {
+	PushedAt int64  `json:"pushed_at"`
+	Pusher   string `json:"pusher"`
+	Tag      string `json:"tag"`
+}
+
+type Repository struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	RepoName  string `json:"repo_name"`
+	RepoURL   string `json:"repo_url"`
+	IsPrivate bool   `json:"is_private"`
+	Status    string `json:"status"`
+}
@@ -0,0 +1,283 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package generic
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"k8s.io/client-go/util/jsonpath"
+	"k8s.io/klog"
+)
+
+const (
+	// PathPrefix the endpoint is mounted on PathPrefix + name
+	PathPrefix = "/webhook-v1alpha1-generic-"
+
+	defaultTokenHeader     = "Authorization"
+	defaultSignatureHeader = "X-Hub-Signature-256"
+
+	// noValue go template 渲染不存在的 key 的结果
+	noValue = "<no value>"
+)
+
+var (
+	templateFuncs = template.FuncMap{
+		"lower":      strings.ToLower,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	}
+)
+
+// Path the path of the endpoint
+func Path(name string) string {
+	return PathPrefix + name
+}
+
+// expression 使用请求体渲染出字符串
+type expression interface {
+	render(data interface{}) (string, error)
+}
+
+type jsonPathExpression struct {
+	jsonPath *jsonpath.JSONPath
+}
+
+func (j *jsonPathExpression) render(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := j.jsonPath.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+type templateExpression struct {
+	template *template.Template
+}
+
+func (t *templateExpression) render(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	if value := strings.TrimSpace(buf.String()); value != noValue {
+		return value, nil
+	}
+	return "", nil
+}
+
+// compile 空的表达式返回 nil
+func compile(name, syntax, text string) (expression, error) {
+	if text == "" {
+		return nil, nil
+	}
+	switch syntax {
+	case "", JSONPathSyntax:
+		// 不存在的 key 渲染为空, 由调用方决定是否忽略
+		jsonPath := jsonpath.New(name).AllowMissingKeys(true)
+		if err := jsonPath.Parse(text); err != nil {
+			return nil, err
+		}
+		return &jsonPathExpression{jsonPath: jsonPath}, nil
+	case TemplateSyntax:
+		tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		return &templateExpression{template: tmpl}, nil
+	default:
+		return nil, fmt.Errorf("syntax must be one of %s, %s", JSONPathSyntax, TemplateSyntax)
+	}
+}
+
+// imageEventWebHook 按配置的表达式从任意 json 请求体中取出镜像
+type imageEventWebHook struct {
+	options EndpointOptions
+	collect eventservice.ImageEventCollect
+
+	match  expression
+	image  expression
+	tag    expression
+	digest expression
+}
+
+func NewImageEventWebHook(options EndpointOptions, collect eventservice.ImageEventCollect) (http.Handler, error) {
+	i := &imageEventWebHook{
+		options: options,
+		collect: collect,
+	}
+	if options.Image == "" {
+		return nil, fmt.Errorf("generic webhook endpoint %s requires the image expression", options.Name)
+	}
+	var match string
+	if options.Match != nil {
+		if match = options.Match.Expression; match == "" {
+			return nil, fmt.Errorf("generic webhook endpoint %s requires the match expression", options.Name)
+		}
+	}
+
+	expressions := []struct {
+		field  string
+		text   string
+		target *expression
+	}{
+		{field: "match", text: match, target: &i.match},
+		{field: "image", text: options.Image, target: &i.image},
+		{field: "tag", text: options.Tag, target: &i.tag},
+		{field: "digest", text: options.Digest, target: &i.digest},
+	}
+	for _, e := range expressions {
+		exp, err := compile(options.Name+"-"+e.field, options.Syntax, e.text)
+		if err != nil {
+			return nil, fmt.Errorf("generic webhook endpoint %s %s expression err: %v", options.Name, e.field, err)
+		}
+		*e.target = exp
+	}
+	return i, nil
+}
+
+func (i *imageEventWebHook) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		klog.Warningf("Read %s webhook body error: %v", i.options.Name, err)
+		return
+	}
+	if !i.authorized(req, body) {
+		klog.Warningf("Webhook %s from %s is not authorized, ignored", i.options.Name, req.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if len(body) == 0 {
+		klog.Warningf("Webhook %s body is empty", i.options.Name)
+		return
+	}
+
+	if klog.V(4) {
+		klog.Infof("Webhook %s data: %s", i.options.Name, string(body))
+	}
+
+	event, ok, err := i.parseEvent(body)
+	if err != nil {
+		klog.Warningf("Parse %s webhook body [%s] error: %v", i.options.Name, string(body), err)
+		return
+	}
+	if !ok {
+		return
+	}
+	event.Source = i.options.Name
+	i.collect.Collect(event)
+}
+
+// parseEvent 不满足匹配条件或者没有镜像时忽略请求
+func (i *imageEventWebHook) parseEvent(body []byte) (eventservice.ImageEvent, bool, error) {
+	// 保留数字的原样, 避免较大的数字被渲染为科学计数法
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return eventservice.ImageEvent{}, false, err
+	}
+
+	if i.match != nil {
+		value, err := i.match.render(data)
+		if err != nil {
+			return eventservice.ImageEvent{}, false, err
+		}
+		if !i.matched(value) {
+			klog.V(4).Infof("Webhook %s does not match: %q, ignored", i.options.Name, value)
+			return eventservice.ImageEvent{}, false, nil
+		}
+	}
+
+	image, err := i.image.render(data)
+	if err != nil {
+		return eventservice.ImageEvent{}, false, err
+	}
+	if image == "" {
+		klog.Warningf("Webhook %s has no image, ignored", i.options.Name)
+		return eventservice.ImageEvent{}, false, nil
+	}
+
+	event := eventservice.OfImageEvent(image)
+	if i.tag != nil {
+		tag, err := i.tag.render(data)
+		if err != nil {
+			return eventservice.ImageEvent{}, false, err
+		}
+		if tag == "" {
+			klog.Warningf("Webhook %s image %s has no tag, ignored", i.options.Name, image)
+			return eventservice.ImageEvent{}, false, nil
+		}
+		event = eventservice.ImageEvent{Image: image, Tag: tag}
+	}
+	if i.digest != nil {
+		if event.Digest, err = i.digest.render(data); err != nil {
+			return eventservice.ImageEvent{}, false, err
+		}
+	}
+	return event, true, nil
+}
+
+func (i *imageEventWebHook) matched(value string) bool {
+	if i.options.Match.Value != "" {
+		return value == i.options.Match.Value
+	}
+	return value != "" && value != "false"
+}
+
+// authorized 校验请求, 未配置时不校验
+func (i *imageEventWebHook) authorized(req *http.Request, body []byte) bool {
+	auth := i.options.Auth
+	if auth == nil {
+		return true
+	}
+	switch auth.Type {
+	case TokenAuth:
+		header, want := auth.Header, auth.Token
+		if header == "" {
+			header, want = defaultTokenHeader, "Bearer "+auth.Token
+		}
+		return subtle.ConstantTimeCompare([]byte(req.Header.Get(header)), []byte(want)) == 1
+	case BasicAuth:
+		username, password, ok := req.BasicAuth()
+		return ok && subtle.ConstantTimeCompare([]byte(username), []byte(auth.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(auth.Password)) == 1
+	case HMACAuth:
+		header := auth.Header
+		if header == "" {
+			header = defaultSignatureHeader
+		}
+		signature, err := hex.DecodeString(strings.TrimPrefix(req.Header.Get(header), "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(auth.Token))
+		mac.Write(body)
+		return hmac.Equal(signature, mac.Sum(nil))
+	}
+	return false
+}
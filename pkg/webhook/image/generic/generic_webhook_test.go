@@ -0,0 +1,235 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package generic
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+type collected struct {
+	eventservice.ImageEventCollect
+
+	events []eventservice.ImageEvent
+}
+
+func (c *collected) Collect(event eventservice.ImageEvent) {
+	c.events = append(c.events, event)
+}
+
+func Test_imageEventWebHook_ServeHTTP(t *testing.T) {
+	const body = `{"status": "success", "build": 1234567,
+		"artifact": {"registry": "registry.example.com", "repository": "Team/Web", "tag": "v1", "digest": "sha256:fea8"}}`
+	jsonPath := EndpointOptions{
+		Name:   "ci",
+		Match:  &MatchOptions{Expression: "{.status}", Value: "success"},
+		Image:  "{.artifact.registry}/{.artifact.repository}",
+		Tag:    "{.artifact.tag}-{.build}",
+		Digest: "{.artifact.digest}",
+	}
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name       string
+		endpoint   EndpointOptions
+		body       string
+		header     http.Header
+		wantStatus int
+		want       []eventservice.ImageEvent
+	}{
+		{
+			name:       "jsonpath",
+			endpoint:   jsonPath,
+			body:       body,
+			wantStatus: http.StatusOK,
+			want: []eventservice.ImageEvent{{Image: "registry.example.com/Team/Web", Tag: "v1-1234567",
+				Digest: "sha256:fea8", Source: "ci"}},
+		},
+		{
+			name: "template",
+			endpoint: EndpointOptions{
+				Name:   "ci",
+				Syntax: TemplateSyntax,
+				Match:  &MatchOptions{Expression: `{{ eq .status "success" }}`},
+				Image:  "{{ .artifact.registry }}/{{ lower .artifact.repository }}:{{ trimPrefix \"v\" .artifact.tag }}",
+			},
+			body:       body,
+			wantStatus: http.StatusOK,
+			want:       []eventservice.ImageEvent{{Image: "registry.example.com/team/web", Tag: "1", Source: "ci"}},
+		},
+		{
+			name:       "image without tag",
+			endpoint:   EndpointOptions{Name: "ci", Image: "{.artifact.registry}/{.artifact.repository}"},
+			body:       body,
+			wantStatus: http.StatusOK,
+			want:       []eventservice.ImageEvent{{Image: "registry.example.com/Team/Web", Tag: "latest", Source: "ci"}},
+		},
+		{
+			name:       "not matched",
+			endpoint:   jsonPath,
+			body:       strings.Replace(body, "success", "failed", 1),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing image",
+			endpoint:   EndpointOptions{Name: "ci", Syntax: TemplateSyntax, Image: "{{ .image }}"},
+			body:       body,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing tag",
+			endpoint:   EndpointOptions{Name: "ci", Image: "{.artifact.repository}", Tag: "{.version}"},
+			body:       body,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid json",
+			endpoint:   jsonPath,
+			body:       `{"status": `,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bearer token",
+			endpoint:   EndpointOptions{Name: "ci", Image: "{.artifact.repository}", Auth: &AuthOptions{Type: TokenAuth, Token: "secret"}},
+			body:       body,
+			header:     http.Header{"Authorization": []string{"Bearer secret"}},
+			wantStatus: http.StatusOK,
+			want:       []eventservice.ImageEvent{{Image: "Team/Web", Tag: "latest", Source: "ci"}},
+		},
+		{
+			name: "invalid token",
+			endpoint: EndpointOptions{Name: "ci", Image: "{.artifact.repository}",
+				Auth: &AuthOptions{Type: TokenAuth, Header: "X-Token", Token: "secret"}},
+			body:       body,
+			header:     http.Header{"X-Token": []string{"wrong"}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "basic",
+			endpoint: EndpointOptions{Name: "ci", Image: "{.artifact.repository}",
+				Auth: &AuthOptions{Type: BasicAuth, Username: "ci", Password: "secret"}},
+			body:       body,
+			header:     http.Header{"Authorization": []string{"Basic Y2k6c2VjcmV0"}},
+			wantStatus: http.StatusOK,
+			want:       []eventservice.ImageEvent{{Image: "Team/Web", Tag: "latest", Source: "ci"}},
+		},
+		{
+			name:       "hmac",
+			endpoint:   EndpointOptions{Name: "ci", Image: "{.artifact.repository}", Auth: &AuthOptions{Type: HMACAuth, Token: "secret"}},
+			body:       body,
+			header:     http.Header{"X-Hub-Signature-256": []string{sign(body)}},
+			wantStatus: http.StatusOK,
+			want:       []eventservice.ImageEvent{{Image: "Team/Web", Tag: "latest", Source: "ci"}},
+		},
+		{
+			name:       "invalid hmac",
+			endpoint:   EndpointOptions{Name: "ci", Image: "{.artifact.repository}", Auth: &AuthOptions{Type: HMACAuth, Token: "secret"}},
+			body:       body,
+			header:     http.Header{"X-Hub-Signature-256": []string{sign(body + " ")}},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collect := &collected{}
+			handler, err := NewImageEventWebHook(tt.endpoint, collect)
+			if err != nil {
+				t.Fatalf("NewImageEventWebHook() err = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, Path(tt.endpoint.Name), strings.NewReader(tt.body))
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v", recorder.Code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(collect.events, tt.want) {
+				t.Errorf("ServeHTTP() collected = %v, want %v", collect.events, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenericWebhookOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints []EndpointOptions
+		wantErrs  int
+	}{
+		{
+			name: "valid",
+			endpoints: []EndpointOptions{
+				{Name: "jenkins", Image: "{.image}", Auth: &AuthOptions{Type: TokenAuth, Token: "secret"}},
+				{Name: "drone", Syntax: TemplateSyntax, Image: "{{ .repo }}", Tag: "{{ .build.tag }}"},
+			},
+		},
+		{
+			name:      "invalid name",
+			endpoints: []EndpointOptions{{Name: "Jenkins_CI", Image: "{.image}"}},
+			wantErrs:  1,
+		},
+		{
+			name:      "duplicate name",
+			endpoints: []EndpointOptions{{Name: "ci", Image: "{.image}"}, {Name: "ci", Image: "{.image}"}},
+			wantErrs:  1,
+		},
+		{
+			name:      "missing image",
+			endpoints: []EndpointOptions{{Name: "ci", Tag: "{.tag}"}},
+			wantErrs:  1,
+		},
+		{
+			name:      "invalid expression",
+			endpoints: []EndpointOptions{{Name: "ci", Syntax: TemplateSyntax, Image: "{{ .image "}},
+			wantErrs:  1,
+		},
+		{
+			name:      "unknown syntax",
+			endpoints: []EndpointOptions{{Name: "ci", Syntax: "cel", Image: "image"}},
+			wantErrs:  1,
+		},
+		{
+			name:      "auth without token",
+			endpoints: []EndpointOptions{{Name: "ci", Image: "{.image}", Auth: &AuthOptions{Type: HMACAuth}}},
+			wantErrs:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &GenericWebhookOptions{Endpoints: tt.endpoints}
+			if errs := options.Validate(); len(errs) != tt.wantErrs {
+				t.Errorf("Validate() errs = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
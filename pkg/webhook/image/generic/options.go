@@ -0,0 +1,121 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package generic
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// JSONPathSyntax kubectl jsonpath, eg: {.repository.name}:{.tag}
+	JSONPathSyntax = "jsonpath"
+	// TemplateSyntax go template, eg: {{ .repository.name }}:{{ .tag }}
+	TemplateSyntax = "template"
+
+	// TokenAuth the header equals the token, Authorization: Bearer <token> if the header is empty
+	TokenAuth = "token"
+	// BasicAuth http basic authentication
+	BasicAuth = "basic"
+	// HMACAuth the header is the hex HMAC-SHA256 of the body, optionally prefixed with sha256=
+	HMACAuth = "hmac"
+)
+
+type GenericWebhookOptions struct {
+	// Endpoints only configurable through the configuration file
+	Endpoints []EndpointOptions `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+}
+
+type EndpointOptions struct {
+	// Name of the endpoint, a DNS label. The endpoint is mounted on /webhook-v1alpha1-generic-<name>
+	// and the name is the source of the events
+	Name string `json:"name" yaml:"name"`
+	// Syntax of the expressions, optional: jsonpath, template, empty means jsonpath
+	Syntax string `json:"syntax,omitempty" yaml:"syntax,omitempty"`
+	// Auth verifies the requests, nil means the requests are not verified
+	Auth *AuthOptions `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// Match the requests are ignored unless the condition is met, nil means all the requests are accepted
+	Match *MatchOptions `json:"match,omitempty" yaml:"match,omitempty"`
+	// Image expression of the image, the tag may be included if the tag expression is empty
+	Image string `json:"image" yaml:"image"`
+	// Tag expression of the tag, empty means the tag of the image, latest if the image has no tag
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	// Digest expression of the digest, optional
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+type AuthOptions struct {
+	// Type optional: token, basic, hmac
+	Type string `json:"type" yaml:"type"`
+	// Header of the token or the signature, defaults to Authorization for token and X-Hub-Signature-256 for hmac
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+	// Token of token, or the secret of hmac
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+type MatchOptions struct {
+	// Expression rendered with the request body
+	Expression string `json:"expression" yaml:"expression"`
+	// Value the expected value, empty means the rendered value is neither empty nor false
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+func (g *GenericWebhookOptions) Validate() (errs []error) {
+	names := map[string]struct{}{}
+	for _, endpoint := range g.Endpoints {
+		for _, msg := range validation.IsDNS1123Label(endpoint.Name) {
+			errs = append(errs, fmt.Errorf("generic webhook endpoint name %q %s", endpoint.Name, msg))
+		}
+		if _, ok := names[endpoint.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate generic webhook endpoint %s", endpoint.Name))
+		}
+		names[endpoint.Name] = struct{}{}
+		if err := validAuth(endpoint.Auth); err != nil {
+			errs = append(errs, fmt.Errorf("generic webhook endpoint %s %v", endpoint.Name, err))
+		}
+		if _, err := NewImageEventWebHook(endpoint, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func NewGenericWebhookOptions() *GenericWebhookOptions {
+	return &GenericWebhookOptions{}
+}
+
+func validAuth(auth *AuthOptions) error {
+	if auth == nil {
+		return nil
+	}
+	switch auth.Type {
+	case TokenAuth, HMACAuth:
+		if auth.Token == "" {
+			return fmt.Errorf("auth %s requires the token", auth.Type)
+		}
+	case BasicAuth:
+		if auth.Username == "" || auth.Password == "" {
+			return fmt.Errorf("auth basic requires the username and password")
+		}
+	default:
+		return fmt.Errorf("auth type must be one of %s, %s, %s", TokenAuth, BasicAuth, HMACAuth)
+	}
+	return nil
+}
@@ -29,6 +29,8 @@ const (
 	published = "published"
 
 	packageType = "CONTAINER"
+
+	source = "github"
 )
 
 // imageEventWebhook github webhook
@@ -89,5 +91,7 @@ func (i *imageEventWebhook) ServeHTTP(_ http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	i.collect.Collect(eventservice.OfImageEvent(pkage.PackageVersion.PackageUrl))
+	event := eventservice.OfImageEvent(pkage.PackageVersion.PackageUrl)
+	event.Source = source
+	i.collect.Collect(event)
 }
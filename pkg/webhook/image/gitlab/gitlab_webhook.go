@@ -0,0 +1,165 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"github.com/arugal/laborer/pkg/webhook/image/distribution"
+	"k8s.io/klog"
+)
+
+const (
+	source = "gitlab"
+
+	tokenHeader = "X-Gitlab-Token"
+	eventHeader = "X-Gitlab-Event"
+
+	// imagesVariable 流水线变量, 逗号分隔的镜像, <job>=<image> 的镜像由该 job 构建
+	imagesVariable = "LABORER_IMAGES"
+)
+
+// imageEventWebHook gitlab pipeline webhook 以及 container registry 的 notification
+type imageEventWebHook struct {
+	options *GitLabOptions
+	collect eventservice.ImageEventCollect
+}
+
+func NewImageEventWebHook(options *GitLabOptions, collect eventservice.ImageEventCollect) http.Handler {
+	return &imageEventWebHook{
+		options: options,
+		collect: collect,
+	}
+}
+
+func (i *imageEventWebHook) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if i.options.Token != "" && subtle.ConstantTimeCompare([]byte(req.Header.Get(tokenHeader)), []byte(i.options.Token)) != 1 {
+		klog.Warningf("Gitlab webhook from %s has invalid %s, ignored", req.RemoteAddr, tokenHeader)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		klog.Warningf("Read gitlab webhook body error: %v", err)
+		return
+	}
+	if len(body) == 0 {
+		klog.Warningf("Gitlab webhook body is empty")
+		return
+	}
+
+	if klog.V(4) {
+		klog.Infof("Gitlab event data: %s", string(body))
+	}
+
+	// pipeline webhook 带有 X-Gitlab-Event, registry 的 notification 没有
+	var events []eventservice.ImageEvent
+	switch event := req.Header.Get(eventHeader); event {
+	case "":
+		events, err = distribution.ParseEvents(body, i.options.RegistryHost)
+	case PipelineHook:
+		events, err = i.parsePipelineEvent(body)
+	default:
+		klog.Warningf("Unsupported gitlab event %s, ignored", event)
+		return
+	}
+	if err != nil {
+		klog.Warningf("Unmarshal gitlab webhook body [%s] error: %v", string(body), err)
+		return
+	}
+
+	for _, event := range events {
+		event.Source = source
+		i.collect.Collect(event)
+	}
+}
+
+// parsePipelineEvent 成功的流水线中 LABORER_IMAGES 变量的镜像, 指定了 job 的镜像只有 builds 中该 job 成功时才更新,
+// 如 allow_failure 的 job 失败或 manual 的 job 未执行
+func (i *imageEventWebHook) parsePipelineEvent(body []byte) ([]eventservice.ImageEvent, error) {
+	var pipeline PipelineEvent
+	if err := json.Unmarshal(body, &pipeline); err != nil {
+		return nil, err
+	}
+	if pipeline.ObjectKind != pipelineKind || pipeline.ObjectAttributes.Status != pipelineStatus {
+		klog.V(4).Infof("Pipeline %d of %s is %s, ignored", pipeline.ObjectAttributes.ID,
+			pipeline.Project.PathWithNamespace, pipeline.ObjectAttributes.Status)
+		return nil, nil
+	}
+
+	succeeded := make(map[string]bool, len(pipeline.Builds))
+	for _, build := range pipeline.Builds {
+		if build.Status == buildStatus {
+			succeeded[build.Name] = true
+		}
+	}
+
+	var events []eventservice.ImageEvent
+	for _, variable := range pipeline.ObjectAttributes.Variables {
+		if variable.Key != imagesVariable {
+			continue
+		}
+		for _, ref := range strings.Split(variable.Value, ",") {
+			if ref = strings.TrimSpace(ref); ref == "" {
+				continue
+			}
+			if index := strings.Index(ref, "="); index >= 0 {
+				job := strings.TrimSpace(ref[:index])
+				if ref = strings.TrimSpace(ref[index+1:]); ref == "" {
+					continue
+				}
+				if !succeeded[job] {
+					klog.V(4).Infof("Job %s of pipeline %d is not successful, image %s ignored", job, pipeline.ObjectAttributes.ID, ref)
+					continue
+				}
+			}
+			image, ok := i.resolveImage(ref, pipeline.Project.PathWithNamespace)
+			if !ok {
+				klog.Warningf("Image %s of pipeline %d is relative but the gitlab registry host is not configured, ignored",
+					ref, pipeline.ObjectAttributes.ID)
+				continue
+			}
+			events = append(events, eventservice.OfImageEvent(image))
+		}
+	}
+	return events, nil
+}
+
+// resolveImage 补全相对于项目镜像的写法:
+// :v1 -> <registry host>/<project path>:v1
+// web:v1 -> <registry host>/<project path>/web:v1
+// 以 host 开头的镜像保持原样
+func (i *imageEventWebHook) resolveImage(ref, projectPath string) (string, bool) {
+	if index := strings.Index(ref, "/"); index > 0 && eventservice.IsRegistryHost(ref[:index]) {
+		return ref, true
+	}
+	if i.options.RegistryHost == "" {
+		return "", false
+	}
+	// gitlab container registry 的路径都是小写
+	projectImage := i.options.RegistryHost + "/" + strings.ToLower(projectPath)
+	if strings.HasPrefix(ref, ":") {
+		return projectImage + ref, true
+	}
+	return projectImage + "/" + ref, true
+}
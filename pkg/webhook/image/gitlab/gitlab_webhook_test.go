@@ -0,0 +1,133 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+type collected struct {
+	eventservice.ImageEventCollect
+
+	events []eventservice.ImageEvent
+}
+
+func (c *collected) Collect(event eventservice.ImageEvent) {
+	c.events = append(c.events, event)
+}
+
+func Test_imageEventWebHook_ServeHTTP(t *testing.T) {
+	pipeline := func(status, images string) string {
+		return `{"object_kind": "pipeline",
+			"object_attributes": {"id": 31, "ref": "master", "status": "` + status + `",
+				"variables": [{"key": "DEPLOY", "value": "true"}, {"key": "LABORER_IMAGES", "value": "` + images + `"}]},
+			"project": {"id": 1, "path_with_namespace": "Group/Web"},
+			"builds": [{"id": 379, "stage": "build", "name": "build-web", "status": "success"},
+				{"id": 380, "stage": "build", "name": "build-api", "status": "failed"},
+				{"id": 381, "stage": "build", "name": "build-admin", "status": "manual"}]}`
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		event      string
+		body       string
+		wantStatus int
+		want       []eventservice.ImageEvent
+	}{
+		{
+			name:       "pipeline",
+			token:      "secret",
+			event:      PipelineHook,
+			body:       pipeline("success", ":bcbb5ec3, api:bcbb5ec3,registry.example.com/base/nginx:1.19"),
+			wantStatus: http.StatusOK,
+			want: []eventservice.ImageEvent{
+				{Image: "registry.gitlab.example.com/group/web", Tag: "bcbb5ec3", Source: source},
+				{Image: "registry.gitlab.example.com/group/web/api", Tag: "bcbb5ec3", Source: source},
+				{Image: "registry.example.com/base/nginx", Tag: "1.19", Source: source},
+			},
+		},
+		{
+			name:       "successful jobs",
+			token:      "secret",
+			event:      PipelineHook,
+			body:       pipeline("success", "build-web=:bcbb5ec3,build-api=api:bcbb5ec3,build-admin=admin:bcbb5ec3,unknown=nginx:1.19"),
+			wantStatus: http.StatusOK,
+			want: []eventservice.ImageEvent{
+				{Image: "registry.gitlab.example.com/group/web", Tag: "bcbb5ec3", Source: source},
+			},
+		},
+		{
+			name:       "failed pipeline",
+			token:      "secret",
+			event:      PipelineHook,
+			body:       pipeline("failed", ":bcbb5ec3,build-web=web:bcbb5ec3"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "registry notification",
+			token: "secret",
+			body: `{"events": [{"action": "push",
+				"target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "digest": "sha256:fea8", "repository": "group/web", "tag": "v1"},
+				"request": {"host": "gitlab-registry.gitlab.svc:5000"}}]}`,
+			wantStatus: http.StatusOK,
+			want: []eventservice.ImageEvent{{Image: "registry.gitlab.example.com/group/web", Tag: "v1", Digest: "sha256:fea8",
+				ArtifactType: eventservice.ImageArtifact, Source: source}},
+		},
+		{
+			name:       "unsupported event",
+			token:      "secret",
+			event:      "Push Hook",
+			body:       `{"object_kind": "push"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid token",
+			token:      "wrong",
+			event:      PipelineHook,
+			body:       pipeline("success", ":bcbb5ec3"),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collect := &collected{}
+			handler := NewImageEventWebHook(&GitLabOptions{Token: "secret", RegistryHost: "registry.gitlab.example.com"}, collect)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook-v1alpha1-gitlab-image", strings.NewReader(tt.body))
+			req.Header.Set(tokenHeader, tt.token)
+			if tt.event != "" {
+				req.Header.Set(eventHeader, tt.event)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("ServeHTTP() status = %v, want %v", recorder.Code, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(collect.events, tt.want) {
+				t.Errorf("ServeHTTP() collected = %v, want %v", collect.events, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+type GitLabOptions struct {
+	// Token compared with the X-Gitlab-Token header, empty means the requests are not verified
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+	// RegistryHost host of the GitLab container registry used in the images, eg: registry.gitlab.example.com
+	RegistryHost string `json:"registryHost,omitempty" yaml:"registryHost,omitempty"`
+}
+
+func (g *GitLabOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&g.Token, "gitlab-token", g.Token, "secret token of the GitLab webhook and registry notification, compared with the X-Gitlab-Token header")
+	fs.StringVar(&g.RegistryHost, "gitlab-registry-host", g.RegistryHost, "host of the GitLab container registry used in the images, "+
+		"resolves the images of pipeline events and replaces the host of registry notifications")
+}
+
+func (g *GitLabOptions) Validate() (errs []error) {
+	if strings.Contains(g.RegistryHost, "://") || strings.Contains(g.RegistryHost, "/") {
+		errs = append(errs, fmt.Errorf("gitlab registry host must be a host without scheme and path, eg: registry.gitlab.example.com"))
+	}
+	return errs
+}
+
+func NewGitLabOptions() *GitLabOptions {
+	return &GitLabOptions{}
+}
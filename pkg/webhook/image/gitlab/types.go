@@ -0,0 +1,95 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package gitlab
+
+const (
+	PipelineHook = "Pipeline Hook"
+
+	pipelineKind   = "pipeline"
+	pipelineStatus = "success"
+	buildStatus    = "success"
+)
+
+//{
+//	"object_kind": "pipeline",
+//	"object_attributes": {
+//		"id": 31,
+//		"ref": "master",
+//		"tag": false,
+//		"sha": "bcbb5ec396a2c0f828686f14fac9b80b780504f2",
+//		"status": "success",
+//		"variables": [
+//			{
+//				"key": "LABORER_IMAGES",
+//				"value": ":bcbb5ec3,build-web=web:bcbb5ec3"
+//			}
+//		]
+//	},
+//	"project": {
+//		"id": 1,
+//		"name": "Gitlab Test",
+//		"path_with_namespace": "gitlab-org/gitlab-test"
+//	},
+//	"builds": [
+//		{
+//			"id": 379,
+//			"stage": "build",
+//			"name": "build-web",
+//			"status": "success"
+//		},
+//		{
+//			"id": 380,
+//			"stage": "deploy",
+//			"name": "production",
+//			"status": "success"
+//		}
+//	]
+//}
+
+type PipelineEvent struct {
+	ObjectKind       string           `json:"object_kind"`
+	ObjectAttributes ObjectAttributes `json:"object_attributes"`
+	Project          Project          `json:"project"`
+	Builds           []Build          `json:"builds"`
+}
+
+type ObjectAttributes struct {
+	ID        int        `json:"id"`
+	Ref       string     `json:"ref"`
+	Tag       bool       `json:"tag"`
+	Sha       string     `json:"sha"`
+	Status    string     `json:"status"`
+	Variables []Variable `json:"variables"`
+}
+
+type Variable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type Project struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+}
+
+type Build struct {
+	ID     int    `json:"id"`
+	Stage  string `json:"stage"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
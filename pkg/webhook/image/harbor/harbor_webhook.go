@@ -20,19 +20,54 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"sync"
+	"time"
 
 	eventservice "github.com/arugal/laborer/pkg/service/event"
 	"k8s.io/klog"
 )
 
+const (
+	source = "harbor"
+
+	// scanSuccess scan_status of the finished report
+	scanSuccess = "Success"
+
+	// pendingTimeout 等待扫描结果的最长时间, 超时的 push 不再更新工作负载
+	pendingTimeout = time.Hour
+)
+
+// artifactTypes harbor 的 artifact 类型, 其他类型 (如 CNAB) 由 tag 的约定得出
+var artifactTypes = map[string]string{
+	"IMAGE": eventservice.ImageArtifact,
+	"CHART": eventservice.ChartArtifact,
+}
+
+// pendingPush 等待扫描结果的 push 事件
+type pendingPush struct {
+	event    eventservice.ImageEvent
+	pushedAt time.Time
+}
+
 // imageEventWebHook harbor webhook
 type imageEventWebHook struct {
+	options *HarborOptions
 	collect eventservice.ImageEventCollect
+
+	// pending image@digest -> 等待扫描的 push, 只有等待中的 artifact 的扫描结果才会触发更新,
+	// 避免定时扫描或者重新扫描旧的 tag 时回滚工作负载
+	pending map[string][]pendingPush
+	mu      sync.Mutex
+	now     func() time.Time
 }
 
-func NewImageEventWebHook(collect eventservice.ImageEventCollect) http.Handler {
+func NewImageEventWebHook(options *HarborOptions, collect eventservice.ImageEventCollect) http.Handler {
 	return &imageEventWebHook{
+		options: options,
 		collect: collect,
+		pending: map[string][]pendingPush{},
+		now:     time.Now,
 	}
 }
 
@@ -46,16 +81,6 @@ func (i *imageEventWebHook) ServeHTTP(_ http.ResponseWriter, req *http.Request)
 		klog.Warningf("Harbor webhook body is empty")
 		return
 	}
-	var bodyMap map[string]interface{}
-	err = json.Unmarshal(body, &bodyMap)
-	if err != nil {
-		klog.Warningf("Unmarshal harbor webhook body [%s] error: %v", string(body), err)
-		return
-	}
-	if typ, ok := bodyMap["type"]; !ok || typ != Push {
-		klog.Warningf("Unsupported event type %s, ignored", string(body))
-		return
-	}
 
 	var webhook WebHook
 	err = json.Unmarshal(body, &webhook)
@@ -68,7 +93,144 @@ func (i *imageEventWebHook) ServeHTTP(_ http.ResponseWriter, req *http.Request)
 		klog.Infof("Harbor event data: %s", string(body))
 	}
 
+	for _, event := range i.parseEvents(webhook) {
+		event.Source = source
+		i.collect.Collect(event)
+	}
+}
+
+// parseEvents 将 harbor 的事件转换为镜像事件:
+// PUSH_ARTIFACT 为 push 事件, 等待扫描时暂存
+// DELETE_ARTIFACT 为 delete 事件
+// SCANNING_COMPLETED, SCANNING_FAILED 带有漏洞扫描的结果, 等待扫描时发出暂存的 push 事件, 否则为 scan 事件
+func (i *imageEventWebHook) parseEvents(webhook WebHook) []eventservice.ImageEvent {
+	var typ eventservice.EventType
+	switch webhook.Type {
+	case Push:
+		typ = eventservice.PushEvent
+	case Delete:
+		typ = eventservice.DeleteEvent
+	case ScanningCompleted, ScanningFailed:
+		typ = eventservice.ScanEvent
+	default:
+		klog.Warningf("Unsupported event type %s, ignored", webhook.Type)
+		return nil
+	}
+
+	var events []eventservice.ImageEvent
 	for _, resource := range webhook.EventData.Resources {
-		i.collect.Collect(eventservice.OfImageEvent(resource.ResourceURL))
+		// 没有 tag 的 artifact 无法对应到工作负载中的镜像
+		if resource.Tag == "" {
+			klog.V(4).Infof("Harbor artifact %s has no tag, ignored", resource.ResourceURL)
+			continue
+		}
+		event := eventservice.OfImageEvent(resource.ResourceURL)
+		event.Type = typ
+		event.Digest = resource.Digest
+		event.ArtifactType = artifactTypes[resource.Type]
+		if webhook.Type == ScanningCompleted || webhook.Type == ScanningFailed {
+			event.Scan = scanSummary(webhook.Type, resource)
+		}
+		events = append(events, event)
+	}
+
+	if i.options.WaitForScan {
+		switch typ {
+		case eventservice.PushEvent:
+			i.hold(events)
+			return nil
+		case eventservice.ScanEvent:
+			return i.release(webhook.Type, events)
+		}
+	}
+	return events
+}
+
+// hold 暂存 push 事件直到同一 digest 的扫描结果到达
+func (i *imageEventWebHook) hold(events []eventservice.ImageEvent) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire()
+	for _, event := range events {
+		klog.V(4).Infof("Harbor artifact %s:%s@%s is pushed, waiting for the scan", event.Image, event.Tag, event.Digest)
+		key := pendingKey(event)
+		i.pending[key] = append(i.pending[key], pendingPush{event: event, pushedAt: i.now()})
+	}
+}
+
+// release 扫描结果对应的暂存 push 事件, 扫描失败时不更新工作负载, 不在等待中的 artifact(定时扫描, 重新扫描) 被忽略
+func (i *imageEventWebHook) release(typ string, scans []eventservice.ImageEvent) []eventservice.ImageEvent {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.expire()
+	var events []eventservice.ImageEvent
+	for _, scan := range scans {
+		key := pendingKey(scan)
+		pushes, ok := i.pending[key]
+		if !ok {
+			klog.V(4).Infof("Harbor artifact %s:%s@%s is scanned but not waiting for the scan, ignored", scan.Image, scan.Tag, scan.Digest)
+			continue
+		}
+		delete(i.pending, key)
+		if typ == ScanningFailed {
+			klog.Warningf("Harbor artifact %s:%s@%s failed to be scanned, ignored", scan.Image, scan.Tag, scan.Digest)
+			continue
+		}
+		for _, push := range pushes {
+			push.event.Scan = scan.Scan
+			events = append(events, push.event)
+		}
+	}
+	return events
+}
+
+// expire 移除超时的 push, 未开启扫描的项目的 push 不会一直暂存
+func (i *imageEventWebHook) expire() {
+	for key, pushes := range i.pending {
+		if i.now().Sub(pushes[len(pushes)-1].pushedAt) > pendingTimeout {
+			klog.Warningf("Harbor artifact %s has not been scanned in %s, ignored", key, pendingTimeout)
+			delete(i.pending, key)
+		}
+	}
+}
+
+// pendingKey 同一 artifact 的 push 和扫描事件, 没有 digest 时使用 tag
+func pendingKey(event eventservice.ImageEvent) string {
+	if event.Digest == "" {
+		return event.Image + ":" + event.Tag
+	}
+	return event.Image + "@" + event.Digest
+}
+
+// scanSummary 漏洞扫描的结果, 有多个报告时使用 mime type 排序后的第一个
+func scanSummary(typ string, resource EventResource) *eventservice.ScanSummary {
+	summary := &eventservice.ScanSummary{
+		Status: eventservice.ScanFailed,
+	}
+
+	mimeTypes := make([]string, 0, len(resource.ScanOverview))
+	for mimeType := range resource.ScanOverview {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	if len(mimeTypes) == 0 {
+		return summary
+	}
+	sort.Strings(mimeTypes)
+
+	report := resource.ScanOverview[mimeTypes[0]]
+	if typ == ScanningCompleted && report.ScanStatus == scanSuccess {
+		summary.Status = eventservice.ScanSuccess
+	}
+	summary.Severity = report.Severity
+	if report.Summary != nil {
+		summary.Total = report.Summary.Total
+		summary.Fixable = report.Summary.Fixable
+		summary.Summary = report.Summary.Summary
+	}
+	if report.Scanner != nil {
+		summary.Scanner = report.Scanner.Name
 	}
+	return summary
 }
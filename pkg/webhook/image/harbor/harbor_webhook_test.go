@@ -0,0 +1,182 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package harbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+type collected struct {
+	eventservice.ImageEventCollect
+
+	events []eventservice.ImageEvent
+}
+
+func (c *collected) Collect(event eventservice.ImageEvent) {
+	c.events = append(c.events, event)
+}
+
+func Test_imageEventWebHook_ServeHTTP(t *testing.T) {
+	webhook := func(typ, resource string) string {
+		return `{"type": "` + typ + `", "occur_at": 1603728502, "operator": "admin",
+			"event_data": {"resources": [` + resource + `],
+				"repository": {"name": "web", "namespace": "library", "repo_full_name": "library/web", "repo_type": "private"}}}`
+	}
+	artifact := `{"digest": "sha256:65ff", "tag": "v1", "resource_url": "harbor.example.com/library/web:v1"}`
+	scanned := `{"digest": "sha256:65ff", "tag": "v1", "resource_url": "harbor.example.com/library/web:v1",
+		"scan_overview": {"application/vnd.security.vulnerability.report; version=1.1": {
+			"report_id": "2b6e", "scan_status": "Success", "severity": "High", "duration": 5,
+			"summary": {"total": 3, "fixable": 2, "summary": {"High": 1, "Low": 2}},
+			"scanner": {"name": "Trivy", "vendor": "Aqua Security", "version": "v0.16.0"}, "complete_percent": 100}}}`
+	// rescanned 之前 push 的 v0 被定时扫描
+	rescanned := strings.NewReplacer("sha256:65ff", "sha256:0a1b", "v1", "v0").Replace(scanned)
+	scanSummary := &eventservice.ScanSummary{
+		Status:   eventservice.ScanSuccess,
+		Severity: "High",
+		Total:    3,
+		Fixable:  2,
+		Summary:  map[string]int{"High": 1, "Low": 2},
+		Scanner:  "Trivy",
+	}
+	image := func(typ eventservice.EventType, scan *eventservice.ScanSummary) []eventservice.ImageEvent {
+		return []eventservice.ImageEvent{{
+			Image:  "harbor.example.com/library/web",
+			Tag:    "v1",
+			Source: source,
+			Type:   typ,
+			Digest: "sha256:65ff",
+			Scan:   scan,
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		waitForScan bool
+		bodies      []string
+		want        []eventservice.ImageEvent
+	}{
+		{
+			name:   "push",
+			bodies: []string{webhook(Push, artifact)},
+			want:   image(eventservice.PushEvent, nil),
+		},
+		{
+			name:        "push waiting for scan",
+			waitForScan: true,
+			bodies:      []string{webhook(Push, artifact)},
+		},
+		{
+			name:   "delete",
+			bodies: []string{webhook(Delete, artifact)},
+			want:   image(eventservice.DeleteEvent, nil),
+		},
+		{
+			name:   "scanning completed",
+			bodies: []string{webhook(ScanningCompleted, scanned)},
+			want:   image(eventservice.ScanEvent, scanSummary),
+		},
+		{
+			name:        "scanning completed waiting for scan",
+			waitForScan: true,
+			bodies:      []string{webhook(Push, artifact), webhook(ScanningCompleted, scanned)},
+			want:        image(eventservice.PushEvent, scanSummary),
+		},
+		{
+			name:        "scanned twice waiting for scan",
+			waitForScan: true,
+			bodies:      []string{webhook(Push, artifact), webhook(ScanningCompleted, scanned), webhook(ScanningCompleted, scanned)},
+			want:        image(eventservice.PushEvent, scanSummary),
+		},
+		{
+			name:        "rescan of an older tag waiting for scan",
+			waitForScan: true,
+			bodies:      []string{webhook(Push, artifact), webhook(ScanningCompleted, rescanned)},
+		},
+		{
+			name:        "scan without push waiting for scan",
+			waitForScan: true,
+			bodies:      []string{webhook(ScanningCompleted, scanned)},
+		},
+		{
+			name:        "scanning failed waiting for scan",
+			waitForScan: true,
+			bodies:      []string{webhook(Push, artifact), webhook(ScanningFailed, artifact), webhook(ScanningCompleted, scanned)},
+		},
+		{
+			name: "chart",
+			bodies: []string{webhook(Push, `{"digest": "sha256:c4a2", "tag": "0.1.0", "type": "CHART",
+				"resource_url": "harbor.example.com/charts/web:0.1.0"}`)},
+			want: []eventservice.ImageEvent{{
+				Image:        "harbor.example.com/charts/web",
+				Tag:          "0.1.0",
+				Source:       source,
+				Type:         eventservice.PushEvent,
+				Digest:       "sha256:c4a2",
+				ArtifactType: eventservice.ChartArtifact,
+			}},
+		},
+		{
+			name:   "artifact without tag",
+			bodies: []string{webhook(Delete, `{"digest": "sha256:65ff", "resource_url": "harbor.example.com/library/web@sha256:65ff"}`)},
+		},
+		{
+			name:   "unsupported type",
+			bodies: []string{webhook("PULL_ARTIFACT", artifact)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collect := &collected{}
+			handler := NewImageEventWebHook(&HarborOptions{WaitForScan: tt.waitForScan}, collect)
+
+			for _, body := range tt.bodies {
+				req := httptest.NewRequest(http.MethodPost, "/webhook-v1alpha1-harbor-image", strings.NewReader(body))
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			if !reflect.DeepEqual(collect.events, tt.want) {
+				t.Errorf("ServeHTTP() collected = %+v, want %+v", collect.events, tt.want)
+			}
+		})
+	}
+}
+
+func Test_imageEventWebHook_expire(t *testing.T) {
+	body := func(typ string) string {
+		return `{"type": "` + typ + `", "event_data": {"resources": [
+			{"digest": "sha256:65ff", "tag": "v1", "resource_url": "harbor.example.com/library/web:v1"}]}}`
+	}
+	collect := &collected{}
+	handler := NewImageEventWebHook(&HarborOptions{WaitForScan: true}, collect).(*imageEventWebHook)
+	now := time.Now()
+	handler.now = func() time.Time { return now }
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body(Push))))
+	now = now.Add(pendingTimeout + time.Minute)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body(ScanningCompleted))))
+
+	if len(collect.events) != 0 {
+		t.Errorf("ServeHTTP() collected = %+v, want none", collect.events)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package harbor
+
+import (
+	"github.com/spf13/pflag"
+)
+
+type HarborOptions struct {
+	// WaitForScan hold the pushed artifacts until the vulnerability scan of the same digest completes,
+	// requires "Automatically scan images on push" of the harbor project
+	WaitForScan bool `json:"waitForScan,omitempty" yaml:"waitForScan,omitempty"`
+}
+
+func (h *HarborOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&h.WaitForScan, "harbor-wait-for-scan", h.WaitForScan, "update the workloads when the pushed artifact has been scanned "+
+		"(SCANNING_COMPLETED of the pushed digest) instead of on PUSH_ARTIFACT, failed scans and rescans of the other artifacts are ignored, "+
+		"requires scan on push of the harbor project")
+}
+
+func (h *HarborOptions) Validate() []error {
+	return nil
+}
+
+func NewHarborOptions() *HarborOptions {
+	return &HarborOptions{}
+}
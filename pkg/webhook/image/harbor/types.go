@@ -17,7 +17,10 @@
 package harbor
 
 const (
-	Push = "PUSH_ARTIFACT"
+	Push              = "PUSH_ARTIFACT"
+	Delete            = "DELETE_ARTIFACT"
+	ScanningCompleted = "SCANNING_COMPLETED"
+	ScanningFailed    = "SCANNING_FAILED"
 )
 
 //{
@@ -28,7 +31,8 @@ const (
 //	 		"resources":[
 //	 			{
 //	 				"digest":"sha256:65fffb1482321b23ed3fc24bd6961385335ec7fca12de3420a9d778afe3c5e56",
-//	 				"tag":"v1.0.0","resource_url":"image/image:v1.0.0"
+//	 				"tag":"v1.0.0","resource_url":"image/image:v1.0.0",
+//	 				"type":"IMAGE"
 //	 			}
 //			],
 //			"repository":
@@ -54,10 +58,67 @@ type EventData struct {
 	Repository Repository      `json:"repository"`
 }
 
+//{
+//	"type": "SCANNING_COMPLETED",
+//	"occur_at": 1603728520,
+//	"operator": "auto",
+//	"event_data": {
+//		"resources": [
+//			{
+//				"digest": "sha256:65fffb1482321b23ed3fc24bd6961385335ec7fca12de3420a9d778afe3c5e56",
+//				"tag": "v1.0.0",
+//				"resource_url": "harbor.example.com/image/image:v1.0.0",
+//				"scan_overview": {
+//					"application/vnd.security.vulnerability.report; version=1.1": {
+//						"report_id": "2b6e7b1c-6b4a-4b0f-9b7f-4f8d5c3c0a6e",
+//						"scan_status": "Success",
+//						"severity": "High",
+//						"duration": 5,
+//						"summary": {
+//							"total": 12,
+//							"fixable": 10,
+//							"summary": {"Critical": 0, "High": 2, "Medium": 5, "Low": 5}
+//						},
+//						"scanner": {"name": "Trivy", "vendor": "Aqua Security", "version": "v0.16.0"},
+//						"complete_percent": 100
+//					}
+//				}
+//			}
+//		],
+//		"repository": {...}
+//	}
+//}
+
 type EventResource struct {
 	Digest      string `json:"digest,omitempty"`
 	Tag         string `json:"tag"`
 	ResourceURL string `json:"resource_url"`
+	// Type the artifact type, eg: IMAGE, CHART, CNAB
+	Type         string                    `json:"type,omitempty"`
+	ScanOverview map[string]ReportOverview `json:"scan_overview,omitempty"`
+}
+
+// ReportOverview overview of the vulnerability report, keyed by the mime type of the report
+type ReportOverview struct {
+	ReportID        string                `json:"report_id"`
+	ScanStatus      string                `json:"scan_status"`
+	Severity        string                `json:"severity"`
+	Duration        int64                 `json:"duration"`
+	Summary         *VulnerabilitySummary `json:"summary,omitempty"`
+	Scanner         *Scanner              `json:"scanner,omitempty"`
+	CompletePercent int                   `json:"complete_percent"`
+}
+
+type VulnerabilitySummary struct {
+	Total   int            `json:"total"`
+	Fixable int            `json:"fixable"`
+	Summary map[string]int `json:"summary"`
+}
+
+type Scanner struct {
+	Name    string `json:"name"`
+	Vendor  string `json:"vendor"`
+	Version string `json:"version"`
 }
 
 type Repository struct {
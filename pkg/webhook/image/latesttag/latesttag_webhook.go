@@ -21,79 +21,150 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/arugal/laborer/pkg/service/activity"
+	eventservice "github.com/arugal/laborer/pkg/service/event"
 	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/service/signature"
 	"gomodules.xyz/jsonpatch/v2"
-	appsv1 "k8s.io/api/apps/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 const (
 	defaultTagName = "latest"
+
+	source = "latest-tag"
+
+	// modeLabel namespace 的 label 优先于配置的 mode
+	modeLabel = "laborer.latest-tag.mode"
 )
 
-// latestTagWebHook 创建 Deployment 时将 initContainers 和 containers 的 image
+// latestTagWebHook 创建或修改包含 pod 模板的资源时将 initContainers 和 containers 的 image
 // 设置为镜像仓库中最新的 tag
 type latestTagWebHook struct {
+	options     *LatestTagOptions
 	repoService repositoryservice.RepositoryService
-	decoder     *admission.Decoder
+	// verifier 校验最新 tag 的签名, 为 nil 时不校验
+	verifier signature.Verifier
+	client   kubernetes.Interface
+	// timeout 单个准入请求中查询最新 tag 的总时间
+	timeout  time.Duration
+	recorder activity.Recorder
 }
 
-func NewLatestTagWebHook(repoService repositoryservice.RepositoryService) admission.Handler {
+// NewLatestTagWebHook client 用于读取工作负载的 imagePullSecrets, 为 nil 时只使用镜像仓库配置的凭证
+func NewLatestTagWebHook(options *LatestTagOptions, repoService repositoryservice.RepositoryService, verifier signature.Verifier,
+	client kubernetes.Interface, timeout time.Duration, recorder activity.Recorder) admission.Handler {
 	return &latestTagWebHook{
+		options:     options,
 		repoService: repoService,
+		verifier:    verifier,
+		client:      client,
+		timeout:     timeout,
+		recorder:    recorder,
 	}
 }
 
 func (l *latestTagWebHook) Handle(ctx context.Context, req admission.Request) admission.Response {
-	klog.V(2).Infof("uid: %s, kind: %s, resource: %s, subResource: %s, RequestKind: %s, dryRun: %t",
-		req.UID, req.Kind, req.Resource, req.SubResource, req.RequestKind, *req.DryRun)
+	klog.V(2).Infof("uid: %s, kind: %s, resource: %s, subResource: %s, RequestKind: %s, operation: %s, dryRun: %t",
+		req.UID, req.Kind, req.Resource, req.SubResource, req.RequestKind, req.Operation, isDryRun(req))
 
-	deployment := &appsv1.Deployment{}
-	err := l.decoder.Decode(req, deployment)
+	obj, err := decodeWorkload(req.Kind.Kind, req.Object.Raw)
 	if err != nil {
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	// 由控制器创建的资源 (如 Deployment 的 Pod, CronJob 的 Job) 与其模板保持一致
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		return admission.Allowed(fmt.Sprintf("controlled by %s %s", owner.Kind, owner.Name))
+	}
 
-	var patches []jsonpatch.JsonPatchOperation
-
-	for i, initContainer := range deployment.Spec.Template.Spec.InitContainers {
-		//initContainer.Image
-		host, project, repo, oldTag, part, err := analysisImage(initContainer.Image)
-		if err != nil {
-			klog.Errorf("analysisImage [%s] err: %v", initContainer.Image, err)
-			continue
+	// UPDATE 时只替换 image 发生变化的容器
+	var oldObj *workload
+	if req.Operation == admissionv1.Update {
+		if oldObj, err = decodeWorkload(req.Kind.Kind, req.OldObject.Raw); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
 		}
+	}
 
-		tag, err := l.repoService.LatestTag(host, project, repo)
-		if err != nil {
-			klog.V(2).Infof("%s get latest tag err: %v", initContainer.Image, err)
-			continue
-		}
-		if tag == oldTag {
-			continue
-		}
-		newImage := generateNewImageName(host, project, repo, tag, part)
-		klog.Infof("Replace initContainer %s.%s.%s image %s -> %s, dryRun: %t", deployment.Namespace, deployment.Name,
-			initContainer.Name, initContainer.Image, newImage, *req.DryRun)
+	// 超时后未查询的容器保持原样, 不阻塞资源的创建
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
 
-		patches = append(patches, jsonpatch.JsonPatchOperation{
-			Operation: "replace",
-			Path:      fmt.Sprintf("/spec/template/spec/initContainers/%d/image", i),
-			Value:     newImage,
-		})
+	ns := l.namespace(ctx, req.Namespace)
+	strategy, err := tagStrategy(ns, obj.Annotations)
+	if err != nil {
+		// 策略无效时不替换镜像, 以免选择错误的 tag
+		klog.Errorf("%s %s/%s tag strategy err: %v", req.Kind.Kind, req.Namespace, obj.Name, err)
+		return admission.Allowed(fmt.Sprintf("invalid tag strategy: %v", err))
+	}
+
+	keychain := repositoryservice.PullSecretsKeychain(ctx, l.client, req.Namespace, &obj.podSpec)
+	m := &mutation{
+		req:             req,
+		obj:             obj,
+		eventID:         activity.NewEventID(),
+		placeholderOnly: l.placeholderOnly(ns),
+		keychain:        keychain,
+		lookupOptions: []repositoryservice.LookupOption{
+			repositoryservice.WithKeychain(keychain),
+			repositoryservice.WithTagStrategy(strategy),
+		},
+	}
+	var oldInitContainers, oldContainers map[string]string
+	if oldObj != nil {
+		oldInitContainers, oldContainers = containerImages(oldObj.podSpec.InitContainers), containerImages(oldObj.podSpec.Containers)
+	}
+	l.mutateContainers(ctx, m, "initContainers", obj.podSpec.InitContainers, oldInitContainers)
+	l.mutateContainers(ctx, m, "containers", obj.podSpec.Containers, oldContainers)
+
+	// 最新 tag 的签名无效时拒绝整个请求, 而不是静默保留旧的镜像
+	if len(m.refused) > 0 {
+		return admission.Denied(fmt.Sprintf("refused unverified images: %s", strings.Join(m.refused, "; ")))
 	}
+	resp := admission.Allowed("")
+	if len(m.patches) > 0 {
+		resp.Patches = m.patches
+	}
+	return resp
+}
+
+// mutation 单个准入请求的替换
+type mutation struct {
+	req             admission.Request
+	obj             *workload
+	eventID         string
+	placeholderOnly bool
+	// keychain 工作负载的镜像仓库凭证, 用于查询最新 tag 以及读取签名
+	keychain      repositoryservice.Keychain
+	lookupOptions []repositoryservice.LookupOption
+
+	patches []jsonpatch.JsonPatchOperation
+	// refused 签名校验未通过的镜像及原因
+	refused []string
+}
 
-	for i, container := range deployment.Spec.Template.Spec.Containers {
-		//container.Image
+// mutateContainers 替换 containers 的 image, oldImages 不为 nil 时跳过 image 未改变的容器
+func (l *latestTagWebHook) mutateContainers(ctx context.Context, m *mutation, field string, containers []corev1.Container, oldImages map[string]string) {
+	for i, container := range containers {
+		if oldImage, ok := oldImages[container.Name]; ok && oldImage == container.Image {
+			continue
+		}
 		host, project, repo, oldTag, part, err := analysisImage(container.Image)
 		if err != nil {
 			klog.Errorf("analysisImage [%s] err: %v", container.Image, err)
 			continue
 		}
+		if !l.resolvable(container.Image, oldTag, m.placeholderOnly) {
+			continue
+		}
 
-		tag, err := l.repoService.LatestTag(host, project, repo)
+		tag, err := l.repoService.LatestTag(ctx, host, project, repo, m.lookupOptions...)
 		if err != nil {
 			klog.V(2).Infof("%s get latest tag err: %v", container.Image, err)
 			continue
@@ -103,49 +174,129 @@ func (l *latestTagWebHook) Handle(ctx context.Context, req admission.Request) ad
 		}
 
 		newImage := generateNewImageName(host, project, repo, tag, part)
-		klog.Infof("Replace container %s.%s.%s image %s -> %s, dryRun: %t", deployment.Namespace, deployment.Name,
-			container.Name, container.Image, newImage, *req.DryRun)
+		if l.verifier != nil {
+			digest, err := l.verifier.Verify(ctx, m.req.Namespace, newImage, m.keychain)
+			if err != nil {
+				klog.Warningf("Refuse %s %s.%s.%s image %s: %v", field, m.req.Namespace, m.obj.Name, container.Name, newImage, err)
+				l.record(m, activity.Unverified, container.Name, container.Image, newImage, err.Error())
+				m.refused = append(m.refused, fmt.Sprintf("%s: %v", newImage, err))
+				continue
+			}
+			if digest != "" {
+				// 固定为通过校验的 digest, 校验之后重新 push 的 tag 不会被使用
+				newImage = eventservice.PinDigest(newImage, digest)
+			}
+		}
+		klog.Infof("Replace %s %s %s.%s.%s image %s -> %s, dryRun: %t", field, m.req.Kind.Kind, m.req.Namespace, m.obj.Name,
+			container.Name, container.Image, newImage, isDryRun(m.req))
+		l.record(m, activity.Mutated, container.Name, container.Image, newImage, "")
 
-		patches = append(patches, jsonpatch.JsonPatchOperation{
+		m.patches = append(m.patches, jsonpatch.JsonPatchOperation{
 			Operation: "replace",
-			Path:      fmt.Sprintf("/spec/template/spec/containers/%d/image", i),
+			Path:      fmt.Sprintf("%s/%s/%d/image", m.obj.path, field, i),
 			Value:     newImage,
 		})
 	}
+}
 
-	resp := admission.Allowed("")
-	if len(patches) > 0 {
-		resp.Patches = patches
+// namespace 读取 namespace 的 label 和 annotation, 读取失败时返回 nil
+func (l *latestTagWebHook) namespace(ctx context.Context, name string) *corev1.Namespace {
+	if l.client == nil {
+		return nil
 	}
-	return resp
+	ns, err := l.client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		klog.V(2).Infof("get namespace %s err: %v", name, err)
+		return nil
+	}
+	return ns
+}
+
+// placeholderOnly 是否只替换占位的 tag, namespace 的 label 优先于配置
+func (l *latestTagWebHook) placeholderOnly(ns *corev1.Namespace) bool {
+	mode := l.options.Mode
+	if value, ok := namespaceLabels(ns)[modeLabel]; ok {
+		if validMode(value) {
+			mode = value
+		} else {
+			klog.Warningf("namespace %s has invalid %s %q, use %s", ns.Name, modeLabel, value, mode)
+		}
+	}
+	return mode == PlaceholderMode
+}
+
+// resolvable placeholder 模式下只替换未指定 tag, latest 以及占位 tag 的镜像, 以 digest 固定的镜像始终保持原样
+func (l *latestTagWebHook) resolvable(image, tag string, placeholderOnly bool) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+	if !placeholderOnly || tag == defaultTagName {
+		return true
+	}
+	for _, placeholder := range l.options.Placeholders {
+		if tag == placeholder {
+			return true
+		}
+	}
+	return false
 }
 
-// InjectDecoder inject the decoder
-func (l *latestTagWebHook) InjectDecoder(d *admission.Decoder) error {
-	l.decoder = d
-	return nil
+func namespaceLabels(ns *corev1.Namespace) map[string]string {
+	if ns == nil {
+		return nil
+	}
+	return ns.Labels
+}
+
+// record record the replaced or refused image, dry run requests are not recorded
+func (l *latestTagWebHook) record(m *mutation, action activity.Action, container, oldImage, newImage, message string) {
+	if isDryRun(m.req) {
+		return
+	}
+	activity.Record(l.recorder, activity.Activity{
+		EventID:   m.eventID,
+		Action:    action,
+		Source:    source,
+		Namespace: m.req.Namespace,
+		Kind:      m.req.Kind.Kind,
+		Name:      m.obj.Name,
+		Container: container,
+		Image:     newImage,
+		OldImage:  oldImage,
+		Message:   message,
+	})
+}
+
+func isDryRun(req admission.Request) bool {
+	return req.DryRun != nil && *req.DryRun
 }
 
 // generateNewImageName 生成新的 image 名称
 func generateNewImageName(host, project, repo, tag string, part int) string {
-	switch part {
-	case 3:
+	switch {
+	case part >= 3:
 		return fmt.Sprintf("%s/%s/%s:%s", host, project, repo, tag)
-	case 2:
+	case part == 2 && host != "":
+		return fmt.Sprintf("%s/%s:%s", host, repo, tag)
+	case part == 2:
 		return fmt.Sprintf("%s/%s:%s", project, repo, tag)
 	default:
 		return fmt.Sprintf("%s:%s", repo, tag)
 	}
 }
 
-// analysisImage 从 image 中提取信息
+// analysisImage 从 image 中提取信息, 多级路径的中间部分作为 project
 func analysisImage(image string) (host, project, repo, tag string, part int, err error) {
 	parts := strings.Split(image, "/")
-	if len(parts) == 3 {
+	if len(parts) >= 3 {
 		// host and project and repo
 		host = parts[0]
-		project = parts[1]
-		repo = parts[2]
+		project = strings.Join(parts[1:len(parts)-1], "/")
+		repo = parts[len(parts)-1]
+	} else if len(parts) == 2 && isHost(parts[0]) {
+		// host and repo, eg: localhost:5000/repo
+		host = parts[0]
+		repo = parts[1]
 	} else if len(parts) == 2 {
 		// project and repo
 		project = parts[0]
@@ -158,6 +309,11 @@ func analysisImage(image string) (host, project, repo, tag string, part int, err
 	return
 }
 
+// isHost 与 docker 的规则一致, 包含 . 或 : 或者为 localhost 的第一段是镜像仓库的 host
+func isHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
+
 // analysisTag 从 repo 中提取信息
 func analysisTag(repo string) (name, tag string) {
 	parts := strings.Split(repo, ":")
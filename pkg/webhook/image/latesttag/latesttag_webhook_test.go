@@ -16,7 +16,28 @@
 
 package latesttag
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	"github.com/arugal/laborer/pkg/service/signature"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
 
 func Test_analysisImage(t *testing.T) {
 	type args struct {
@@ -65,6 +86,29 @@ func Test_analysisImage(t *testing.T) {
 			wantPart: 1,
 			wantErr:  false,
 		},
+		{
+			name: "host and repo",
+			args: args{
+				image: "localhost:5000/repo:1.0.0",
+			},
+			wantHost: "localhost:5000",
+			wantRepo: "repo",
+			wantTag:  "1.0.0",
+			wantPart: 2,
+			wantErr:  false,
+		},
+		{
+			name: "nested project",
+			args: args{
+				image: "ghcr.io/org/team/repo:1.0.0",
+			},
+			wantHost:    "ghcr.io",
+			wantProject: "org/team",
+			wantRepo:    "repo",
+			wantTag:     "1.0.0",
+			wantPart:    4,
+			wantErr:     false,
+		},
 		{
 			name: "case 4",
 			args: args{
@@ -101,3 +145,221 @@ func Test_analysisImage(t *testing.T) {
 		})
 	}
 }
+
+type fixedRepositoryService string
+
+func (f fixedRepositoryService) LatestTag(context.Context, string, string, string, ...repositoryservice.LookupOption) (string, error) {
+	return string(f), nil
+}
+
+// verifiedDigest the digest of the tags which pass the fake verification
+const verifiedDigest = "sha256:5ca1ab1e"
+
+// fakeVerifier image -> error of the verification, the pinned digest or verifiedDigest is returned when passed
+type fakeVerifier map[string]error
+
+func (f fakeVerifier) Verify(ctx context.Context, namespace, image string, keychain repositoryservice.Keychain) (string, error) {
+	if err := f[image]; err != nil {
+		return "", err
+	}
+	if digest := eventservice.OfImageEvent(image).Digest; digest != "" {
+		return digest, nil
+	}
+	return verifiedDigest, nil
+}
+
+func Test_latestTagWebHook_Handle(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "release", Labels: map[string]string{modeLabel: PlaceholderMode}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{modeLabel: AllMode}}},
+	)
+	podSpec := func(images ...string) corev1.PodSpec {
+		spec := corev1.PodSpec{}
+		for i, image := range images {
+			spec.Containers = append(spec.Containers, corev1.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+		}
+		return spec
+	}
+	deployment := func(images ...string) runtime.Object {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec(images...)}},
+		}
+	}
+	images := []string{"web", "web:latest", "web:laborer-latest", "web:v1.2.3", "web@sha256:0a1b"}
+
+	tests := []struct {
+		name      string
+		mode      string
+		namespace string
+		kind      string
+		operation admissionv1.Operation
+		object    runtime.Object
+		oldObject runtime.Object
+		verifier  signature.Verifier
+		want      []string
+		// wantDenied the request is denied because of the signatures
+		wantDenied bool
+	}{
+		{
+			name:      "all",
+			mode:      AllMode,
+			namespace: "dev",
+			kind:      "Deployment",
+			object:    deployment(images...),
+			want: []string{
+				"/spec/template/spec/containers/0/image=web:v2",
+				"/spec/template/spec/containers/1/image=web:v2",
+				"/spec/template/spec/containers/2/image=web:v2",
+				"/spec/template/spec/containers/3/image=web:v2",
+			},
+		},
+		{
+			name:      "placeholder",
+			mode:      PlaceholderMode,
+			namespace: "dev",
+			kind:      "Deployment",
+			object:    deployment(images...),
+			want: []string{
+				"/spec/template/spec/containers/0/image=web:v2",
+				"/spec/template/spec/containers/1/image=web:v2",
+				"/spec/template/spec/containers/2/image=web:v2",
+			},
+		},
+		{
+			name:      "namespace label overrides config",
+			mode:      AllMode,
+			namespace: "release",
+			kind:      "Deployment",
+			object:    deployment("web:v1.2.3", "web"),
+			want:      []string{"/spec/template/spec/containers/1/image=web:v2"},
+		},
+		{
+			name:      "namespace label back to all",
+			mode:      PlaceholderMode,
+			namespace: "test",
+			kind:      "Deployment",
+			object:    deployment("web:v1.2.3"),
+			want:      []string{"/spec/template/spec/containers/0/image=web:v2"},
+		},
+		{
+			name:      "update changed image only",
+			mode:      AllMode,
+			namespace: "dev",
+			kind:      "Deployment",
+			operation: admissionv1.Update,
+			object:    deployment("web:v1", "web:latest", "web"),
+			oldObject: deployment("web:v1", "web:v1"),
+			want: []string{
+				"/spec/template/spec/containers/1/image=web:v2",
+				"/spec/template/spec/containers/2/image=web:v2",
+			},
+		},
+		{
+			name:      "statefulset init containers",
+			mode:      AllMode,
+			namespace: "dev",
+			kind:      "StatefulSet",
+			object: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "web"},
+				Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init", Image: "init"}},
+				}}},
+			},
+			want: []string{"/spec/template/spec/initContainers/0/image=init:v2"},
+		},
+		{
+			name:      "cronjob",
+			mode:      AllMode,
+			namespace: "dev",
+			kind:      "CronJob",
+			object: &batchv1beta1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "backup"},
+				Spec: batchv1beta1.CronJobSpec{JobTemplate: batchv1beta1.JobTemplateSpec{Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{Spec: podSpec("backup")},
+				}}},
+			},
+			want: []string{"/spec/jobTemplate/spec/template/spec/containers/0/image=backup:v2"},
+		},
+		{
+			name:      "pod",
+			mode:      AllMode,
+			namespace: "dev",
+			kind:      "Pod",
+			object:    &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "debug"}, Spec: podSpec("busybox")},
+			want:      []string{"/spec/containers/0/image=busybox:v2"},
+		},
+		{
+			name:      "pod controlled by replicaset",
+			mode:      AllMode,
+			namespace: "dev",
+			kind:      "Pod",
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-1", OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web"}}, appsv1.SchemeGroupVersion.WithKind("ReplicaSet")),
+				}},
+				Spec: podSpec("web"),
+			},
+		},
+		{
+			name:      "verified image",
+			mode:      AllMode,
+			namespace: "dev",
+			kind:      "Pod",
+			object:    &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "debug"}, Spec: podSpec("busybox")},
+			verifier:  fakeVerifier{"web:v2": errors.New("not signed")},
+			want:      []string{"/spec/containers/0/image=busybox:v2@" + verifiedDigest},
+		},
+		{
+			name:       "unverified image is denied",
+			mode:       AllMode,
+			namespace:  "dev",
+			kind:       "Deployment",
+			object:     deployment("busybox", "web"),
+			verifier:   fakeVerifier{"web:v2": errors.New("not signed")},
+			wantDenied: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewLatestTagOptions()
+			options.Mode = tt.mode
+			handler := NewLatestTagWebHook(options, fixedRepositoryService("v2"), tt.verifier, client, time.Second, nil)
+
+			operation := tt.operation
+			if operation == "" {
+				operation = admissionv1.Create
+			}
+			dryRun := true
+			req := admissionv1.AdmissionRequest{
+				Namespace: tt.namespace,
+				Kind:      metav1.GroupVersionKind{Kind: tt.kind},
+				Operation: operation,
+				DryRun:    &dryRun,
+			}
+			req.Object.Raw, _ = json.Marshal(tt.object)
+			if tt.oldObject != nil {
+				req.OldObject.Raw, _ = json.Marshal(tt.oldObject)
+			}
+			resp := handler.Handle(context.Background(), admission.Request{AdmissionRequest: req})
+			if tt.wantDenied {
+				if resp.Allowed {
+					t.Errorf("Handle() allowed, want denied")
+				}
+				return
+			}
+			if !resp.Allowed {
+				t.Fatalf("Handle() denied: %v", resp.Result)
+			}
+
+			var got []string
+			for _, patch := range resp.Patches {
+				got = append(got, fmt.Sprintf("%s=%v", patch.Path, patch.Value))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Handle() patches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package latesttag
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// AllMode 替换所有镜像的 tag
+	AllMode = "all"
+	// PlaceholderMode 只替换未指定 tag, latest 以及占位 tag 的镜像, 固定的版本保持原样
+	PlaceholderMode = "placeholder"
+)
+
+type LatestTagOptions struct {
+	// Mode all or placeholder, can be overridden by the namespace label laborer.latest-tag.mode
+	Mode string `json:"mode" yaml:"mode"`
+	// Placeholders tags resolved in placeholder mode besides latest
+	Placeholders []string `json:"placeholders,omitempty" yaml:"placeholders,omitempty"`
+}
+
+func (l *LatestTagOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&l.Mode, "latest-tag-mode", l.Mode, fmt.Sprintf("which images the latest-tag webhook resolves, optional: %s, %s. "+
+		"%s only resolves images without a tag, with latest or with a placeholder tag", AllMode, PlaceholderMode, PlaceholderMode))
+	fs.StringSliceVar(&l.Placeholders, "latest-tag-placeholders", l.Placeholders, "placeholder tags resolved in placeholder mode besides latest")
+}
+
+func (l *LatestTagOptions) Validate() (errs []error) {
+	if !validMode(l.Mode) {
+		errs = append(errs, fmt.Errorf("latest tag mode must be %s or %s", AllMode, PlaceholderMode))
+	}
+	for _, placeholder := range l.Placeholders {
+		if placeholder == "" {
+			errs = append(errs, fmt.Errorf("latest tag placeholder must not be empty"))
+		}
+	}
+	return errs
+}
+
+func NewLatestTagOptions() *LatestTagOptions {
+	return &LatestTagOptions{
+		Mode:         AllMode,
+		Placeholders: []string{"laborer-latest"},
+	}
+}
+
+func validMode(mode string) bool {
+	return mode == AllMode || mode == PlaceholderMode
+}
+
+type ImagePolicyOptions struct {
+	// MutableTags tags treated as mutable besides latest
+	MutableTags []string `json:"mutableTags,omitempty" yaml:"mutableTags,omitempty"`
+	// RequireDigest also flag references not pinned by digest, can be overridden by the namespace label
+	// laborer.image-policy.require-digest
+	RequireDigest bool `json:"requireDigest" yaml:"requireDigest"`
+}
+
+func (p *ImagePolicyOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&p.MutableTags, "image-policy-mutable-tags", p.MutableTags, "tags treated as mutable by the image policy webhook besides latest")
+	fs.BoolVar(&p.RequireDigest, "image-policy-require-digest", p.RequireDigest, "whether the image policy webhook also flags references not pinned by digest")
+}
+
+func (p *ImagePolicyOptions) Validate() (errs []error) {
+	for _, tag := range p.MutableTags {
+		if tag == "" {
+			errs = append(errs, fmt.Errorf("image policy mutable tag must not be empty"))
+		}
+	}
+	return errs
+}
+
+func NewImagePolicyOptions() *ImagePolicyOptions {
+	return &ImagePolicyOptions{
+		MutableTags: []string{"laborer-latest"},
+	}
+}
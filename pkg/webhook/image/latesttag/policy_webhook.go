@@ -0,0 +1,149 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package latesttag
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// policyLabel namespace 的执行级别: warn 或 deny, 未设置时不检查
+	policyLabel = "laborer.image-policy"
+	// requireDigestLabel namespace 是否要求以 digest 引用镜像, 优先于配置
+	requireDigestLabel = "laborer.image-policy.require-digest"
+
+	warnPolicy = "warn"
+	denyPolicy = "deny"
+)
+
+// imagePolicyWebHook 拒绝或警告使用可变 tag 的工作负载, 在 latestTagWebHook 替换 tag 之后执行
+type imagePolicyWebHook struct {
+	options *ImagePolicyOptions
+	client  kubernetes.Interface
+}
+
+// NewImagePolicyWebHook client 用于读取 namespace 的执行级别
+func NewImagePolicyWebHook(options *ImagePolicyOptions, client kubernetes.Interface) admission.Handler {
+	return &imagePolicyWebHook{
+		options: options,
+		client:  client,
+	}
+}
+
+func (p *imagePolicyWebHook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj, err := decodeWorkload(req.Kind.Kind, req.Object.Raw)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		return admission.Allowed(fmt.Sprintf("controlled by %s %s", owner.Kind, owner.Name))
+	}
+
+	ns, err := p.client.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	level := ns.Labels[policyLabel]
+	if level != warnPolicy && level != denyPolicy {
+		return admission.Allowed("")
+	}
+	requireDigest := p.options.RequireDigest
+	if value, ok := ns.Labels[requireDigestLabel]; ok {
+		if requireDigest, err = strconv.ParseBool(value); err != nil {
+			klog.Warningf("namespace %s has invalid %s %q", ns.Name, requireDigestLabel, value)
+			requireDigest = p.options.RequireDigest
+		}
+	}
+
+	// UPDATE 时只检查 image 发生变化的容器, 以免启用策略前创建的工作负载无法修改
+	var oldInitContainers, oldContainers map[string]string
+	if req.Operation == admissionv1.Update {
+		oldObj, err := decodeWorkload(req.Kind.Kind, req.OldObject.Raw)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		oldInitContainers, oldContainers = containerImages(oldObj.podSpec.InitContainers), containerImages(oldObj.podSpec.Containers)
+	}
+	violations := p.violations(obj.podSpec.InitContainers, oldInitContainers, requireDigest)
+	violations = append(violations, p.violations(obj.podSpec.Containers, oldContainers, requireDigest)...)
+	if len(violations) == 0 {
+		return admission.Allowed("")
+	}
+
+	klog.V(2).Infof("%s %s/%s violates the image policy (%s): %s", req.Kind.Kind, req.Namespace, obj.Name, level,
+		strings.Join(violations, "; "))
+	if level == denyPolicy {
+		return admission.Denied(strings.Join(violations, "; "))
+	}
+	return admission.Allowed("").WithWarnings(violations...)
+}
+
+// violations 使用可变引用的容器, oldImages 不为 nil 时跳过 image 未改变的容器
+func (p *imagePolicyWebHook) violations(containers []corev1.Container, oldImages map[string]string, requireDigest bool) []string {
+	var violations []string
+	for _, container := range containers {
+		if oldImage, ok := oldImages[container.Name]; ok && oldImage == container.Image {
+			continue
+		}
+		if strings.Contains(container.Image, "@") {
+			continue
+		}
+
+		tag, ok := imageTag(container.Image)
+		switch {
+		case !ok:
+			violations = append(violations, fmt.Sprintf("container %s image %s has no tag", container.Name, container.Image))
+		case p.mutableTag(tag):
+			violations = append(violations, fmt.Sprintf("container %s image %s uses the mutable tag %s", container.Name, container.Image, tag))
+		case requireDigest:
+			violations = append(violations, fmt.Sprintf("container %s image %s is not pinned by digest", container.Name, container.Image))
+		}
+	}
+	return violations
+}
+
+func (p *imagePolicyWebHook) mutableTag(tag string) bool {
+	if tag == defaultTagName {
+		return true
+	}
+	for _, mutable := range p.options.MutableTags {
+		if tag == mutable {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTag 镜像中显式指定的 tag, 端口号不是 tag, 例如: localhost:5000/web
+func imageTag(image string) (string, bool) {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if index := strings.LastIndex(name, ":"); index >= 0 {
+		return name[index+1:], true
+	}
+	return "", false
+}
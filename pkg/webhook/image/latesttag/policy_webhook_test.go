@@ -0,0 +1,143 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package latesttag
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func Test_imagePolicyWebHook_Handle(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{policyLabel: warnPolicy}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{policyLabel: denyPolicy}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "secure", Labels: map[string]string{
+			policyLabel: denyPolicy, requireDigestLabel: "true",
+		}}},
+	)
+	deployment := func(images ...string) []byte {
+		obj := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+		for i, image := range images {
+			obj.Spec.Template.Spec.Containers = append(obj.Spec.Template.Spec.Containers,
+				corev1.Container{Name: string(rune('a' + i)), Image: image})
+		}
+		raw, _ := json.Marshal(obj)
+		return raw
+	}
+
+	tests := []struct {
+		name         string
+		namespace    string
+		operation    admissionv1.Operation
+		object       []byte
+		oldObject    []byte
+		wantAllowed  bool
+		wantWarnings []string
+	}{
+		{
+			name:        "policy disabled",
+			namespace:   "dev",
+			object:      deployment("web:latest"),
+			wantAllowed: true,
+		},
+		{
+			name:        "warn",
+			namespace:   "test",
+			object:      deployment("web", "web:latest", "localhost:5000/web:laborer-latest", "web:v1"),
+			wantAllowed: true,
+			wantWarnings: []string{
+				"container a image web has no tag",
+				"container b image web:latest uses the mutable tag latest",
+				"container c image localhost:5000/web:laborer-latest uses the mutable tag laborer-latest",
+			},
+		},
+		{
+			name:        "deny",
+			namespace:   "prod",
+			object:      deployment("web:v1", "localhost:5000/web"),
+			wantAllowed: false,
+		},
+		{
+			name:        "pinned tag",
+			namespace:   "prod",
+			object:      deployment("web:v1", "localhost:5000/web:v1"),
+			wantAllowed: true,
+		},
+		{
+			name:        "require digest",
+			namespace:   "secure",
+			object:      deployment("web:v1"),
+			wantAllowed: false,
+		},
+		{
+			name:        "digest",
+			namespace:   "secure",
+			object:      deployment("web@sha256:0a1b", "web:v1@sha256:0a1b"),
+			wantAllowed: true,
+		},
+		{
+			name:        "update without changing image",
+			namespace:   "prod",
+			operation:   admissionv1.Update,
+			object:      deployment("web:latest", "web:v2"),
+			oldObject:   deployment("web:latest", "web:v1"),
+			wantAllowed: true,
+		},
+		{
+			name:        "update changed image",
+			namespace:   "prod",
+			operation:   admissionv1.Update,
+			object:      deployment("web:latest"),
+			oldObject:   deployment("web:v1"),
+			wantAllowed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewImagePolicyWebHook(NewImagePolicyOptions(), client)
+
+			operation := tt.operation
+			if operation == "" {
+				operation = admissionv1.Create
+			}
+			resp := handler.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Namespace: tt.namespace,
+				Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Operation: operation,
+				Object:    runtime.RawExtension{Raw: tt.object},
+				OldObject: runtime.RawExtension{Raw: tt.oldObject},
+			}})
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("Handle() allowed = %v, want %v, result: %v", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+			if !reflect.DeepEqual(resp.Warnings, tt.wantWarnings) {
+				t.Errorf("Handle() warnings = %v, want %v", resp.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
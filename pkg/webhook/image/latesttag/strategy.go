@@ -0,0 +1,62 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package latesttag
+
+import (
+	"fmt"
+	"strconv"
+
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// strategyAnnotation tag 的排序方式: push-time, semver, alphabetical
+	strategyAnnotation = "laborer.latest-tag.strategy"
+	// filterAnnotation 只选择匹配该正则的 tag
+	filterAnnotation = "laborer.latest-tag.filter"
+	// prereleaseAnnotation semver 排序时是否包含预发布版本
+	prereleaseAnnotation = "laborer.latest-tag.prerelease"
+)
+
+// tagStrategy 根据 annotation 确定选择 tag 的策略, Deployment 的 annotation 优先于 namespace 的 annotation
+func tagStrategy(ns *corev1.Namespace, annotations map[string]string) (*repositoryservice.TagStrategy, error) {
+	merged := map[string]string{}
+	for _, source := range []map[string]string{namespaceAnnotations(ns), annotations} {
+		for _, key := range []string{strategyAnnotation, filterAnnotation, prereleaseAnnotation} {
+			if value, ok := source[key]; ok {
+				merged[key] = value
+			}
+		}
+	}
+
+	var prerelease bool
+	if value, ok := merged[prereleaseAnnotation]; ok {
+		var err error
+		if prerelease, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", prereleaseAnnotation, value, err)
+		}
+	}
+	return repositoryservice.NewTagStrategy(merged[strategyAnnotation], merged[filterAnnotation], prerelease)
+}
+
+func namespaceAnnotations(ns *corev1.Namespace) map[string]string {
+	if ns == nil {
+		return nil
+	}
+	return ns.Annotations
+}
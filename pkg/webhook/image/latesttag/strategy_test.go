@@ -0,0 +1,65 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package latesttag
+
+import (
+	"testing"
+
+	repositoryservice "github.com/arugal/laborer/pkg/service/repository"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_tagStrategy(t *testing.T) {
+	release := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "release", Annotations: map[string]string{
+		strategyAnnotation: repositoryservice.SemverOrder,
+		filterAnnotation:   `^v1\.`,
+	}}}
+	dev := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}}
+
+	tests := []struct {
+		name        string
+		namespace   *corev1.Namespace
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{name: "default", namespace: dev, want: repositoryservice.PushTimeOrder},
+		{name: "namespace", namespace: release, want: `semver~^v1\.`},
+		{
+			name:        "deployment overrides namespace",
+			namespace:   release,
+			annotations: map[string]string{filterAnnotation: `^v2\.`, prereleaseAnnotation: "true"},
+			want:        `semver+prerelease~^v2\.`,
+		},
+		{name: "namespace not found", namespace: nil, annotations: map[string]string{strategyAnnotation: "alphabetical"}, want: "alphabetical"},
+		{name: "unknown strategy", namespace: dev, annotations: map[string]string{strategyAnnotation: "newest"}, wantErr: true},
+		{name: "invalid prerelease", namespace: dev, annotations: map[string]string{prereleaseAnnotation: "yes"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tagStrategy(tt.namespace, tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tagStrategy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("tagStrategy() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
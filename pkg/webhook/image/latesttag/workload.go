@@ -0,0 +1,89 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package latesttag
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workload 包含 pod 模板的资源, 只解析 metadata 和 PodSpec, 与资源的 apiVersion 无关
+type workload struct {
+	metav1.ObjectMeta
+
+	podSpec corev1.PodSpec
+	// path PodSpec 的 JSON patch 路径
+	path string
+}
+
+// decodeWorkload 按 kind 解析资源中的 PodSpec
+func decodeWorkload(kind string, raw []byte) (*workload, error) {
+	var obj struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+		Spec     json.RawMessage   `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	w := &workload{ObjectMeta: obj.Metadata}
+	if len(obj.Spec) == 0 {
+		return nil, fmt.Errorf("%s %s has no spec", kind, obj.Metadata.Name)
+	}
+
+	var err error
+	switch kind {
+	case "Pod":
+		w.path = "/spec"
+		err = json.Unmarshal(obj.Spec, &w.podSpec)
+	case "CronJob":
+		var spec struct {
+			JobTemplate struct {
+				Spec struct {
+					Template corev1.PodTemplateSpec `json:"template"`
+				} `json:"spec"`
+			} `json:"jobTemplate"`
+		}
+		err = json.Unmarshal(obj.Spec, &spec)
+		w.path = "/spec/jobTemplate/spec/template/spec"
+		w.podSpec = spec.JobTemplate.Spec.Template.Spec
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		var spec struct {
+			Template corev1.PodTemplateSpec `json:"template"`
+		}
+		err = json.Unmarshal(obj.Spec, &spec)
+		w.path = "/spec/template/spec"
+		w.podSpec = spec.Template.Spec
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// containerImages 容器名称 -> image, 用于 UPDATE 时判断 image 是否改变
+func containerImages(containers []corev1.Container) map[string]string {
+	images := make(map[string]string, len(containers))
+	for _, container := range containers {
+		images[container.Name] = container.Image
+	}
+	return images
+}
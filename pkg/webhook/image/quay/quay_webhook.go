@@ -0,0 +1,95 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package quay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+	"k8s.io/klog"
+)
+
+const (
+	source = "quay"
+
+	quayHost = "quay.io"
+)
+
+// imageEventWebHook quay 的 repo_push notification
+type imageEventWebHook struct {
+	collect eventservice.ImageEventCollect
+}
+
+func NewImageEventWebHook(collect eventservice.ImageEventCollect) http.Handler {
+	return &imageEventWebHook{
+		collect: collect,
+	}
+}
+
+func (i *imageEventWebHook) ServeHTTP(_ http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		klog.Warningf("Read quay notification body error: %v", err)
+		return
+	}
+	if len(body) == 0 {
+		klog.Warningf("Quay notification body is empty")
+		return
+	}
+
+	if klog.V(4) {
+		klog.Infof("Quay notification data: %s", string(body))
+	}
+
+	events, err := ParseEvents(body)
+	if err != nil {
+		klog.Warningf("Unmarshal quay notification body [%s] error: %v", string(body), err)
+		return
+	}
+	for _, event := range events {
+		event.Source = source
+		i.collect.Collect(event)
+	}
+}
+
+// ParseEvents 每个 updated_tags 产生一个事件, image 为 docker_url, 为空时使用 quay.io/<repository>,
+// 自建的 quay 中 docker_url 为其自身的地址
+func ParseEvents(body []byte) ([]eventservice.ImageEvent, error) {
+	var push RepoPushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, err
+	}
+
+	image := push.DockerURL
+	if image == "" {
+		if push.Repository == "" {
+			return nil, nil
+		}
+		image = quayHost + "/" + push.Repository
+	}
+
+	var events []eventservice.ImageEvent
+	for _, tag := range push.UpdatedTags {
+		if tag == "" {
+			continue
+		}
+		events = append(events, eventservice.ImageEvent{Image: image, Tag: tag})
+	}
+	return events, nil
+}
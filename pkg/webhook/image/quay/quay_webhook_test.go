@@ -0,0 +1,74 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package quay
+
+import (
+	"reflect"
+	"testing"
+
+	eventservice "github.com/arugal/laborer/pkg/service/event"
+)
+
+func TestParseEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []eventservice.ImageEvent
+		wantErr bool
+	}{
+		{
+			name: "updated tags",
+			body: `{"repository": "org/app", "namespace": "org", "name": "app", "docker_url": "quay.io/org/app",
+				"homepage": "https://quay.io/repository/org/app", "updated_tags": ["v1.0.0", "latest"]}`,
+			want: []eventservice.ImageEvent{
+				{Image: "quay.io/org/app", Tag: "v1.0.0"},
+				{Image: "quay.io/org/app", Tag: "latest"},
+			},
+		},
+		{
+			name: "self-hosted quay",
+			body: `{"repository": "org/app", "docker_url": "quay.example.com/org/app", "updated_tags": ["v1"]}`,
+			want: []eventservice.ImageEvent{{Image: "quay.example.com/org/app", Tag: "v1"}},
+		},
+		{
+			name: "without docker_url",
+			body: `{"repository": "org/app", "updated_tags": ["v1"]}`,
+			want: []eventservice.ImageEvent{{Image: "quay.io/org/app", Tag: "v1"}},
+		},
+		{
+			name: "without updated tags",
+			body: `{"repository": "org/app", "docker_url": "quay.io/org/app", "updated_tags": []}`,
+		},
+		{
+			name:    "invalid json",
+			body:    `{"repository": `,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEvents([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEvents() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEvents() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+/*
+ Copyright 2021 zhangwei24@apache.org
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package quay
+
+//{
+//	"repository": "org/app",
+//	"namespace": "org",
+//	"name": "app",
+//	"docker_url": "quay.io/org/app",
+//	"homepage": "https://quay.io/repository/org/app",
+//	"updated_tags": [
+//		"v1.0.0",
+//		"latest"
+//	]
+//}
+
+type RepoPushEvent struct {
+	Repository  string   `json:"repository"`
+	Namespace   string   `json:"namespace"`
+	Name        string   `json:"name"`
+	DockerURL   string   `json:"docker_url"`
+	Homepage    string   `json:"homepage"`
+	UpdatedTags []string `json:"updated_tags"`
+}